@@ -1,70 +1,474 @@
-// archive.go — extraction of binaries from .tar.gz and .zip archives.
+// archive.go — extraction of binaries from tar (plain, gzip, xz, bzip2 or
+// zstd compressed) and zip archives, and from bare or single-file compressed
+// binaries.
+//
+// The format of a downloaded asset is sniffed from its magic bytes; the
+// format expected from the asset name is only used when the data is not
+// recognised. Archives are read from disk and the binary is streamed out, so
+// neither is held in memory; maxBinarySize caps the decompressed binary
+// against decompression bombs. Tar symlinks and hard links to the binary are
+// followed, and a binary name that matches several files is an error rather
+// than a guess.
 package main
 
 import (
 	"archive/tar"
 	"archive/zip"
 	"bytes"
+	"compress/bzip2"
 	"compress/gzip"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
 	"path"
+	"sort"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
-// extractFromTarGz finds the entry whose basename matches target inside a
-// .tar.gz archive and returns its raw bytes.
-func extractFromTarGz(data []byte, target string) ([]byte, error) {
-	gz, err := gzip.NewReader(bytes.NewReader(data))
+// archiveFormats are the asset formats extractBinary understands, as used in
+// platformDef.archiveExt and assetEntry.ArchiveExt: tar archives, zip, a
+// single compressed binary ("gz", "xz", "bz2", "zst"), or the binary itself
+// ("raw").
+var archiveFormats = []string{"tar.gz", "tar.xz", "tar.bz2", "tar.zst", "tar", "zip", "gz", "xz", "bz2", "zst", "raw"}
+
+// maxBinarySize is the largest binary extractBinary writes, in bytes;
+// 0 means no limit. It is set from -max-binary-size.
+var maxBinarySize int64 = 512 << 20
+
+// errBinaryNotFound is wrapped by the extractors when the archive has no
+// entry matching the binary name.
+var errBinaryNotFound = errors.New("not found")
+
+// errAmbiguousBinary is wrapped by the extractors when several different
+// files of the archive match the binary name.
+var errAmbiguousBinary = errors.New("matches several entries")
+
+// maxLinkHops bounds how many tar symlinks and hard links are followed to
+// reach the binary.
+const maxLinkHops = 16
+
+// entryMatches reports whether the archive entry name is the binary target.
+// A bare filename matches the basename of any entry; a target with a
+// directory ("bin/tool") must match the whole path, or the path below a
+// single top-level directory such as GoReleaser's wrap_in_directory.
+func entryMatches(name, target string) bool {
+	if !strings.Contains(target, "/") {
+		return path.Base(name) == target
+	}
+	name = cleanEntryName(name)
+	target = cleanEntryName(target)
+	if name == target {
+		return true
+	}
+	_, below, ok := strings.Cut(name, "/")
+	return ok && below == target
+}
+
+// cleanEntryName returns an archive entry name in canonical form, without a
+// leading "./".
+func cleanEntryName(name string) string {
+	return path.Clean(strings.TrimPrefix(name, "./"))
+}
+
+// ambiguousBinaryError lists the entries that all match target. A target
+// that is already a path only matches several entries in differently wrapped
+// copies, so the -binary-path hint is given for bare names alone.
+func ambiguousBinaryError(target, kind string, names []string) error {
+	hint := ""
+	if !strings.Contains(target, "/") {
+		hint = "; pass -binary-path with the one to use"
+	}
+	return fmt.Errorf("%q %w in %s archive (%s)%s",
+		target, errAmbiguousBinary, kind, strings.Join(names, ", "), hint)
+}
+
+// sniffArchiveFormat returns the format of src from its magic bytes, or ""
+// when it is not recognised. A compressed stream is a single binary when it
+// decompresses to an executable, and a tar archive otherwise.
+func sniffArchiveFormat(src *io.SectionReader) string {
+	head := make([]byte, 512)
+	n, _ := src.ReadAt(head, 0)
+	data := head[:n]
+
+	var codec string
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		codec = "gz"
+	case bytes.HasPrefix(data, []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}):
+		codec = "xz"
+	case bytes.HasPrefix(data, []byte("BZh")):
+		codec = "bz2"
+	case bytes.HasPrefix(data, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		codec = "zst"
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")), bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		return "zip"
+	case len(data) >= 262 && string(data[257:262]) == "ustar":
+		return "tar"
+	case hasExecutableMagic(data):
+		return "raw"
+	default:
+		return ""
+	}
+
+	if r, err := decompress(rewind(src), codec); err == nil {
+		magic := make([]byte, 4)
+		n, _ := io.ReadFull(r, magic)
+		r.Close()
+		if hasExecutableMagic(magic[:n]) {
+			return codec
+		}
+	}
+	return "tar." + codec
+}
+
+// rewind returns a reader of src from its start, independent of src's own
+// read position.
+func rewind(src *io.SectionReader) *io.SectionReader {
+	return io.NewSectionReader(src, 0, src.Size())
+}
+
+// archiveFormat returns the format of src: the sniffed one, or ext when the
+// data is not recognised. A compressed stream named as a single file (ext
+// "gz" for tool.gz) keeps that format even when it does not decompress to a
+// recognised executable.
+func archiveFormat(src *io.SectionReader, ext string) string {
+	format := sniffArchiveFormat(src)
+	if format == "" || format == "tar."+ext {
+		return ext
+	}
+	if format != ext {
+		slog.Debug("archive format differs from its name, using content", "expected", ext, "detected", format)
+	}
+	return format
+}
+
+// tarCodec returns the compression codec of a tar format ("" for "tar",
+// "xz" for "tar.xz"), and false for formats that are not tar archives.
+func tarCodec(format string) (string, bool) {
+	if format == "tar" {
+		return "", true
+	}
+	return strings.CutPrefix(format, "tar.")
+}
+
+// decompress returns the decompressed stream of r compressed with codec:
+// "gz", "xz", "bz2", "zst", or "" for uncompressed data.
+func decompress(r io.Reader, codec string) (io.ReadCloser, error) {
+	switch codec {
+	case "":
+		return io.NopCloser(r), nil
+	case "gz":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("gzip: %w", err)
+		}
+		return gz, nil
+	case "xz":
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("xz: %w", err)
+		}
+		return io.NopCloser(xr), nil
+	case "bz2":
+		return io.NopCloser(bzip2.NewReader(r)), nil
+	case "zst":
+		zr, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, fmt.Errorf("zstd: %w", err)
+		}
+		return zr.IOReadCloser(), nil
+	}
+	return nil, fmt.Errorf("unsupported compression: %q", codec)
+}
+
+// copyLimited copies r to w, failing once more than limit bytes would be
+// written (limit 0 = no limit). what names the data in the error.
+func copyLimited(w io.Writer, r io.Reader, limit int64, what string) error {
+	if limit <= 0 {
+		_, err := io.Copy(w, r)
+		return err
+	}
+	n, err := io.Copy(w, io.LimitReader(r, limit+1))
 	if err != nil {
-		return nil, fmt.Errorf("gzip: %w", err)
+		return err
+	}
+	if n > limit {
+		return fmt.Errorf("%s exceeds the maximum size of %d bytes", what, limit)
+	}
+	return nil
+}
+
+// extractFromTarball finds the entry matching target inside a tar archive
+// in format and writes it to w. A matching symlink or hard link is followed
+// to the file it names. The archive is read twice: once to index its
+// entries, and once to copy the binary out.
+func extractFromTarball(src *io.SectionReader, format, target string, w io.Writer) error {
+	codec, _ := tarCodec(format)
+	var hdrs []*tar.Header
+	err := readTar(src, codec, func(hdr *tar.Header, _ io.Reader) (bool, error) {
+		hdrs = append(hdrs, hdr)
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	idx, err := findTarEntry(hdrs, target, format)
+	if err != nil {
+		return err
 	}
-	defer gz.Close()
 
-	tr := tar.NewReader(gz)
+	i := 0
+	return readTar(src, codec, func(hdr *tar.Header, r io.Reader) (bool, error) {
+		i++
+		if i-1 != idx {
+			return false, nil
+		}
+		return true, copyLimited(w, r, maxBinarySize, hdr.Name)
+	})
+}
+
+// readTar calls fn with every header of the tar archive src, compressed
+// with codec, and its content, until fn returns true or an error.
+func readTar(src *io.SectionReader, codec string, fn func(hdr *tar.Header, r io.Reader) (bool, error)) error {
+	r, err := decompress(rewind(src), codec)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	tr := tar.NewReader(r)
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
-			break
+			return nil
 		}
 		if err != nil {
-			return nil, fmt.Errorf("tar: %w", err)
+			return fmt.Errorf("tar: %w", err)
 		}
-		if path.Base(hdr.Name) == target {
-			return io.ReadAll(tr)
+		if stop, err := fn(hdr, tr); stop || err != nil {
+			return err
 		}
 	}
-	return nil, fmt.Errorf("%q not found in tar.gz archive", target)
 }
 
-// extractFromZip finds the entry whose basename matches target inside a
-// zip archive and returns its raw bytes.
-func extractFromZip(data []byte, target string) ([]byte, error) {
-	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+// findTarEntry returns the index in hdrs of the regular file the binary
+// target names, following symlinks and hard links. An entry that a later
+// one of the same name replaces is ignored, as tar does on extraction.
+// Several matches are only an error when they are different files. kind
+// names the archive type in errors.
+func findTarEntry(hdrs []*tar.Header, target, kind string) (int, error) {
+	byName := make(map[string]int, len(hdrs))
+	for i, h := range hdrs {
+		byName[cleanEntryName(h.Name)] = i
+	}
+	found := -1
+	var names []string
+	for i, h := range hdrs {
+		if byName[cleanEntryName(h.Name)] != i || !entryMatches(h.Name, target) {
+			continue
+		}
+		if !h.FileInfo().Mode().IsRegular() && h.Typeflag != tar.TypeSymlink {
+			continue
+		}
+		j, err := resolveTarLink(hdrs, byName, i)
+		if err != nil {
+			return 0, err
+		}
+		if j != i {
+			slog.Debug("following link to binary", "entry", h.Name, "target", hdrs[j].Name)
+		}
+		if found >= 0 && j != found {
+			return 0, ambiguousBinaryError(target, kind, append(names, h.Name))
+		}
+		found = j
+		names = append(names, h.Name)
+	}
+	if found < 0 {
+		return 0, fmt.Errorf("%q %w in %s archive", target, errBinaryNotFound, kind)
+	}
+	return found, nil
+}
+
+// resolveTarLink follows the symlink or hard link hdrs[i] to the regular
+// file it names and returns that file's index; a regular file resolves to
+// itself. byName maps entry names to their index.
+func resolveTarLink(hdrs []*tar.Header, byName map[string]int, i int) (int, error) {
+	for range maxLinkHops {
+		h := hdrs[i]
+		var target string
+		switch h.Typeflag {
+		case tar.TypeSymlink:
+			if path.IsAbs(h.Linkname) {
+				return 0, fmt.Errorf("%s: symlink to %s points outside the archive", h.Name, h.Linkname)
+			}
+			target = path.Join(path.Dir(cleanEntryName(h.Name)), h.Linkname)
+		case tar.TypeLink:
+			target = cleanEntryName(h.Linkname)
+		default:
+			if !h.FileInfo().Mode().IsRegular() {
+				return 0, fmt.Errorf("%s is not a regular file", h.Name)
+			}
+			return i, nil
+		}
+		j, ok := byName[target]
+		if !ok {
+			return 0, fmt.Errorf("%s: link target %s is not in the archive", h.Name, target)
+		}
+		i = j
+	}
+	return 0, fmt.Errorf("%s: more than %d levels of links", hdrs[i].Name, maxLinkHops)
+}
+
+// extractFromZip finds the file matching target inside a zip archive and
+// writes it to w.
+func extractFromZip(src *io.SectionReader, target string, w io.Writer) error {
+	zr, err := zip.NewReader(src, src.Size())
 	if err != nil {
-		return nil, fmt.Errorf("zip: %w", err)
+		return fmt.Errorf("zip: %w", err)
 	}
+	var matches []*zip.File
 	for _, f := range zr.File {
-		if path.Base(f.Name) == target {
-			rc, err := f.Open()
-			if err != nil {
-				return nil, err
-			}
-			defer rc.Close()
-			return io.ReadAll(rc)
+		if f.Mode().IsRegular() && entryMatches(f.Name, target) {
+			matches = append(matches, f)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return fmt.Errorf("%q %w in zip archive", target, errBinaryNotFound)
+	case 1:
+	default:
+		names := make([]string, len(matches))
+		for i, f := range matches {
+			names[i] = f.Name
 		}
+		return ambiguousBinaryError(target, "zip", names)
 	}
-	return nil, fmt.Errorf("%q not found in zip archive", target)
+	rc, err := matches[0].Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return copyLimited(w, rc, maxBinarySize, matches[0].Name)
 }
 
-// extractBinary delegates to the archive-specific extractor based on ext
-// ("tar.gz" or "zip").
-func extractBinary(archiveData []byte, ext, binaryFilename string) ([]byte, error) {
-	switch ext {
-	case "tar.gz":
-		return extractFromTarGz(archiveData, binaryFilename)
+// extractBinary writes the binary of src to w, delegating to the
+// archive-specific extractor based on the format of src, one of
+// archiveFormats, with ext as the expected format. "raw" means the data
+// already is the binary, as for a bare release asset or a file pushed on its
+// own as an OCI artifact; "gz", "xz", "bz2" and "zst" are a binary
+// compressed on its own.
+func extractBinary(src *io.SectionReader, ext, binaryFilename string, w io.Writer) error {
+	format := archiveFormat(src, ext)
+	if _, ok := tarCodec(format); ok {
+		return extractFromTarball(src, format, binaryFilename, w)
+	}
+	switch format {
 	case "zip":
-		return extractFromZip(archiveData, binaryFilename)
+		return extractFromZip(src, binaryFilename, w)
+	case "raw":
+		return copyLimited(w, rewind(src), maxBinarySize, "binary")
+	case "gz", "xz", "bz2", "zst":
+		r, err := decompress(rewind(src), format)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		if err := copyLimited(w, r, maxBinarySize, "binary"); err != nil {
+			return fmt.Errorf("%s: %w", format, err)
+		}
+		return nil
 	default:
-		return nil, fmt.Errorf("unsupported archive type: %q", ext)
+		return fmt.Errorf("unsupported archive type: %q", format)
+	}
+}
+
+// listExecutables returns the paths of the executable entries of an archive:
+// regular files with an execute bit in tar archives, and in zip archives
+// files named *.exe, starting with a PE ("MZ") header, or carrying Unix
+// execute bits.
+func listExecutables(src *io.SectionReader, ext string) ([]string, error) {
+	var names []string
+	format := archiveFormat(src, ext)
+	err := walkArchive(src, format, func(name string, mode fs.FileMode, r io.Reader) error {
+		switch {
+		case mode&0o111 != 0:
+		case format == "zip" && (strings.HasSuffix(strings.ToLower(name), ".exe") || hasPEHeader(r)):
+		default:
+			return nil
+		}
+		names = append(names, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// hasPEHeader reports whether r starts with the "MZ" magic of a Windows
+// executable.
+func hasPEHeader(r io.Reader) bool {
+	magic := make([]byte, 2)
+	if _, err := io.ReadFull(r, magic); err != nil {
+		return false
+	}
+	return string(magic) == "MZ"
+}
+
+// walkArchive calls fn with the name, mode and content of every regular file
+// of a tar or zip archive in format, stopping at the first error. Tar hard
+// links carry no content of their own and are skipped.
+func walkArchive(src *io.SectionReader, format string, fn func(name string, mode fs.FileMode, r io.Reader) error) error {
+	if codec, isTar := tarCodec(format); isTar {
+		return readTar(src, codec, func(hdr *tar.Header, r io.Reader) (bool, error) {
+			if mode := hdr.FileInfo().Mode(); mode.IsRegular() && hdr.Typeflag != tar.TypeLink {
+				return false, fn(hdr.Name, mode, r)
+			}
+			return false, nil
+		})
+	}
+	if format != "zip" {
+		return fmt.Errorf("cannot list %q archives", format)
+	}
+	zr, err := zip.NewReader(src, src.Size())
+	if err != nil {
+		return fmt.Errorf("zip: %w", err)
+	}
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("zip: %w", err)
+		}
+		err = fn(f.Name, f.Mode(), rc)
+		rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// inferBinary picks the binary of an archive whose expected binary name was
+// not found: its only executable entry. With none or several it fails,
+// listing the candidates.
+func inferBinary(src *io.SectionReader, ext string) (string, error) {
+	names, err := listExecutables(src, ext)
+	if err != nil {
+		return "", err
+	}
+	switch len(names) {
+	case 1:
+		return names[0], nil
+	case 0:
+		return "", fmt.Errorf("no executable in archive; pass -binary-name")
 	}
+	return "", fmt.Errorf("several executables in archive (%s); pass -binary-name", strings.Join(names, ", "))
 }
@@ -6,9 +6,29 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
 	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
 )
 
+// sectionOf returns a section reader over data, as extraction reads files.
+func sectionOf(data []byte) *io.SectionReader {
+	return io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))
+}
+
+// extract runs extractBinary on data and returns the binary it wrote.
+func extract(data []byte, ext, target string) ([]byte, error) {
+	var buf bytes.Buffer
+	err := extractBinary(sectionOf(data), ext, target, &buf)
+	return buf.Bytes(), err
+}
+
 // makeTarGz builds an in-memory .tar.gz from a map of filename→content.
 func makeTarGz(t *testing.T, files map[string][]byte) []byte {
 	t.Helper()
@@ -63,7 +83,7 @@ func TestExtractFromTarGz_Found(t *testing.T) {
 		"subdir/mybinary": want,
 		"other.txt":       []byte("noise"),
 	})
-	got, err := extractFromTarGz(data, "mybinary")
+	got, err := extract(data, "tar.gz", "mybinary")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -74,7 +94,7 @@ func TestExtractFromTarGz_Found(t *testing.T) {
 
 func TestExtractFromTarGz_NotFound(t *testing.T) {
 	data := makeTarGz(t, map[string][]byte{"other.txt": []byte("noise")})
-	_, err := extractFromTarGz(data, "missing")
+	_, err := extract(data, "tar.gz", "missing")
 	if err == nil {
 		t.Fatal("expected error for missing file, got nil")
 	}
@@ -84,7 +104,7 @@ func TestExtractFromTarGz_NestedPath(t *testing.T) {
 	// Extraction should match on basename, ignoring directory prefix.
 	want := []byte("deep")
 	data := makeTarGz(t, map[string][]byte{"a/b/c/tool": want})
-	got, err := extractFromTarGz(data, "tool")
+	got, err := extract(data, "tar.gz", "tool")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -99,7 +119,7 @@ func TestExtractFromZip_Found(t *testing.T) {
 		"subdir/tool.exe": want,
 		"README.md":       []byte("docs"),
 	})
-	got, err := extractFromZip(data, "tool.exe")
+	got, err := extract(data, "zip", "tool.exe")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -110,7 +130,7 @@ func TestExtractFromZip_Found(t *testing.T) {
 
 func TestExtractFromZip_NotFound(t *testing.T) {
 	data := makeZip(t, map[string][]byte{"readme.md": []byte("docs")})
-	_, err := extractFromZip(data, "missing.exe")
+	_, err := extract(data, "zip", "missing.exe")
 	if err == nil {
 		t.Fatal("expected error for missing file, got nil")
 	}
@@ -119,7 +139,7 @@ func TestExtractFromZip_NotFound(t *testing.T) {
 func TestExtractBinary_TarGz(t *testing.T) {
 	want := []byte("binary data")
 	data := makeTarGz(t, map[string][]byte{"mytool": want})
-	got, err := extractBinary(data, "tar.gz", "mytool")
+	got, err := extract(data, "tar.gz", "mytool")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -131,7 +151,7 @@ func TestExtractBinary_TarGz(t *testing.T) {
 func TestExtractBinary_Zip(t *testing.T) {
 	want := []byte("exe data")
 	data := makeZip(t, map[string][]byte{"mytool.exe": want})
-	got, err := extractBinary(data, "zip", "mytool.exe")
+	got, err := extract(data, "zip", "mytool.exe")
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -141,15 +161,383 @@ func TestExtractBinary_Zip(t *testing.T) {
 }
 
 func TestExtractBinary_UnknownExt(t *testing.T) {
-	_, err := extractBinary([]byte("data"), "rar", "file")
+	_, err := extract([]byte("data"), "rar", "file")
 	if err == nil {
 		t.Fatal("expected error for unknown archive type, got nil")
 	}
 }
 
 func TestExtractBinary_CorruptData(t *testing.T) {
-	_, err := extractBinary([]byte("not a valid archive"), "tar.gz", "file")
+	_, err := extract([]byte("not a valid archive"), "tar.gz", "file")
 	if err == nil {
 		t.Fatal("expected error for corrupt archive, got nil")
 	}
 }
+
+func TestEntryMatches(t *testing.T) {
+	tests := []struct {
+		name, target string
+		want         bool
+	}{
+		{"tool", "tool", true},
+		{"dir/tool", "tool", true},
+		{"dir/tool", "bin/tool", false},
+		{"bin/tool", "bin/tool", true},
+		{"./bin/tool", "bin/tool", true},
+		{"tool_1.0_linux/bin/tool", "bin/tool", true},
+		{"tool_1.0_linux/xbin/tool", "bin/tool", false},
+		{"docs/examples/bin/tool", "bin/tool", false},
+		{"tool_1.0_linux/docs/examples/bin/tool", "bin/tool", false},
+	}
+	for _, tt := range tests {
+		if got := entryMatches(tt.name, tt.target); got != tt.want {
+			t.Errorf("entryMatches(%q, %q) = %v, want %v", tt.name, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestListExecutables_TarModeBits(t *testing.T) {
+	data := makeTarEntries(t, "gz",
+		tar.Header{Name: "my_tool_1.0/my_tool", Mode: 0o755},
+		tar.Header{Name: "my_tool_1.0/README.md", Mode: 0o644},
+		tar.Header{Name: "my_tool_1.0/LICENSE", Mode: 0o644},
+	)
+	got, err := listExecutables(sectionOf(data), "tar.gz")
+	if err != nil {
+		t.Fatalf("listExecutables: %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"my_tool_1.0/my_tool"}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestListExecutables_Zip(t *testing.T) {
+	data := makeZip(t, map[string][]byte{
+		"my_tool.exe": []byte("MZ..."),
+		"helper":      []byte("MZ\x90\x00"),
+		"README.md":   []byte("# readme"),
+	})
+	got, err := listExecutables(sectionOf(data), "zip")
+	if err != nil {
+		t.Fatalf("listExecutables: %v", err)
+	}
+	if !reflect.DeepEqual(got, []string{"helper", "my_tool.exe"}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestInferBinary(t *testing.T) {
+	single := makeTarEntries(t, "gz", tar.Header{Name: "my_tool"}, tar.Header{Name: "README.md", Mode: 0o644})
+	name, err := inferBinary(sectionOf(single), "tar.gz")
+	if err != nil || name != "my_tool" {
+		t.Errorf("single: got %q, %v; want my_tool", name, err)
+	}
+
+	several := makeTarEntries(t, "gz", tar.Header{Name: "tool"}, tar.Header{Name: "tool-helper"})
+	_, err = inferBinary(sectionOf(several), "tar.gz")
+	if err == nil || !strings.Contains(err.Error(), "tool, tool-helper") {
+		t.Errorf("several: got %v, want an error listing both candidates", err)
+	}
+
+	none := makeTarEntries(t, "gz", tar.Header{Name: "README.md", Mode: 0o644})
+	if _, err := inferBinary(sectionOf(none), "tar.gz"); err == nil {
+		t.Error("none: expected error")
+	}
+}
+
+func TestExtractBinary_NotFoundIsErrBinaryNotFound(t *testing.T) {
+	data := makeTarGz(t, map[string][]byte{"other": []byte("x")})
+	_, err := extract(data, "tar.gz", "mytool")
+	if !errors.Is(err, errBinaryNotFound) {
+		t.Errorf("err = %v, want errBinaryNotFound", err)
+	}
+}
+
+// tarBz2Fixture is a tar.bz2 holding "mytool" with the content
+// "bz2 binary"; the standard library has no bzip2 writer.
+const tarBz2Fixture = "QlpoOTFBWSZTWc2cJdgAAH77kMoAAEBAAH+AABBwJ54wBAAACCAAdBoUwgYJoGTagklGmTQyAA0Ovm2tschBR6QkSdNjuE2egQyGCqVaUGAuGxMhQMkeVKYNmyBI1cb3GK2kvv07o/kILtkisC2xmu8yIgPxdyRThQkM2cJdgA=="
+
+func TestExtractBinary_CompressedTars(t *testing.T) {
+	want := []byte("content of dir/mytool")
+	plain := makeTarEntries(t, "", tar.Header{Name: "dir/mytool"})
+	tarXz := makeTarEntries(t, "xz", tar.Header{Name: "dir/mytool"})
+	tarZst := makeTarEntries(t, "zst", tar.Header{Name: "dir/mytool"})
+
+	bz2, err := base64.StdEncoding.DecodeString(tarBz2Fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name, ext string
+		data      []byte
+		want      []byte
+	}{
+		{"tar", "tar", plain, want},
+		{"tar.xz", "tar.xz", tarXz, want},
+		{"tar.zst", "tar.zst", tarZst, want},
+		{"tar.bz2", "tar.bz2", bz2, []byte("bz2 binary")},
+		// The content decides, not the name.
+		{"xz named tar.gz", "tar.gz", tarXz, want},
+		{"zst named zip", "zip", tarZst, want},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extract(tt.data, tt.ext, "mytool")
+			if err != nil {
+				t.Fatalf("extractBinary: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSniffArchiveFormat(t *testing.T) {
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{makeTarGz(t, map[string][]byte{"a": nil}), "tar.gz"},
+		{makeZip(t, map[string][]byte{"a": nil}), "zip"},
+		{makeTarEntries(t, "", tar.Header{Name: "a"}), "tar"},
+		{[]byte{0xfd, '7', 'z', 'X', 'Z', 0x00, 0x00}, "tar.xz"},
+		{[]byte("BZh91AY&SY"), "tar.bz2"},
+		{[]byte{0x28, 0xb5, 0x2f, 0xfd, 0x00}, "tar.zst"},
+		{[]byte("\x7fELF"), "raw"},
+		{[]byte("MZ\x90\x00"), "raw"},
+		{[]byte{0xcf, 0xfa, 0xed, 0xfe}, "raw"},
+		{compress(t, "gz", []byte("\x7fELF\x02\x01")), "gz"},
+		{compress(t, "gz", []byte("#!/bin/sh\n")), "tar.gz"},
+		{[]byte("#!/bin/sh\n"), ""},
+	}
+	for _, tt := range tests {
+		if got := sniffArchiveFormat(sectionOf(tt.data)); got != tt.want {
+			t.Errorf("sniffArchiveFormat(%q...) = %q, want %q", tt.data[:4], got, tt.want)
+		}
+	}
+}
+
+func TestExtractBinary_Raw(t *testing.T) {
+	elf := []byte("\x7fELF\x02\x01\x01 rest of binary")
+	script := []byte("#!/bin/sh\n")
+
+	tests := []struct {
+		name, ext  string
+		data, want []byte
+	}{
+		{"raw", "raw", elf, elf},
+		{"bare binary named as archive", "tar.gz", elf, elf},
+		{"gz", "gz", compress(t, "gz", elf), elf},
+		{"xz", "xz", compress(t, "xz", elf), elf},
+		{"gz named as tarball", "tar.gz", compress(t, "gz", elf), elf},
+		{"gz of an unrecognised file", "gz", compress(t, "gz", script), script},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := extract(tt.data, tt.ext, "mytool")
+			if err != nil {
+				t.Fatalf("extractBinary: %v", err)
+			}
+			if !bytes.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtractBinary_MaxSize(t *testing.T) {
+	defer func(old int64) { maxBinarySize = old }(maxBinarySize)
+	maxBinarySize = 10
+
+	exact := makeTarGz(t, map[string][]byte{"mytool": []byte("0123456789")})
+	if _, err := extract(exact, "tar.gz", "mytool"); err != nil {
+		t.Errorf("binary at the limit: %v", err)
+	}
+	tests := []struct {
+		name string
+		data []byte
+		ext  string
+	}{
+		{"tar.gz", makeTarGz(t, map[string][]byte{"mytool": []byte("0123456789A")}), "tar.gz"},
+		{"zip", makeZip(t, map[string][]byte{"mytool": []byte("0123456789A")}), "zip"},
+		{"gz bomb", compress(t, "gz", append([]byte("\x7fELF"), make([]byte, 1<<20)...)), "gz"},
+	}
+	for _, tt := range tests {
+		got, err := extract(tt.data, tt.ext, "mytool")
+		if err == nil || !strings.Contains(err.Error(), "maximum size") {
+			t.Errorf("%s: err = %v, want a maximum size error", tt.name, err)
+		}
+		if len(got) > 11 {
+			t.Errorf("%s: wrote %d bytes past the limit", tt.name, len(got))
+		}
+	}
+}
+
+// makeTarEntries builds a tar from headers in order, compressed with
+// compression ("" for none, otherwise as in compress). Regular files hold
+// "content of <name>"; a zero type flag means a regular file and a zero mode
+// means 0o755.
+func makeTarEntries(t *testing.T, compression string, hdrs ...tar.Header) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, hdr := range hdrs {
+		if hdr.Typeflag == 0 {
+			hdr.Typeflag = tar.TypeReg
+		}
+		if hdr.Mode == 0 {
+			hdr.Mode = 0o755
+		}
+		body := "content of " + hdr.Name
+		if hdr.Typeflag == tar.TypeReg {
+			hdr.Size = int64(len(body))
+		}
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatalf("tar WriteHeader: %v", err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(body)); err != nil {
+				t.Fatalf("tar Write: %v", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("tar Close: %v", err)
+	}
+	if compression == "" {
+		return buf.Bytes()
+	}
+	return compress(t, compression, buf.Bytes())
+}
+
+// compress returns data compressed with format: "gz", "xz" or "zst".
+func compress(t *testing.T, format string, data []byte) []byte {
+	t.Helper()
+	var (
+		buf bytes.Buffer
+		w   io.WriteCloser
+		err error
+	)
+	switch format {
+	case "gz":
+		w = gzip.NewWriter(&buf)
+	case "xz":
+		w, err = xz.NewWriter(&buf)
+	case "zst":
+		w, err = zstd.NewWriter(&buf)
+	default:
+		t.Fatalf("compress: unknown format %q", format)
+	}
+	if err != nil {
+		t.Fatalf("%s writer: %v", format, err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatalf("%s Write: %v", format, err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("%s Close: %v", format, err)
+	}
+	return buf.Bytes()
+}
+
+func TestExtractBinary_Ambiguous(t *testing.T) {
+	tarData := makeTarEntries(t, "",
+		tar.Header{Name: "tool_1.0/docs/examples/tool", Typeflag: tar.TypeReg},
+		tar.Header{Name: "tool_1.0/bin/tool", Typeflag: tar.TypeReg},
+	)
+	zipData := makeZip(t, map[string][]byte{"docs/examples/tool": []byte("x"), "bin/tool": []byte("y")})
+	for ext, data := range map[string][]byte{"tar": tarData, "zip": zipData} {
+		_, err := extract(data, ext, "tool")
+		if !errors.Is(err, errAmbiguousBinary) || !strings.Contains(err.Error(), "bin/tool") || !strings.Contains(err.Error(), "docs/examples/tool") {
+			t.Errorf("%s: err = %v, want an ambiguity error listing both entries", ext, err)
+		}
+	}
+
+	got, err := extract(tarData, "tar", "bin/tool")
+	if err != nil || string(got) != "content of tool_1.0/bin/tool" {
+		t.Errorf("tar with path: got %q, %v", got, err)
+	}
+	got, err = extract(zipData, "zip", "bin/tool")
+	if err != nil || string(got) != "y" {
+		t.Errorf("zip with path: got %q, %v", got, err)
+	}
+}
+
+func TestExtractBinary_PathNotSuffix(t *testing.T) {
+	data := makeTarEntries(t, "",
+		tar.Header{Name: "docs/examples/bin/tool"},
+		tar.Header{Name: "bin/tool"},
+	)
+	if _, err := extract(data, "tar", "tool"); err == nil || !strings.Contains(err.Error(), "pass -binary-path") {
+		t.Errorf("bare name: err = %v, want an ambiguity error suggesting -binary-path", err)
+	}
+	got, err := extract(data, "tar", "bin/tool")
+	if err != nil || string(got) != "content of bin/tool" {
+		t.Errorf("bin/tool: got %q, %v", got, err)
+	}
+
+	wrapped := makeTarEntries(t, "",
+		tar.Header{Name: "a/bin/tool"},
+		tar.Header{Name: "b/bin/tool"},
+	)
+	_, err = extract(wrapped, "tar", "bin/tool")
+	if !errors.Is(err, errAmbiguousBinary) || strings.Contains(err.Error(), "pass -binary-path") {
+		t.Errorf("path target: err = %v, want an ambiguity error without the -binary-path hint", err)
+	}
+}
+
+func TestExtractBinary_TarLinks(t *testing.T) {
+	tests := []struct {
+		name string
+		hdrs []tar.Header
+		want string
+	}{
+		{"symlink", []tar.Header{
+			{Name: "tool", Typeflag: tar.TypeSymlink, Linkname: "libexec/tool-1.0"},
+			{Name: "libexec/tool-1.0", Typeflag: tar.TypeReg},
+		}, "content of libexec/tool-1.0"},
+		{"hard link", []tar.Header{
+			{Name: "pkg/tool-1.0", Typeflag: tar.TypeReg},
+			{Name: "pkg/bin/tool", Typeflag: tar.TypeLink, Linkname: "pkg/tool-1.0"},
+		}, "content of pkg/tool-1.0"},
+		{"chain", []tar.Header{
+			{Name: "./real", Typeflag: tar.TypeReg},
+			{Name: "./bin/tool", Typeflag: tar.TypeSymlink, Linkname: "../alias"},
+			{Name: "./alias", Typeflag: tar.TypeLink, Linkname: "./real"},
+		}, "content of ./real"},
+		// A symlink to the binary that also matches is the same file.
+		{"symlink and target", []tar.Header{
+			{Name: "bin/tool", Typeflag: tar.TypeReg},
+			{Name: "tool", Typeflag: tar.TypeSymlink, Linkname: "bin/tool"},
+		}, "content of bin/tool"},
+	}
+	for _, tt := range tests {
+		got, err := extract(makeTarEntries(t, "", tt.hdrs...), "tar", "tool")
+		if err != nil || string(got) != tt.want {
+			t.Errorf("%s: got %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+
+	for name, link := range map[string]tar.Header{
+		"absolute": {Name: "tool", Typeflag: tar.TypeSymlink, Linkname: "/usr/bin/tool"},
+		"dangling": {Name: "tool", Typeflag: tar.TypeSymlink, Linkname: "missing"},
+		"loop":     {Name: "tool", Typeflag: tar.TypeSymlink, Linkname: "tool"},
+	} {
+		if _, err := extract(makeTarEntries(t, "", link), "tar", "tool"); err == nil {
+			t.Errorf("%s symlink: expected error", name)
+		}
+	}
+}
+
+func TestListExecutables_SkipsHardLinks(t *testing.T) {
+	data := makeTarEntries(t, "",
+		tar.Header{Name: "tool", Typeflag: tar.TypeReg},
+		tar.Header{Name: "tool-alias", Typeflag: tar.TypeLink, Linkname: "tool"},
+	)
+	got, err := listExecutables(sectionOf(data), "tar")
+	if err != nil || !reflect.DeepEqual(got, []string{"tool"}) {
+		t.Errorf("got %v, %v; want [tool]", got, err)
+	}
+}
@@ -0,0 +1,120 @@
+// assetpattern.go — asset matching by a user-supplied regular expression
+// (-asset-pattern).
+//
+// The pattern is matched against every release asset name. Its named groups
+// say where the platform is:
+//
+//	os       required; any spelling in osAliases, e.g. linux, macOS, win
+//	arch     required; any spelling in archAliases, e.g. amd64, x86_64
+//	arm      optional; GOARM for 32-bit ARM, e.g. 7
+//	version  optional; the asset is skipped unless it equals the release version
+//	ext      optional; the archive format, otherwise taken from the name
+//	binary   optional; the binary name inside the archive, otherwise -binary-name
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// compileAssetPattern compiles an -asset-pattern and checks that it has the
+// required os and arch groups.
+func compileAssetPattern(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("-asset-pattern: %w", err)
+	}
+	for _, group := range []string{"os", "arch"} {
+		if re.SubexpIndex(group) < 0 {
+			return nil, fmt.Errorf("-asset-pattern: missing named group (?P<%s>...)", group)
+		}
+	}
+	return re, nil
+}
+
+// resolveAssetsByPattern matches every asset name against re and maps the
+// captured os/arch onto knownPlatforms. When several assets map to the same
+// platform, the first by name wins.
+func resolveAssetsByPattern(assets []ghAsset, re *regexp.Regexp, binaryName, version string, wantPlatforms []string) []assetEntry {
+	wanted := buildWantedSet(wantPlatforms)
+
+	sorted := append([]ghAsset(nil), assets...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+
+	group := func(m []string, name string) string {
+		if i := re.SubexpIndex(name); i >= 0 {
+			return m[i]
+		}
+		return ""
+	}
+
+	byPlatform := map[string]assetEntry{}
+	for _, a := range sorted {
+		m := re.FindStringSubmatch(a.Name)
+		if m == nil {
+			continue
+		}
+		if v := group(m, "version"); v != "" && strings.TrimPrefix(v, "v") != version {
+			slog.Debug("asset pattern matched another version, skipping", "asset", a.Name, "version", v)
+			continue
+		}
+
+		spec := group(m, "os") + "_" + group(m, "arch")
+		if arm := group(m, "arm"); arm != "" {
+			spec += "_" + arm
+		}
+		platKey, ok := canonicalPlatformKey(spec)
+		if !ok {
+			slog.Debug("asset pattern matched an unknown platform, skipping", "asset", a.Name, "platform", spec)
+			continue
+		}
+		if !wanted[platKey] {
+			continue
+		}
+		if prev, dup := byPlatform[platKey]; dup {
+			slog.Debug("several assets match platform, using first", "platform", platKey, "asset", prev.AssetName, "ignored", a.Name)
+			continue
+		}
+
+		def := knownPlatforms[platKey]
+		// The ext group may use a GoReleaser format name (tgz, binary) or a
+		// plain suffix; one neither recognises keeps the asset name's.
+		ext := detectArchiveExt(a.Name)
+		if e := group(m, "ext"); e != "" {
+			if fe := grFormatExt(e); fe != "" {
+				ext = fe
+			} else if de := detectArchiveExt("x." + e); de != "" {
+				ext = de
+			}
+		}
+		if ext == "" {
+			ext = def.archiveExt
+		}
+		bin := binaryName
+		if b := group(m, "binary"); b != "" {
+			bin = b
+		}
+		byPlatform[platKey] = assetEntry{
+			PlatformKey: platKey,
+			WheelTag:    def.wheelTag,
+			ArchiveExt:  ext,
+			BinaryInArc: def.binaryInArchive(bin),
+			AssetName:   a.Name,
+			URL:         a.BrowserDownloadURL,
+			APIURL:      a.URL,
+			AssetID:     a.ID,
+			Digest:      a.Digest,
+		}
+	}
+
+	var result []assetEntry
+	for _, k := range platformKeys() {
+		if e, ok := byPlatform[k]; ok {
+			result = append(result, e)
+		}
+	}
+	return result
+}
@@ -0,0 +1,85 @@
+// assetpattern_test.go
+package main
+
+import "testing"
+
+func TestCompileAssetPattern(t *testing.T) {
+	if _, err := compileAssetPattern(`^tool-(?P<os>\w+)-(?P<arch>\w+)\.zip$`); err != nil {
+		t.Errorf("valid pattern: %v", err)
+	}
+	for _, bad := range []string{`^tool-(?P<os>\w+)\.zip$`, `(?P<os>[`} {
+		if _, err := compileAssetPattern(bad); err == nil {
+			t.Errorf("compileAssetPattern(%q): expected error", bad)
+		}
+	}
+}
+
+func TestResolveAssetsByPattern(t *testing.T) {
+	re, err := compileAssetPattern(`^mytool-(?P<version>[^-]+)-(?P<os>linux|darwin|windows)-(?P<arch>amd64|arm64|armv?)(?P<arm>\d?)\.(?P<ext>tar\.gz|zip)$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets := assetList(
+		"mytool-2.0.0-linux-amd64.tar.gz",
+		"mytool-2.0.0-linux-arm7.tar.gz",
+		"mytool-2.0.0-darwin-arm64.tar.gz",
+		"mytool-2.0.0-windows-amd64.zip",
+		"mytool-1.9.0-linux-arm64.tar.gz",
+		"mytool-2.0.0-plan9-amd64.tar.gz",
+		"mytool-2.0.0.sha256",
+	)
+	got := resolveAssetsByPattern(assets, re, "mytool", "2.0.0", nil)
+
+	want := map[string]string{
+		"Linux_x86_64":   "mytool-2.0.0-linux-amd64.tar.gz",
+		"Linux_armv7":    "mytool-2.0.0-linux-arm7.tar.gz",
+		"Darwin_arm64":   "mytool-2.0.0-darwin-arm64.tar.gz",
+		"Windows_x86_64": "mytool-2.0.0-windows-amd64.zip",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for _, e := range got {
+		if e.AssetName != want[e.PlatformKey] {
+			t.Errorf("%s: asset = %q, want %q", e.PlatformKey, e.AssetName, want[e.PlatformKey])
+		}
+		if e.PlatformKey == "Windows_x86_64" && (e.ArchiveExt != "zip" || e.BinaryInArc != "mytool.exe") {
+			t.Errorf("windows entry = %+v", e)
+		}
+	}
+}
+
+func TestResolveAssetsByPattern_BinaryGroupAndFilter(t *testing.T) {
+	re, err := compileAssetPattern(`^(?P<binary>[a-z]+)_(?P<os>[A-Za-z]+)_(?P<arch>x86_64|aarch64)\.tar\.gz$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets := assetList("cli_Linux_x86_64.tar.gz", "cli_Linux_aarch64.tar.gz")
+	got := resolveAssetsByPattern(assets, re, "other", "1.0.0", []string{"Linux_arm64"})
+	if len(got) != 1 || got[0].PlatformKey != "Linux_arm64" || got[0].BinaryInArc != "cli" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestResolveAssetsByPattern_ExtGroup(t *testing.T) {
+	re, err := compileAssetPattern(`^tool_(?P<os>linux|darwin)_(?P<arch>amd64|arm64)\.(?P<ext>tar\.bz2|tar\.zst|tbz|tgz)$`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assets := assetList("tool_linux_amd64.tar.bz2", "tool_linux_arm64.tar.zst", "tool_darwin_amd64.tbz", "tool_darwin_arm64.tgz")
+	want := map[string]string{
+		"Linux_x86_64":  "tar.bz2",
+		"Linux_arm64":   "tar.zst",
+		"Darwin_x86_64": "tar.gz", // unknown to both; the platform default
+		"Darwin_arm64":  "tar.gz",
+	}
+	got := resolveAssetsByPattern(assets, re, "tool", "1.0.0", nil)
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for _, e := range got {
+		if e.ArchiveExt != want[e.PlatformKey] {
+			t.Errorf("%s: ext = %q, want %q", e.PlatformKey, e.ArchiveExt, want[e.PlatformKey])
+		}
+	}
+}
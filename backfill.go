@@ -0,0 +1,232 @@
+// backfill.go — building wheels for a range of past releases in one run.
+//
+// -backfill 'v1.0.0..v1.6.3' selects every release between two versions
+// (inclusive; either end may be left open) and -backfill-last N the N newest
+// stable releases. Releases are built oldest first, so that the newest one
+// is also the last uploaded, and versions the target index already has are
+// skipped.
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Backfill result statuses, as reported in the summary.
+const (
+	backfillBuilt    = "built"
+	backfillPartial  = "partial"
+	backfillSkipped  = "skipped"
+	backfillNoAssets = "no-assets"
+	backfillFailed   = "failed"
+)
+
+// backfillResult is the outcome for one release.
+type backfillResult struct {
+	tag       string
+	pyVersion string
+	status    string
+	wheels    int
+	err       error
+}
+
+// backfillConstraint turns a "from..to" range into a version constraint.
+// Partial versions are widened as in -version queries, so "..1.6" includes
+// every 1.6.x release.
+func backfillConstraint(spec string) (constraint, error) {
+	from, to, ok := strings.Cut(spec, "..")
+	if !ok {
+		return nil, fmt.Errorf("invalid -backfill %q: want FROM..TO, e.g. v1.0.0..v1.6.3", spec)
+	}
+	var terms []string
+	if from = strings.TrimSpace(from); from != "" {
+		terms = append(terms, ">="+from)
+	}
+	if to = strings.TrimSpace(to); to != "" {
+		terms = append(terms, "<="+to)
+	}
+	if len(terms) == 0 {
+		return constraint{}, nil
+	}
+	return parseConstraint(strings.Join(terms, ","))
+}
+
+// selectBackfill returns the releases to backfill, oldest first: those
+// within spec when it is set, then the newest last of them when last is
+// positive. Drafts and non-semver tags are ignored, and so are prereleases
+// unless an end of spec is itself a prerelease.
+func selectBackfill(rels []ghRelease, spec string, last int) ([]ghRelease, error) {
+	var c constraint
+	if spec != "" {
+		var err error
+		if c, err = backfillConstraint(spec); err != nil {
+			return nil, err
+		}
+	}
+
+	type candidate struct {
+		rel ghRelease
+		ver semver
+	}
+	var picked []candidate
+	seen := map[string]bool{}
+	for _, rel := range rels {
+		if rel.Draft || seen[rel.TagName] {
+			continue
+		}
+		v, ok := parseSemver(rel.TagName)
+		if !ok {
+			slog.Debug("ignoring non-semver release tag", "tag", rel.TagName)
+			continue
+		}
+		if (v.isPrerelease() || rel.Prerelease) && !c.allowsPrerelease() {
+			continue
+		}
+		if !c.matches(v) {
+			continue
+		}
+		seen[rel.TagName] = true
+		picked = append(picked, candidate{rel, v})
+	}
+
+	sort.Slice(picked, func(i, j int) bool { return picked[i].ver.compare(picked[j].ver) < 0 })
+	if last > 0 && len(picked) > last {
+		picked = picked[len(picked)-last:]
+	}
+	selected := make([]ghRelease, len(picked))
+	for i, p := range picked {
+		selected[i] = p.rel
+	}
+	return selected, nil
+}
+
+// pypiJSONURL derives the JSON API root of the index that uploadURL belongs
+// to: https://upload.pypi.org/legacy/ becomes https://pypi.org/pypi and
+// https://test.pypi.org/legacy/ becomes https://test.pypi.org/pypi.
+func pypiJSONURL(uploadURL string) string {
+	u, err := url.Parse(uploadURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	return fmt.Sprintf("%s://%s/pypi", u.Scheme, strings.TrimPrefix(u.Host, "upload."))
+}
+
+// pypiHasVersion reports whether the index at jsonURL already has version of
+// pkg, using the PyPI JSON API (GET {jsonURL}/{pkg}/{version}/json).
+func pypiHasVersion(jsonURL, pkg, version string) (bool, error) {
+	u := fmt.Sprintf("%s/%s/%s/json", strings.TrimRight(jsonURL, "/"), url.PathEscape(pkg), url.PathEscape(version))
+	slog.Debug("checking index for version", "url", u)
+	resp, err := http.Get(u) //nolint:gosec
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("GET %s: %s", u, resp.Status)
+}
+
+// runBackfill builds every release selected by -backfill/-backfill-last and
+// logs a per-version summary. It fails when any release could not be built.
+func runBackfill(cfg *Config, in buildInputs) error {
+	if cfg.PyVersion != "" {
+		return fmt.Errorf("-py-version cannot be combined with -backfill or -backfill-last")
+	}
+	rels, err := listSourceReleases(cfg)
+	if err != nil {
+		return fmt.Errorf("list releases: %w", err)
+	}
+	selected, err := selectBackfill(rels, cfg.Backfill, cfg.BackfillLast)
+	if err != nil {
+		return err
+	}
+	if len(selected) == 0 {
+		return fmt.Errorf("no releases to backfill (%d releases considered)", len(rels))
+	}
+	slog.Info("backfilling releases", "count", len(selected), "from", selected[0].TagName, "to", selected[len(selected)-1].TagName)
+
+	jsonURL := cfg.PyPIJSONURL
+	if jsonURL == "" {
+		jsonURL = pypiJSONURL(cfg.PyPIURL)
+	}
+
+	var results []backfillResult
+	for _, listed := range selected {
+		results = append(results, backfillRelease(cfg, in, jsonURL, listed))
+	}
+
+	failed := 0
+	slog.Info("backfill summary", "releases", len(results))
+	for _, r := range results {
+		attrs := []any{"tag", r.tag, "py_version", r.pyVersion, "status", r.status, "wheels", r.wheels}
+		if r.err != nil {
+			attrs = append(attrs, "error", r.err)
+		}
+		if r.status == backfillFailed || r.status == backfillPartial {
+			failed++
+			slog.Warn("backfill release", attrs...)
+		} else {
+			slog.Info("backfill release", attrs...)
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("backfill: %d of %d releases failed", failed, len(results))
+	}
+	return nil
+}
+
+// backfillRelease checks one listed release against the index and, when it
+// is missing, resolves and builds it from the assets it was listed with.
+func backfillRelease(cfg *Config, in buildInputs, jsonURL string, listed ghRelease) backfillResult {
+	res := backfillResult{tag: listed.TagName}
+	pyVersion, err := normalizeVersion(listed.TagName)
+	if err == nil && cfg.Upload {
+		err = checkUploadVersion(pyVersion)
+	}
+	if err != nil {
+		res.status, res.err = backfillFailed, err
+		return res
+	}
+	res.pyVersion = pyVersion
+	if jsonURL != "" {
+		exists, err := pypiHasVersion(jsonURL, cfg.PackageName, res.pyVersion)
+		switch {
+		case err != nil:
+			slog.Warn("could not check index, building anyway", "tag", res.tag, "error", err)
+		case exists:
+			slog.Info("version already on index, skipping", "tag", res.tag, "py_version", res.pyVersion)
+			res.status = backfillSkipped
+			return res
+		}
+	}
+
+	relCfg := *cfg
+	relCfg.Version = res.tag
+	rel, err := resolveListedRelease(&relCfg, listed)
+	if err != nil {
+		res.status, res.err = backfillFailed, err
+		return res
+	}
+	built, failed := buildRelease(&relCfg, rel, res.pyVersion, in)
+	res.wheels = len(built)
+	switch {
+	case len(rel.Assets) == 0:
+		res.status = backfillNoAssets
+	case failed > 0 && len(built) == 0:
+		res.status = backfillFailed
+	case failed > 0:
+		res.status = backfillPartial
+	default:
+		res.status = backfillBuilt
+	}
+	return res
+}
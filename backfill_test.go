@@ -0,0 +1,169 @@
+// backfill_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSelectBackfill(t *testing.T) {
+	rels := []ghRelease{
+		{TagName: "v2.0.0-rc.1", Prerelease: true},
+		{TagName: "v1.6.3"},
+		{TagName: "v1.6.0"},
+		{TagName: "v1.5.0-beta.1"},
+		{TagName: "v1.5.0", Draft: true},
+		{TagName: "nightly"},
+		{TagName: "v1.2.0"},
+		{TagName: "v1.0.0"},
+		{TagName: "v0.9.0"},
+	}
+	tests := []struct {
+		spec string
+		last int
+		want []string
+	}{
+		{"v1.0.0..v1.6.3", 0, []string{"v1.0.0", "v1.2.0", "v1.6.0", "v1.6.3"}},
+		{"1.2..", 0, []string{"v1.2.0", "v1.6.0", "v1.6.3"}},
+		{"..1.2", 0, []string{"v0.9.0", "v1.0.0", "v1.2.0"}},
+		{"", 3, []string{"v1.2.0", "v1.6.0", "v1.6.3"}},
+		{"v1.0.0..v2.0.0-rc.1", 0, []string{"v1.0.0", "v1.2.0", "v1.5.0-beta.1", "v1.6.0", "v1.6.3", "v2.0.0-rc.1"}},
+		{"v1.0.0..v1.6.3", 2, []string{"v1.6.0", "v1.6.3"}},
+	}
+	for _, tt := range tests {
+		selected, err := selectBackfill(rels, tt.spec, tt.last)
+		if err != nil {
+			t.Errorf("selectBackfill(%q, %d): %v", tt.spec, tt.last, err)
+			continue
+		}
+		got := make([]string, len(selected))
+		for i, rel := range selected {
+			got[i] = rel.TagName
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("selectBackfill(%q, %d) = %v, want %v", tt.spec, tt.last, got, tt.want)
+		}
+	}
+}
+
+func TestSelectBackfill_InvalidRange(t *testing.T) {
+	for _, spec := range []string{"v1.0.0", "v1.0.0..latest"} {
+		if _, err := selectBackfill(nil, spec, 0); err == nil {
+			t.Errorf("selectBackfill(%q): expected error", spec)
+		}
+	}
+}
+
+func TestPyPIJSONURL(t *testing.T) {
+	tests := map[string]string{
+		"https://upload.pypi.org/legacy/": "https://pypi.org/pypi",
+		"https://test.pypi.org/legacy/":   "https://test.pypi.org/pypi",
+		"http://localhost:8080/legacy/":   "http://localhost:8080/pypi",
+		"":                                "",
+	}
+	for in, want := range tests {
+		if got := pypiJSONURL(in); got != want {
+			t.Errorf("pypiJSONURL(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRun_BackfillSkipsPublishedVersions(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	origWait := ghMaxRateLimitWait
+	t.Cleanup(func() { ghMaxRateLimitWait = origWait })
+	var srvURL string
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/repos/owner/tool/releases":
+			var rels []ghRelease
+			for _, tag := range []string{"v1.3.0-rc.1", "v1.2.0", "v1.1.0", "v1.0.0"} {
+				name := "tool_" + strings.TrimPrefix(tag, "v") + "_Linux_x86_64.tar.gz"
+				rels = append(rels, ghRelease{TagName: tag, Assets: []ghAsset{
+					{Name: name, BrowserDownloadURL: srvURL + "/download/" + name},
+				}})
+			}
+			json.NewEncoder(w).Encode(rels)
+		case strings.HasPrefix(r.URL.Path, "/repos/owner/tool/releases/tags/"):
+			t.Errorf("release %s fetched again; backfill should use the listed assets", r.URL.Path)
+			http.NotFound(w, r)
+		case strings.HasPrefix(r.URL.Path, "/download/"):
+			w.Write(makeTarGz(t, map[string][]byte{"tool": []byte("ELF")}))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	srvURL = ghBaseURL
+
+	var checked []string
+	index := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		checked = append(checked, r.URL.Path)
+		if r.URL.Path == "/pypi/tool/1.1.0/json" || r.URL.Path == "/pypi/tool/1.3.0rc1/json" {
+			w.Write([]byte("{}"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer index.Close()
+
+	dir := t.TempDir()
+	license := filepath.Join(dir, "LICENSE")
+	desc := filepath.Join(dir, "README.md")
+	for _, p := range []string{license, desc} {
+		if err := os.WriteFile(p, []byte("x"), 0o644); err != nil {
+			t.Fatalf("write %s: %v", p, err)
+		}
+	}
+	cfg := &Config{
+		Repo:            "owner/tool",
+		BinaryName:      "tool",
+		PackageName:     "tool",
+		EntryPoint:      "tool",
+		Summary:         "tool",
+		LicenseExpr:     "MIT",
+		LicensePath:     license,
+		DescriptionPath: desc,
+		Output:          filepath.Join(dir, "dist"),
+		Platforms:       []string{"Linux_x86_64"},
+		Backfill:        "v1.0.0..v1.3.0-rc.1",
+		PyPIJSONURL:     index.URL + "/pypi",
+	}
+	if err := run(cfg); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	if len(checked) != 4 {
+		t.Errorf("index checked %d times, want once per release: %v", len(checked), checked)
+	}
+	for ver, want := range map[string]bool{"1.0.0": true, "1.1.0": false, "1.2.0": true, "1.3.0rc1": false} {
+		whl := filepath.Join(cfg.Output, "tool-"+ver+"-py3-none-manylinux_2_17_x86_64.whl")
+		if _, err := os.Stat(whl); (err == nil) != want {
+			t.Errorf("wheel for %s exists = %v, want %v", ver, err == nil, want)
+		}
+	}
+}
+
+func TestRunBackfill_ReportsFailures(t *testing.T) {
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/owner/tool/releases" {
+			json.NewEncoder(w).Encode([]ghRelease{{TagName: "v1.0.0", Assets: []ghAsset{{
+				Name:               "tool_1.0.0_Linux_x86_64.tar.gz",
+				BrowserDownloadURL: ghBaseURL + "/missing/tool_1.0.0_Linux_x86_64.tar.gz",
+			}}}})
+			return
+		}
+		http.NotFound(w, r)
+	})
+
+	cfg := &Config{Repo: "owner/tool", BinaryName: "tool", Backfill: "..v1", Output: t.TempDir()}
+	err := runBackfill(cfg, buildInputs{})
+	if err == nil || !strings.Contains(err.Error(), "1 of 1 releases failed") {
+		t.Fatalf("err = %v, want a backfill failure", err)
+	}
+}
@@ -0,0 +1,95 @@
+// binary.go — inspection of extracted executables.
+//
+// Go binaries built with CGO_ENABLED=0 are statically linked and run on any
+// Linux libc, including musl (Alpine). Such binaries are detected here so
+// that their wheels can carry a musllinux tag alongside the manylinux one.
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"encoding/binary"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// hasExecutableMagic reports whether data starts like an executable: ELF,
+// thin or fat Mach-O, or PE ("MZ").
+func hasExecutableMagic(data []byte) bool {
+	if bytes.HasPrefix(data, []byte("\x7fELF")) || bytes.HasPrefix(data, []byte("MZ")) {
+		return true
+	}
+	if len(data) < 4 {
+		return false
+	}
+	switch binary.LittleEndian.Uint32(data) {
+	case macho.Magic32, macho.Magic64:
+		return true
+	}
+	switch binary.BigEndian.Uint32(data) {
+	case macho.Magic32, macho.Magic64, macho.MagicFat:
+		return true
+	}
+	return false
+}
+
+// isStaticELF reports whether r holds an ELF executable with neither an
+// interpreter (PT_INTERP) nor shared library dependencies (DT_NEEDED).
+// Anything that cannot be parsed as ELF is reported as not static.
+func isStaticELF(r io.ReaderAt) bool {
+	f, err := elf.NewFile(r)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	for _, p := range f.Progs {
+		if p.Type == elf.PT_INTERP {
+			return false
+		}
+	}
+	libs, err := f.ImportedLibraries()
+	if err != nil {
+		slog.Debug("could not read ELF dynamic section", "error", err)
+		return false
+	}
+	return len(libs) == 0
+}
+
+// musllinuxTag returns the musllinux tag matching a manylinux wheel tag, e.g.
+// musllinux_1_1_x86_64 for manylinux_2_17_x86_64. ok is false for tags that
+// are not manylinux.
+func musllinuxTag(wheelTag string) (string, bool) {
+	rest, ok := strings.CutPrefix(wheelTag, "manylinux_")
+	if !ok {
+		return "", false
+	}
+	// rest is "{major}_{minor}_{arch}"; arch may itself contain underscores.
+	parts := strings.SplitN(rest, "_", 3)
+	if len(parts) != 3 {
+		return "", false
+	}
+	return "musllinux_1_1_" + parts[2], true
+}
+
+// wheelPlatformTag returns the platform tag of the wheel built from binary
+// for ae. With musllinux set, a statically linked Linux binary gets the
+// compressed tag set "{manylinux}.{musllinux}", so that one wheel installs on
+// both glibc and musl systems; dynamically linked binaries stay glibc-only.
+func wheelPlatformTag(ae assetEntry, binary io.ReaderAt, musllinux bool) string {
+	if !musllinux {
+		return ae.WheelTag
+	}
+	musl, ok := musllinuxTag(ae.WheelTag)
+	if !ok {
+		return ae.WheelTag
+	}
+	if !isStaticELF(binary) {
+		slog.Debug("binary is dynamically linked, not tagging musllinux", "platform", ae.PlatformKey)
+		return ae.WheelTag
+	}
+	slog.Debug("binary is statically linked, adding musllinux tag", "platform", ae.PlatformKey, "tag", musl)
+	return ae.WheelTag + "." + musl
+}
@@ -0,0 +1,97 @@
+// binary_test.go
+package main
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+// makeELF returns a minimal 64-bit little-endian ELF executable with a single
+// PT_LOAD segment, plus a PT_INTERP segment when interp is set.
+func makeELF(t *testing.T, interp bool) []byte {
+	t.Helper()
+	progs := []elf.Prog64{{Type: uint32(elf.PT_LOAD), Flags: uint32(elf.PF_R | elf.PF_X)}}
+	if interp {
+		progs = append(progs, elf.Prog64{Type: uint32(elf.PT_INTERP), Flags: uint32(elf.PF_R)})
+	}
+	hdr := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     64,
+		Ehsize:    64,
+		Phentsize: 56,
+		Phnum:     uint16(len(progs)),
+	}
+	copy(hdr.Ident[:], elf.ELFMAG)
+	hdr.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	hdr.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	hdr.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.LittleEndian, hdr); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range progs {
+		if err := binary.Write(&buf, binary.LittleEndian, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func TestIsStaticELF(t *testing.T) {
+	if !isStaticELF(bytes.NewReader(makeELF(t, false))) {
+		t.Error("ELF without PT_INTERP should be static")
+	}
+	if isStaticELF(bytes.NewReader(makeELF(t, true))) {
+		t.Error("ELF with PT_INTERP should not be static")
+	}
+	if isStaticELF(strings.NewReader("#!/bin/sh\necho hi\n")) {
+		t.Error("non-ELF data should not be static")
+	}
+}
+
+func TestMusllinuxTag(t *testing.T) {
+	tests := map[string]string{
+		"manylinux_2_17_x86_64":  "musllinux_1_1_x86_64",
+		"manylinux_2_17_armv7l":  "musllinux_1_1_armv7l",
+		"manylinux_2_31_riscv64": "musllinux_1_1_riscv64",
+	}
+	for in, want := range tests {
+		if got, ok := musllinuxTag(in); !ok || got != want {
+			t.Errorf("musllinuxTag(%q) = %q, %v, want %q", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"linux_armv6l", "win_amd64", "macosx_11_0_arm64"} {
+		if got, ok := musllinuxTag(in); ok {
+			t.Errorf("musllinuxTag(%q) = %q, want no tag", in, got)
+		}
+	}
+}
+
+func TestWheelPlatformTag(t *testing.T) {
+	linux := assetEntry{PlatformKey: "Linux_x86_64", WheelTag: "manylinux_2_17_x86_64"}
+	static, dynamic := makeELF(t, false), makeELF(t, true)
+
+	tests := []struct {
+		name      string
+		ae        assetEntry
+		bin       []byte
+		musllinux bool
+		want      string
+	}{
+		{"static", linux, static, true, "manylinux_2_17_x86_64.musllinux_1_1_x86_64"},
+		{"dynamic", linux, dynamic, true, "manylinux_2_17_x86_64"},
+		{"disabled", linux, static, false, "manylinux_2_17_x86_64"},
+		{"not linux", assetEntry{WheelTag: "macosx_11_0_arm64"}, static, true, "macosx_11_0_arm64"},
+	}
+	for _, tt := range tests {
+		if got := wheelPlatformTag(tt.ae, bytes.NewReader(tt.bin), tt.musllinux); got != tt.want {
+			t.Errorf("%s: wheelPlatformTag = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,38 +1,97 @@
 // config.go — runtime configuration for the buildwheels tool.
 package main
 
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
 const defaultPyPIURL = "https://upload.pypi.org/legacy/"
 
 // Config holds all runtime configuration, populated from CLI flags.
 // Fields that are empty at parse-time are derived from Repo in main.
 type Config struct {
-	// GitHub source
-	Repo    string // "owner/name"
-	Version string // release tag; "" means latest
+	// Release source
+	Source      string // "github" (default), "gitlab", "gitea" or "oci"
+	Repo        string // "owner/name"; GitLab also accepts "group/subgroup/project"
+	Version     string // release tag or version query; "" means latest
+	GitHubURL   string // GitHub Enterprise Server web root; "" means github.com
+	ForgeURL    string // web root of the selected forge; "" means its public instance
+	FromDir     string // local directory of archives (e.g. GoReleaser dist/); replaces the forge
+	URLTemplate string // download URL template with {version}, {os}, {arch}...; replaces the forge
 
 	// Package identity — derived from Repo/BinaryName when left empty
 	BinaryName  string // binary filename inside archives
+	InferBinary bool   // BinaryName is a default; scan archives that lack it
+	BinaryPath  string // in-archive path of the binary, with -url-template placeholders
 	PackageName string // Python package name
 	EntryPoint  string // console_scripts entry point
 	Summary     string // one-line PyPI description
 	LicenseExpr string // SPDX expression, e.g. "MIT"
 
 	// Build
-	PyVersion  string   // Python package version; mirrors Version when ""
-	Output     string   // output directory for .whl files
-	Platforms  []string // empty = all supported platforms
-	AssetNames []string // explicit asset filenames, overrides auto-detect
+	PyVersion    string         // Python package version; mirrors Version when ""
+	Output       string         // output directory for .whl files
+	Platforms    []string       // empty = all supported platforms
+	PlatformMap  string         // YAML file replacing or extending knownPlatforms
+	AssetNames   []string       // explicit asset filenames, overrides auto-detect
+	AssetPattern *regexp.Regexp // compiled -asset-pattern with os and arch groups; nil when unset
+	Musllinux    bool           // also tag static Linux binaries musllinux
+	Universal2   string         // "add", "only" or "off" ("" = off); see universal.go
+	Include      []string       // archive file globs bundled into the wheel; see include.go
+
+	MaxBinarySize  int64 // largest extracted binary in bytes; 0 = no limit
+	MaxIncludeSize int64 // largest total of -include files in bytes; 0 = no limit
+
+	GoReleaserConfig string   // .goreleaser.yaml path or URL, or "upstream"; computes asset names
+	GoReleaserEnv    []string // environment variables name templates may read as .Env
+
+	// Backfill — build a range of past releases instead of one
+	Backfill     string // "from..to" version range; either end may be empty
+	BackfillLast int    // build the N newest stable releases
 
 	// PyPI upload
-	Upload   bool
-	PyPIURL  string
-	PyPIUser string
+	Upload      bool
+	PyPIURL     string
+	PyPIUser    string
+	PyPIJSONURL string // JSON API root checked by backfill; "" = derived from PyPIURL
 
 	// Input files
-	LicensePath     string // "" = fetch from repo
+	LicensePath     string // "" = next to FromDir, else fetch from repo
 	DescriptionPath string // "" = DESCRIPTION.md
+	ReleaseNotes    bool   // append the upstream release notes to the description
+	ReleaseNotesMax int    // truncate release notes to this many characters; 0 = no limit
 
 	// Cache & logging
-	CacheDir string // "" = disable caching
-	Debug    bool
+	CacheDir      string        // "" = disable caching
+	RateLimitWait time.Duration // longest wait for a GitHub rate limit to reset
+	Debug         bool
+}
+
+// parseByteSize parses a size such as "512M": a non-negative integer with an
+// optional K, M or G suffix (powers of 1024, case-insensitive, optionally
+// followed by "B" or "iB"). "0" means no limit.
+func parseByteSize(s string) (int64, error) {
+	num := strings.ToUpper(strings.TrimSpace(s))
+	num = strings.TrimSuffix(strings.TrimSuffix(num, "B"), "I")
+	shift := 0
+	switch {
+	case strings.HasSuffix(num, "K"):
+		shift = 10
+	case strings.HasSuffix(num, "M"):
+		shift = 20
+	case strings.HasSuffix(num, "G"):
+		shift = 30
+	}
+	if shift > 0 {
+		num = num[:len(num)-1]
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 || n > (1<<63-1)>>shift {
+		return 0, fmt.Errorf("invalid size %q (want e.g. 512M)", s)
+	}
+	return n << shift, nil
 }
@@ -0,0 +1,26 @@
+// config_test.go
+package main
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"0":     0,
+		"1024":  1024,
+		"64K":   64 << 10,
+		"512M":  512 << 20,
+		"512mb": 512 << 20,
+		"2GiB":  2 << 30,
+		" 1G ":  1 << 30,
+	}
+	for in, want := range tests {
+		if got, err := parseByteSize(in); err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "M", "-1", "1T", "1.5G", "99999999999G"} {
+		if _, err := parseByteSize(in); err == nil {
+			t.Errorf("parseByteSize(%q): expected error", in)
+		}
+	}
+}
@@ -1,66 +1,273 @@
-// download.go — HTTP download with optional on-disk caching.
+// download.go — streaming HTTP download to disk with optional caching.
 package main
 
 import (
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 )
 
-// httpGet fetches url and returns the body bytes. It is the single HTTP
-// primitive used by both the downloader and the license fetcher so that
-// tests can rely on a single interception point.
-func httpGet(url string) ([]byte, error) {
-	resp, err := http.Get(url) //nolint:gosec
+// hostCredentials maps a hostname to the Authorization header value sent with
+// plain downloads from it. Forge clients register their hosts so that asset
+// and raw-content downloads reuse the API token; other hosts never see it.
+var hostCredentials = map[string]string{}
+
+// registerCredential records auth as the Authorization header for every
+// download from the host of baseURL.
+func registerCredential(baseURL, auth string) {
+	u, err := url.Parse(baseURL)
+	if err != nil || u.Host == "" {
+		return
+	}
+	hostCredentials[u.Host] = auth
+}
+
+// downloadClient is used for every asset and raw-content download. It follows
+// redirects like http.DefaultClient, but the Authorization header only
+// survives a redirect that stays on the same host; on any other host it is
+// replaced by that host's own registered credential, if any. This keeps forge
+// tokens away from the object storage that asset downloads redirect to.
+var downloadClient = &http.Client{CheckRedirect: reauthorizeRedirect}
+
+// reauthorizeRedirect is the CheckRedirect hook of downloadClient.
+func reauthorizeRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= 10 {
+		return errors.New("stopped after 10 redirects")
+	}
+	if req.URL.Host != via[0].URL.Host {
+		req.Header.Del("Authorization")
+		if auth, ok := hostCredentials[req.URL.Host]; ok {
+			req.Header.Set("Authorization", auth)
+		}
+	}
+	return nil
+}
+
+// httpOpen GETs url and returns the response body, which the caller must
+// close. It is the single HTTP primitive used by both the downloader and the
+// license fetcher so that tests can rely on a single interception point.
+func httpOpen(url string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if auth, ok := hostCredentials[req.URL.Host]; ok {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := downloadClient.Do(req) //nolint:gosec
 	if err != nil {
 		return nil, err
 	}
-	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
 		return nil, fmt.Errorf("GET %s: %s", url, resp.Status)
 	}
-	return io.ReadAll(resp.Body)
+	return resp.Body, nil
+}
+
+// httpGet fetches url and returns the body bytes, for small files such as
+// licenses and configuration.
+func httpGet(url string) ([]byte, error) {
+	body, err := httpOpen(url)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// downloadedFile is a downloaded asset on disk.
+type downloadedFile struct {
+	path string
+	temp bool // a temporary copy, deleted by remove
+}
+
+// open opens the file for reading as a section of known size.
+func (f downloadedFile) open() (*os.File, *io.SectionReader, error) {
+	fh, err := os.Open(f.path)
+	if err != nil {
+		return nil, nil, err
+	}
+	st, err := fh.Stat()
+	if err != nil {
+		fh.Close()
+		return nil, nil, err
+	}
+	return fh, io.NewSectionReader(fh, 0, st.Size()), nil
+}
+
+// remove deletes the file if it is a temporary copy; cached and local files
+// are kept.
+func (f downloadedFile) remove() {
+	if f.temp {
+		os.Remove(f.path)
+	}
+}
+
+// cachedDownload downloads url to disk. When cacheDir is non-empty the file
+// is stored there keyed by its URL basename; subsequent calls with the same
+// cacheDir return the stored copy without hitting the network. Pass
+// cacheDir="" to download to a temporary file instead.
+func cachedDownload(url, cacheDir string) (downloadedFile, error) {
+	return cachedFetch(path.Base(url), cacheDir, func() (io.ReadCloser, error) {
+		slog.Debug("download url", "url", url)
+		return httpOpen(url)
+	})
+}
+
+// downloadAsset fetches the archive for a resolved asset to disk. Local
+// file:// URLs (from -from-dir) are used in place. When a GitHub token is set
+// and the asset has an API URL, it goes through the authenticated asset API
+// so that private repositories work; otherwise the public download URL is
+// used. Downloads are cached under the asset name, since some URLs (OCI
+// blobs) do not end in a usable filename. Assets fetched through the API are
+// keyed on their ID as well: draft assets are often deleted and re-uploaded
+// under the same name, and the new upload must not be served from the cache.
+// An asset with a digest (OCI blobs) is checked against it, local files
+// included, and a mismatching download is discarded before it is cached.
+func downloadAsset(ae assetEntry, cacheDir string) (downloadedFile, error) {
+	if p, ok := strings.CutPrefix(ae.URL, "file://"); ok {
+		slog.Debug("reading local archive", "path", p)
+		f := downloadedFile{path: filepath.FromSlash(p)}
+		if ae.Digest != "" {
+			if err := verifyFileDigest(f.path, ae.Digest); err != nil {
+				return downloadedFile{}, err
+			}
+		}
+		return f, nil
+	}
+	if ae.APIURL != "" && ghForge.token() != "" {
+		return cachedFetch(fmt.Sprintf("%d-%s", ae.AssetID, ae.AssetName), cacheDir, digestFetch(ae.Digest, func() (io.ReadCloser, error) {
+			return ghOpenAsset(ae.APIURL)
+		}))
+	}
+	if ae.AssetName == "" {
+		return cachedDownload(ae.URL, cacheDir)
+	}
+	return cachedFetch(ae.AssetName, cacheDir, digestFetch(ae.Digest, func() (io.ReadCloser, error) {
+		slog.Debug("download url", "url", ae.URL)
+		return httpOpen(ae.URL)
+	}))
 }
 
-// cachedDownload returns the bytes for url. When cacheDir is non-empty the
-// file is stored on disk keyed by its URL basename; subsequent calls with
-// the same cacheDir return the stored copy without hitting the network.
-// Pass cacheDir="" to disable caching entirely.
-func cachedDownload(url, cacheDir string) ([]byte, error) {
-	filename := path.Base(url)
+// digestFetch wraps fetch so that its body is checked against digest while
+// it streams. An empty digest returns fetch unchanged.
+func digestFetch(digest string, fetch func() (io.ReadCloser, error)) func() (io.ReadCloser, error) {
+	if digest == "" {
+		return fetch
+	}
+	return func() (io.ReadCloser, error) {
+		body, err := fetch()
+		if err != nil {
+			return nil, err
+		}
+		r, err := newOCIDigestReader(body, digest)
+		if err != nil {
+			body.Close()
+			return nil, err
+		}
+		return r, nil
+	}
+}
 
+// verifyFileDigest checks the file at path against digest.
+func verifyFileDigest(path, digest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	r, err := newOCIDigestReader(f, digest)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	defer r.Close()
+	if _, err := io.Copy(io.Discard, r); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// cachedFetch implements the caching behind cachedDownload: it returns the
+// cached copy of filename from cacheDir if present, and otherwise streams
+// the body returned by fetch into the cache. The download goes to a
+// temporary file first, so an interrupted one never leaves a truncated cache
+// entry. Pass cacheDir="" to disable caching entirely; the file is then a
+// temporary one. filename comes from release or registry metadata, so one
+// that is not a plain file name is rejected rather than joined to cacheDir.
+func cachedFetch(filename, cacheDir string, fetch func() (io.ReadCloser, error)) (downloadedFile, error) {
 	if cacheDir != "" {
+		if !isPlainFileName(filename) {
+			return downloadedFile{}, fmt.Errorf("unsafe cache file name %q", filename)
+		}
 		if err := os.MkdirAll(cacheDir, 0o755); err != nil {
-			return nil, fmt.Errorf("create cache dir: %w", err)
+			return downloadedFile{}, fmt.Errorf("create cache dir: %w", err)
 		}
 		cachePath := filepath.Join(cacheDir, filename)
 
-		if data, err := os.ReadFile(cachePath); err == nil {
+		if _, err := os.Stat(cachePath); err == nil {
 			slog.Debug("cache hit", "file", filename)
-			return data, nil
+			return downloadedFile{path: cachePath}, nil
 		}
 
-		slog.Info("downloading", "url", url)
-		data, err := httpGet(url)
+		slog.Info("downloading", "file", filename)
+		tmp, err := fetchToTemp(cacheDir, fetch)
 		if err != nil {
-			return nil, err
+			return downloadedFile{}, err
 		}
-
-		if err := os.WriteFile(cachePath, data, 0o644); err != nil {
-			// Non-fatal: warn but still return the data.
+		if err := os.Rename(tmp, cachePath); err != nil {
+			// Non-fatal: warn but still use the download.
 			slog.Warn("cache write failed", "path", cachePath, "error", err)
-		} else {
-			slog.Debug("cached", "path", cachePath)
+			return downloadedFile{path: tmp, temp: true}, nil
 		}
-		return data, nil
+		slog.Debug("cached", "path", cachePath)
+		return downloadedFile{path: cachePath}, nil
+	}
+
+	slog.Info("downloading (no cache)", "file", filename)
+	tmp, err := fetchToTemp("", fetch)
+	if err != nil {
+		return downloadedFile{}, err
+	}
+	return downloadedFile{path: tmp, temp: true}, nil
+}
+
+// isPlainFileName reports whether name can be joined to a directory without
+// leaving it: non-empty, not "." or "..", and free of path separators.
+func isPlainFileName(name string) bool {
+	return name != "" && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+// fetchToTemp streams the body returned by fetch into a new temporary file in
+// dir ("" = the OS temp directory) and returns its path.
+func fetchToTemp(dir string, fetch func() (io.ReadCloser, error)) (string, error) {
+	body, err := fetch()
+	if err != nil {
+		return "", err
 	}
+	defer body.Close()
 
-	slog.Info("downloading (no cache)", "url", url)
-	return httpGet(url)
+	f, err := os.CreateTemp(dir, ".buildwheels-download-*")
+	if err != nil {
+		return "", fmt.Errorf("create temp file: %w", err)
+	}
+	_, err = io.Copy(f, body)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("download: %w", err)
+	}
+	return f.Name(), nil
 }
 
 // defaultCacheDir returns an OS-appropriate user cache directory for this
@@ -2,13 +2,27 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
+// downloadBytes reads the file a download returned, removing it if temporary.
+func downloadBytes(f downloadedFile, err error) ([]byte, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer f.remove()
+	return os.ReadFile(f.path)
+}
+
 func TestCachedDownload_NoCache(t *testing.T) {
 	want := []byte("file content")
 	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -16,7 +30,7 @@ func TestCachedDownload_NoCache(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	got, err := cachedDownload(srv.URL+"/file.bin", "")
+	got, err := downloadBytes(cachedDownload(srv.URL+"/file.bin", ""))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -35,7 +49,7 @@ func TestCachedDownload_CacheMiss_Downloads(t *testing.T) {
 	defer srv.Close()
 
 	cacheDir := t.TempDir()
-	got, err := cachedDownload(srv.URL+"/tool.tar.gz", cacheDir)
+	got, err := downloadBytes(cachedDownload(srv.URL+"/tool.tar.gz", cacheDir))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -55,7 +69,7 @@ func TestCachedDownload_CacheMiss_WritesFile(t *testing.T) {
 	defer srv.Close()
 
 	cacheDir := t.TempDir()
-	_, err := cachedDownload(srv.URL+"/tool.tar.gz", cacheDir)
+	_, err := downloadBytes(cachedDownload(srv.URL+"/tool.tar.gz", cacheDir))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -85,7 +99,7 @@ func TestCachedDownload_CacheHit_NoHTTP(t *testing.T) {
 		t.Fatalf("write pre-seeded cache: %v", err)
 	}
 
-	got, err := cachedDownload(srv.URL+"/tool.tar.gz", cacheDir)
+	got, err := downloadBytes(cachedDownload(srv.URL+"/tool.tar.gz", cacheDir))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -103,7 +117,7 @@ func TestCachedDownload_HTTPError(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	_, err := cachedDownload(srv.URL+"/file.bin", "")
+	_, err := downloadBytes(cachedDownload(srv.URL+"/file.bin", ""))
 	if err == nil {
 		t.Fatal("expected error for HTTP 500, got nil")
 	}
@@ -118,7 +132,7 @@ func TestCachedDownload_CreatesSubdirectory(t *testing.T) {
 
 	// Use a nested cache dir that doesn't exist yet.
 	cacheDir := filepath.Join(t.TempDir(), "nested", "cache")
-	_, err := cachedDownload(srv.URL+"/tool.tar.gz", cacheDir)
+	_, err := downloadBytes(cachedDownload(srv.URL+"/tool.tar.gz", cacheDir))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
@@ -127,3 +141,182 @@ func TestCachedDownload_CreatesSubdirectory(t *testing.T) {
 		t.Errorf("cache directory should have been created: %v", err)
 	}
 }
+
+func TestHTTPGet_RegisteredHostGetsCredential(t *testing.T) {
+	var gotAuth string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAuth = r.Header.Get("Authorization")
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	orig := hostCredentials
+	hostCredentials = map[string]string{}
+	t.Cleanup(func() { hostCredentials = orig })
+
+	if _, err := httpGet(srv.URL + "/a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotAuth != "" {
+		t.Errorf("unregistered host received Authorization %q", gotAuth)
+	}
+
+	registerCredential(srv.URL, "Bearer tok")
+	if _, err := httpGet(srv.URL + "/a"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if gotAuth != "Bearer tok" {
+		t.Errorf("Authorization = %q, want Bearer tok", gotAuth)
+	}
+}
+
+func TestDownloadAsset_TokenUsesAssetAPI(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "secret")
+	want := []byte("private archive")
+
+	var storageAuth string
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storageAuth = r.Header.Get("Authorization")
+		w.Write(want)
+	}))
+	defer storage.Close()
+
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/owner/repo/releases/assets/42" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		if r.Header.Get("Accept") != "application/octet-stream" {
+			http.Error(w, "bad Accept header", http.StatusBadRequest)
+			return
+		}
+		http.Redirect(w, r, storage.URL+"/blob/tool.tar.gz?sig=x", http.StatusFound)
+	}))
+	defer api.Close()
+
+	ae := assetEntry{
+		AssetName: "tool_1.0.0_Linux_x86_64.tar.gz",
+		URL:       "https://example.invalid/should-not-be-used",
+		APIURL:    api.URL + "/repos/owner/repo/releases/assets/42",
+		AssetID:   42,
+	}
+	cacheDir := t.TempDir()
+	got, err := downloadBytes(downloadAsset(ae, cacheDir))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if storageAuth != "" {
+		t.Errorf("token leaked to storage host: Authorization = %q", storageAuth)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, "42-"+ae.AssetName)); err != nil {
+		t.Errorf("expected asset cached under its ID and name: %v", err)
+	}
+}
+
+func TestDownloadAsset_ReuploadedAssetNotServedFromCache(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "secret")
+	uploads := map[string]string{"/assets/42": "first upload", "/assets/43": "second upload"}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := uploads[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	}))
+	defer srv.Close()
+
+	cacheDir := t.TempDir()
+	for id, want := range map[int64]string{42: "first upload", 43: "second upload"} {
+		ae := assetEntry{
+			AssetName: "tool_2.0.0_Linux_x86_64.tar.gz",
+			APIURL:    fmt.Sprintf("%s/assets/%d", srv.URL, id),
+			AssetID:   id,
+		}
+		got, err := downloadBytes(downloadAsset(ae, cacheDir))
+		if err != nil {
+			t.Fatalf("asset %d: %v", id, err)
+		}
+		if string(got) != want {
+			t.Errorf("asset %d = %q, want %q", id, got, want)
+		}
+	}
+}
+
+func TestDownloadAsset_NoTokenUsesBrowserURL(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	want := []byte("public archive")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/download/tool.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(want)
+	}))
+	defer srv.Close()
+
+	ae := assetEntry{
+		AssetName: "tool.tar.gz",
+		URL:       srv.URL + "/download/tool.tar.gz",
+		APIURL:    srv.URL + "/repos/owner/repo/releases/assets/42",
+	}
+	got, err := downloadBytes(downloadAsset(ae, ""))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestCachedFetch_InterruptedDownloadNotCached(t *testing.T) {
+	cacheDir := t.TempDir()
+	fetch := func() (io.ReadCloser, error) {
+		return io.NopCloser(io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errors.New("connection reset")))), nil
+	}
+	if _, err := cachedFetch("tool.tar.gz", cacheDir, fetch); err == nil {
+		t.Fatal("expected error for an interrupted download")
+	}
+	if files, _ := os.ReadDir(cacheDir); len(files) != 0 {
+		t.Errorf("cache dir has %d files after a failed download, want 0", len(files))
+	}
+}
+
+func TestCachedFetch_NoCacheTempRemoved(t *testing.T) {
+	f, err := cachedFetch("tool.tar.gz", "", func() (io.ReadCloser, error) {
+		return io.NopCloser(strings.NewReader("data")), nil
+	})
+	if err != nil {
+		t.Fatalf("cachedFetch: %v", err)
+	}
+	if !f.temp {
+		t.Fatal("download without a cache should be a temporary file")
+	}
+	f.remove()
+	if _, err := os.Stat(f.path); !os.IsNotExist(err) {
+		t.Errorf("temporary download not removed: %v", err)
+	}
+}
+
+func TestCachedFetch_RejectsUnsafeNames(t *testing.T) {
+	cacheDir := filepath.Join(t.TempDir(), "cache")
+	fetch := func() (io.ReadCloser, error) {
+		t.Error("fetch called for an unsafe cache file name")
+		return io.NopCloser(strings.NewReader("data")), nil
+	}
+	for _, name := range []string{"../../x.tar.gz", "a/b.tar.gz", `a\b.zip`, "..", ""} {
+		if _, err := cachedFetch(name, cacheDir, fetch); err == nil {
+			t.Errorf("cachedFetch(%q): expected error", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(cacheDir), "x.tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("file written outside the cache dir: %v", err)
+	}
+}
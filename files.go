@@ -2,14 +2,24 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"log/slog"
 	"os"
+	"path/filepath"
+	"strings"
 )
 
+// licenseNames are the license filenames tried, in order, when no -license
+// path is given.
+var licenseNames = []string{"LICENSE.txt", "LICENSE"}
+
 // resolveLicense returns the license file bytes. When cfg.LicensePath is set
-// it reads from disk; otherwise it tries to fetch LICENSE.txt then LICENSE
-// from the main branch of cfg.Repo.
+// it reads from disk. When building from a local directory it looks for
+// LICENSE.txt then LICENSE in the project root next to it (the parent of
+// dist/). Otherwise it fetches those names from the main branch of cfg.Repo
+// on the selected forge; sources without repository files (a URL template,
+// an OCI registry) need -license.
 func resolveLicense(cfg *Config) ([]byte, error) {
 	if cfg.LicensePath != "" {
 		data, err := os.ReadFile(cfg.LicensePath)
@@ -20,8 +30,25 @@ func resolveLicense(cfg *Config) ([]byte, error) {
 		return data, nil
 	}
 
-	for _, name := range []string{"LICENSE.txt", "LICENSE"} {
-		url := fmt.Sprintf("https://raw.githubusercontent.com/%s/main/%s", cfg.Repo, name)
+	if cfg.FromDir != "" {
+		root := filepath.Dir(filepath.Clean(cfg.FromDir))
+		for _, name := range licenseNames {
+			p := filepath.Join(root, name)
+			if data, err := os.ReadFile(p); err == nil {
+				slog.Info("using license next to -from-dir", "path", p)
+				return data, nil
+			}
+		}
+		if rawFileURL(cfg, "main", licenseNames[0]) == "" {
+			return nil, fmt.Errorf("no LICENSE.txt or LICENSE in %s; pass -license", root)
+		}
+	}
+	if rawFileURL(cfg, "main", licenseNames[0]) == "" {
+		return nil, fmt.Errorf("no repository to fetch the license from; pass -license")
+	}
+
+	for _, name := range licenseNames {
+		url := rawFileURL(cfg, "main", name)
 		slog.Debug("fetching license from repo", "url", url)
 		data, err := httpGet(url)
 		if err == nil {
@@ -46,3 +73,62 @@ func resolveDescription(descPath string) ([]byte, error) {
 	slog.Debug("using description", "path", descPath)
 	return data, nil
 }
+
+// appendReleaseNotes returns desc followed by a "Release notes" section for
+// tag holding notes, or desc unchanged when notes is empty. Headings in the
+// notes are demoted one level so that they nest under the section. When maxLen
+// is positive, longer notes are cut at the last line break within maxLen
+// characters and end with a pointer to pageURL, the full notes, if known.
+func appendReleaseNotes(desc []byte, tag, notes string, maxLen int, pageURL string) []byte {
+	notes = strings.TrimSpace(strings.ReplaceAll(notes, "\r\n", "\n"))
+	if notes == "" {
+		return desc
+	}
+
+	truncated := false
+	if r := []rune(notes); maxLen > 0 && len(r) > maxLen {
+		notes = string(r[:maxLen])
+		if i := strings.LastIndex(notes, "\n"); i > 0 {
+			notes = notes[:i]
+		}
+		notes = strings.TrimSpace(notes)
+		truncated = true
+	}
+
+	var b bytes.Buffer
+	if desc = bytes.TrimRight(desc, "\n"); len(desc) > 0 {
+		b.Write(desc)
+		b.WriteString("\n\n")
+	}
+	fmt.Fprintf(&b, "## Release notes for %s\n\n%s\n", tag, demoteHeadings(notes))
+	if truncated {
+		if pageURL != "" {
+			fmt.Fprintf(&b, "\n*Truncated; see the [full release notes](%s).*\n", pageURL)
+		} else {
+			b.WriteString("\n*Truncated.*\n")
+		}
+	}
+	return b.Bytes()
+}
+
+// demoteHeadings adds a level to every Markdown ATX heading in md outside
+// fenced code blocks, up to the sixth level.
+func demoteHeadings(md string) string {
+	lines := strings.Split(md, "\n")
+	inFence := false
+	for i, line := range lines {
+		trimmed := strings.TrimLeft(line, " ")
+		if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+			inFence = !inFence
+			continue
+		}
+		if inFence || !strings.HasPrefix(line, "#") {
+			continue
+		}
+		level := len(line) - len(strings.TrimLeft(line, "#"))
+		if level < 6 && (len(line) == level || line[level] == ' ') {
+			lines[i] = "#" + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
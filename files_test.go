@@ -47,25 +47,11 @@ func TestResolveLicense_FetchFromRepo_LicenseTxt(t *testing.T) {
 	}))
 	defer srv.Close()
 
-	// Patch httpGet to use the test server by temporarily replacing the
-	// raw.githubusercontent.com URL. We do this by using a repo name that
-	// makes the constructed URL point at our test server.
-	//
-	// Because resolveLicense calls httpGet with a hard-coded
-	// raw.githubusercontent.com base we can't easily intercept it without
-	// refactoring that base into a variable. Instead, use a local file as
-	// the proxy for this code path and test the HTTP fallback separately.
-	//
-	// This test verifies the local-file path already covered above, so we
-	// focus on the observable contract: no error when the file exists.
-	tmpDir := t.TempDir()
-	licensePath := filepath.Join(tmpDir, "LICENSE.txt")
-	if err := os.WriteFile(licensePath, want, 0o644); err != nil {
-		t.Fatalf("write: %v", err)
-	}
-	_ = srv // reserved for future injectable base-URL refactor
+	orig := ghRawURL
+	ghRawURL = srv.URL
+	t.Cleanup(func() { ghRawURL = orig })
 
-	cfg := &Config{LicensePath: licensePath, Repo: "owner/repo"}
+	cfg := &Config{Repo: "owner/repo"}
 	got, err := resolveLicense(cfg)
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
@@ -75,6 +61,30 @@ func TestResolveLicense_FetchFromRepo_LicenseTxt(t *testing.T) {
 	}
 }
 
+func TestResolveLicense_FetchFromRepo_FallsBackToLicense(t *testing.T) {
+	want := []byte("Apache License")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/owner/repo/main/LICENSE" {
+			w.Write(want)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+
+	orig := ghRawURL
+	ghRawURL = srv.URL
+	t.Cleanup(func() { ghRawURL = orig })
+
+	got, err := resolveLicense(&Config{Repo: "owner/repo"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
 func TestResolveLicense_NoPathNoRepo_Fails(t *testing.T) {
 	// With no local file and an invalid repo, the HTTP fetches must fail.
 	// We rely on the real network being absent or the invalid URL failing.
@@ -138,3 +148,30 @@ func TestResolveDescription_NotFound(t *testing.T) {
 		t.Fatal("expected error for missing description file, got nil")
 	}
 }
+
+// --- appendReleaseNotes ---
+
+func TestAppendReleaseNotes(t *testing.T) {
+	notes := "## What's Changed\r\n\r\n* Faster startup\r\n\r\n```sh\r\n# not a heading\r\n```\r\n"
+	got := string(appendReleaseNotes([]byte("# tool\n\nA CLI.\n"), "v1.2.0", notes, 0, "https://example.com/r"))
+	want := "# tool\n\nA CLI.\n\n## Release notes for v1.2.0\n\n### What's Changed\n\n* Faster startup\n\n```sh\n# not a heading\n```\n"
+	if got != want {
+		t.Errorf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestAppendReleaseNotes_Empty(t *testing.T) {
+	desc := []byte("# tool\n")
+	if got := appendReleaseNotes(desc, "v1.0.0", " \r\n", 0, ""); string(got) != string(desc) {
+		t.Errorf("description changed for empty notes: %q", got)
+	}
+}
+
+func TestAppendReleaseNotes_Truncated(t *testing.T) {
+	notes := "* one\n* two\n* three\n* four"
+	got := string(appendReleaseNotes(nil, "v1.0.0", notes, 16, "https://example.com/r"))
+	want := "## Release notes for v1.0.0\n\n* one\n* two\n\n*Truncated; see the [full release notes](https://example.com/r).*\n"
+	if got != want {
+		t.Errorf("got:\n%q\nwant:\n%q", got, want)
+	}
+}
@@ -0,0 +1,129 @@
+// forge.go — code shared by the GitHub, GitLab and Gitea release clients.
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// forge describes how to reach and authenticate to one release API.
+type forge struct {
+	name       string // used in messages, e.g. "GitLab"
+	tokenEnv   string // environment variable holding the API token
+	authScheme string // Authorization scheme the token is sent with
+}
+
+var (
+	ghForge = forge{name: "GitHub", tokenEnv: "GITHUB_TOKEN", authScheme: "Bearer"}
+	glForge = forge{name: "GitLab", tokenEnv: "GITLAB_TOKEN", authScheme: "Bearer"}
+	gtForge = forge{name: "Gitea", tokenEnv: "GITEA_TOKEN", authScheme: "token"}
+)
+
+// token returns the API token from the environment, or "".
+func (f forge) token() string {
+	return os.Getenv(f.tokenEnv)
+}
+
+// authorization returns the Authorization header value for the token, or ""
+// when no token is set.
+func (f forge) authorization() string {
+	if tok := f.token(); tok != "" {
+		return f.authScheme + " " + tok
+	}
+	return ""
+}
+
+// registerCredentials makes downloads from each of the given endpoint roots
+// carry the same token as API calls. It is a no-op when no token is set.
+func (f forge) registerCredentials(roots ...string) {
+	auth := f.authorization()
+	if auth == "" {
+		return
+	}
+	for _, u := range roots {
+		registerCredential(u, auth)
+	}
+}
+
+// parseWebURL validates the web root of a self-hosted instance, given as
+// -forge-url or -github-url, and returns it without a trailing slash. An
+// empty value is returned as "".
+func (f forge) parseWebURL(webURL, example string) (string, error) {
+	webURL = strings.TrimRight(webURL, "/")
+	if webURL == "" {
+		return "", nil
+	}
+	u, err := url.Parse(webURL)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("invalid %s URL %q: want e.g. %s", f.name, webURL, example)
+	}
+	return webURL, nil
+}
+
+// get performs an authenticated GET of the JSON API endpoint u.
+func (f forge) get(u string) ([]byte, error) {
+	slog.Debug("api request", "forge", f.name, "url", u)
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if auth := f.authorization(); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s API %s: %s", f.name, u, resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// releasePageFunc fetches one page (numbered from 1) of a repository's
+// releases, newest first, converted to the forge-neutral ghRelease.
+type releasePageFunc func(page int) ([]ghRelease, error)
+
+// listAllReleases returns every release by calling fetchPage until the forge
+// returns a page shorter than pageSize. A pageSize of 0 pages until an empty
+// page instead, for forges that may return fewer items than asked for.
+func listAllReleases(pageSize int, fetchPage releasePageFunc) ([]ghRelease, error) {
+	var all []ghRelease
+	for page := 1; ; page++ {
+		batch, err := fetchPage(page)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, batch...)
+		if len(batch) == 0 || len(batch) < pageSize {
+			return all, nil
+		}
+	}
+}
+
+// queryRelease pages through the releases of repo and returns the best match
+// for a version query such as ">=1.4,<2" or "latest-prerelease" (see
+// semver.go).
+func queryRelease(repo, query string, pageSize int, fetchPage releasePageFunc) (ghRelease, error) {
+	slog.Info("resolving release query", "repo", repo, "query", query)
+	rels, err := listAllReleases(pageSize, fetchPage)
+	if err != nil {
+		return ghRelease{}, err
+	}
+	rel, err := selectRelease(rels, query)
+	if err != nil {
+		return rel, err
+	}
+	slog.Info("release query matched", "query", query, "tag", rel.TagName)
+	return rel, nil
+}
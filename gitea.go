@@ -0,0 +1,126 @@
+// gitea.go — Gitea/Forgejo Releases API client (Codeberg and self-hosted).
+//
+// Gitea releases are mapped onto the ghRelease/ghAsset types used by the
+// rest of the pipeline, so asset resolution works the same for every forge.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+)
+
+// Gitea endpoints. They default to Codeberg, are repointed at another
+// instance by setGiteaURL, and are overridden in tests to point at an
+// httptest server.
+var (
+	gtBaseURL = "https://codeberg.org/api/v1" // REST API root
+	gtWebURL  = "https://codeberg.org"        // web UI root, used for raw content and metadata
+)
+
+// gtPageSize is the number of releases requested per page when listing.
+// 50 is the default maximum of a Gitea instance, but MAX_RESPONSE_ITEMS may
+// be set lower, so short pages do not end a listing; only an empty one does.
+const gtPageSize = 50
+
+// setGiteaURL points the Gitea endpoints at the instance whose web root is
+// webURL. An empty value keeps Codeberg.
+func setGiteaURL(webURL string) error {
+	webURL, err := gtForge.parseWebURL(webURL, "https://codeberg.org")
+	if err != nil || webURL == "" {
+		return err
+	}
+	gtWebURL = webURL
+	gtBaseURL = webURL + "/api/v1"
+	slog.Debug("using Gitea instance", "api", gtBaseURL)
+	return nil
+}
+
+// gtAsset is one attachment of a Gitea release.
+type gtAsset struct {
+	ID                 int64  `json:"id"`
+	Name               string `json:"name"`
+	Size               int64  `json:"size"`
+	UUID               string `json:"uuid"`
+	BrowserDownloadURL string `json:"browser_download_url"`
+}
+
+// gtRelease is the subset of Gitea release metadata we care about.
+type gtRelease struct {
+	TagName    string    `json:"tag_name"`
+	Draft      bool      `json:"draft"`
+	Prerelease bool      `json:"prerelease"`
+	Body       string    `json:"body"` // release notes, Markdown
+	Assets     []gtAsset `json:"assets"`
+}
+
+// toRelease converts r to the forge-neutral ghRelease.
+func (r gtRelease) toRelease() ghRelease {
+	rel := ghRelease{TagName: r.TagName, Draft: r.Draft, Prerelease: r.Prerelease, Body: r.Body}
+	for _, a := range r.Assets {
+		rel.Assets = append(rel.Assets, ghAsset{
+			ID:                 a.ID,
+			Name:               a.Name,
+			BrowserDownloadURL: a.BrowserDownloadURL,
+		})
+	}
+	return rel
+}
+
+// gtGet performs an authenticated GET to the Gitea REST API.
+func gtGet(repo, urlPath string) ([]byte, error) {
+	return gtForge.get(fmt.Sprintf("%s/repos/%s/%s", gtBaseURL, repo, urlPath))
+}
+
+// gtReleasePage returns the page fetcher for the releases of repo.
+func gtReleasePage(repo string) releasePageFunc {
+	return func(page int) ([]ghRelease, error) {
+		data, err := gtGet(repo, fmt.Sprintf("releases?limit=%d&page=%d", gtPageSize, page))
+		if err != nil {
+			return nil, err
+		}
+		var batch []gtRelease
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, fmt.Errorf("decode releases page %d: %w", page, err)
+		}
+		rels := make([]ghRelease, len(batch))
+		for i, r := range batch {
+			rels[i] = r.toRelease()
+		}
+		return rels, nil
+	}
+}
+
+// listGiteaReleases returns every release of repo, newest first.
+func listGiteaReleases(repo string) ([]ghRelease, error) {
+	return listAllReleases(0, gtReleasePage(repo))
+}
+
+// fetchGiteaRelease returns release metadata for the given tag, the latest
+// release when tag is empty, or the best match for a version query.
+func fetchGiteaRelease(repo, tag string) (ghRelease, error) {
+	if isReleaseQuery(tag) {
+		return queryRelease(repo, tag, 0, gtReleasePage(repo))
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if tag == "" {
+		slog.Info("fetching latest release", "repo", repo)
+		data, err = gtGet(repo, "releases/latest")
+	} else {
+		slog.Info("fetching release", "repo", repo, "tag", tag)
+		data, err = gtGet(repo, "releases/tags/"+url.PathEscape(tag))
+	}
+	if err != nil {
+		return ghRelease{}, err
+	}
+	var r gtRelease
+	if err := json.Unmarshal(data, &r); err != nil {
+		return ghRelease{}, err
+	}
+	return r.toRelease(), nil
+}
@@ -0,0 +1,148 @@
+// gitea_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// withMockGitea points gtBaseURL and gtWebURL at a test server for the
+// duration of the test.
+func withMockGitea(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	return withMockServer(t, handler, map[*string]string{&gtBaseURL: "/api/v1", &gtWebURL: ""})
+}
+
+func TestFetchGiteaRelease_Latest(t *testing.T) {
+	want := gtRelease{
+		TagName: "v1.2.3",
+		Assets: []gtAsset{{
+			ID:                 11,
+			Name:               "tool_1.2.3_Linux_x86_64.tar.gz",
+			UUID:               "8f1c",
+			BrowserDownloadURL: "https://codeberg.org/owner/tool/releases/download/v1.2.3/tool_1.2.3_Linux_x86_64.tar.gz",
+		}},
+	}
+	withMockGitea(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/repos/owner/tool/releases/latest" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(want)
+	})
+
+	got, err := fetchGiteaRelease("owner/tool", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.TagName != "v1.2.3" {
+		t.Errorf("TagName = %q, want v1.2.3", got.TagName)
+	}
+	if len(got.Assets) != 1 || got.Assets[0].BrowserDownloadURL != want.Assets[0].BrowserDownloadURL {
+		t.Fatalf("assets = %+v", got.Assets)
+	}
+
+	// The mapped assets feed the GitHub-style resolution unchanged.
+	entries := resolveAssetsByPlatform(got.Assets, "tool", "1.2.3", nil)
+	if len(entries) != 1 || entries[0].PlatformKey != "Linux_x86_64" {
+		t.Errorf("resolveAssetsByPlatform = %+v", entries)
+	}
+}
+
+func TestFetchGiteaRelease_Tagged(t *testing.T) {
+	withMockGitea(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/repos/owner/tool/releases/tags/v2.0.0" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(gtRelease{TagName: "v2.0.0"})
+	})
+
+	got, err := fetchGiteaRelease("owner/tool", "v2.0.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.TagName != "v2.0.0" {
+		t.Errorf("TagName = %q, want v2.0.0", got.TagName)
+	}
+}
+
+func TestFetchGiteaRelease_Query(t *testing.T) {
+	withMockGitea(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/repos/owner/tool/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		if page, _ := strconv.Atoi(r.URL.Query().Get("page")); page != 1 {
+			json.NewEncoder(w).Encode([]gtRelease{})
+			return
+		}
+		json.NewEncoder(w).Encode([]gtRelease{
+			{TagName: "v2.0.0-rc.1", Prerelease: true},
+			{TagName: "v1.9.0"},
+			{TagName: "v1.8.0"},
+		})
+	})
+
+	got, err := fetchGiteaRelease("owner/tool", "latest-stable")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.TagName != "v1.9.0" {
+		t.Errorf("TagName = %q, want v1.9.0", got.TagName)
+	}
+}
+
+func TestListGiteaReleases_ShortPages(t *testing.T) {
+	// An instance with MAX_RESPONSE_ITEMS=2 returns two releases per page
+	// whatever limit is asked for.
+	tags := []string{"v1.4.0", "v1.3.0", "v1.2.0", "v1.1.0", "v1.0.0"}
+	withMockGitea(t, func(w http.ResponseWriter, r *http.Request) {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		batch := []gtRelease{}
+		for i := (page - 1) * 2; i < page*2 && i < len(tags); i++ {
+			batch = append(batch, gtRelease{TagName: tags[i]})
+		}
+		json.NewEncoder(w).Encode(batch)
+	})
+
+	rels, err := listGiteaReleases("owner/tool")
+	if err != nil {
+		t.Fatalf("listGiteaReleases: %v", err)
+	}
+	if len(rels) != len(tags) {
+		t.Fatalf("got %d releases, want %d", len(rels), len(tags))
+	}
+	got, err := fetchGiteaRelease("owner/tool", "<1.1")
+	if err != nil || got.TagName != "v1.0.0" {
+		t.Errorf("query <1.1 = %q, %v; want v1.0.0", got.TagName, err)
+	}
+}
+
+func TestFetchGiteaRelease_Token(t *testing.T) {
+	t.Setenv("GITEA_TOKEN", "secret")
+	withMockGitea(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "token secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(gtRelease{TagName: "v1.0.0"})
+	})
+
+	if _, err := fetchGiteaRelease("owner/tool", "v1.0.0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFetchGiteaRelease_404(t *testing.T) {
+	withMockGitea(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+
+	if _, err := fetchGiteaRelease("owner/tool", "v9.9.9"); err == nil {
+		t.Fatal("expected error for 404 response, got nil")
+	}
+}
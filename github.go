@@ -2,74 +2,345 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
+	"strconv"
+	"time"
 )
 
-// ghBaseURL is the GitHub API root. Overridden in tests to point at an
-// httptest server.
-var ghBaseURL = "https://api.github.com"
+// GitHub endpoints. They default to github.com, are repointed at a GitHub
+// Enterprise Server instance by setGitHubURL, and are overridden in tests to
+// point at an httptest server.
+var (
+	ghBaseURL = "https://api.github.com"            // REST API root
+	ghRawURL  = "https://raw.githubusercontent.com" // raw file content root
+	ghWebURL  = "https://github.com"                // web UI root, used in package metadata
+)
+
+// setGitHubURL points every GitHub endpoint at the instance whose web root is
+// webURL, using the GitHub Enterprise Server layout: the API under /api/v3
+// and raw content under /raw. An empty value or github.com itself keeps the
+// public defaults.
+func setGitHubURL(webURL string) error {
+	webURL, err := ghForge.parseWebURL(webURL, "https://github.example.com")
+	if err != nil || webURL == "" {
+		return err
+	}
+	if u, _ := url.Parse(webURL); u.Host == "github.com" {
+		return nil
+	}
+	ghWebURL = webURL
+	ghBaseURL = webURL + "/api/v3"
+	ghRawURL = webURL + "/raw"
+	slog.Debug("using GitHub Enterprise Server", "api", ghBaseURL, "raw", ghRawURL)
+	return nil
+}
 
 // ghAsset is one file attached to a GitHub release.
 type ghAsset struct {
+	ID                 int64  `json:"id"`
 	Name               string `json:"name"`
+	URL                string `json:"url"` // API endpoint: /repos/{repo}/releases/assets/{id}
 	BrowserDownloadURL string `json:"browser_download_url"`
+	Digest             string `json:"-"` // OCI layer digest the download is checked against
 }
 
 // ghRelease is the subset of GitHub release metadata we care about.
 type ghRelease struct {
-	TagName string    `json:"tag_name"`
-	Assets  []ghAsset `json:"assets"`
+	TagName    string    `json:"tag_name"`
+	Draft      bool      `json:"draft"`
+	Prerelease bool      `json:"prerelease"`
+	Body       string    `json:"body"` // release notes, Markdown
+	Assets     []ghAsset `json:"assets"`
 }
 
+// errGHNotFound is wrapped by ghGet errors for 404 responses.
+var errGHNotFound = errors.New("404 Not Found")
+
+// ghPageSize is the number of releases requested per page when listing.
+// 100 is the maximum the GitHub API allows.
+const ghPageSize = 100
+
 // ghGet performs an authenticated GET to the GitHub REST API.
+//
+// When ghCacheDir is set, 200 responses are stored with their ETag and later
+// requests for the same URL send If-None-Match; a 304 answer is served from
+// the cache and, for authenticated requests, does not count against the rate
+// limit. Rate-limited responses are retried after the advertised wait when it
+// is no longer than ghMaxRateLimitWait, and otherwise fail with the reset time.
 func ghGet(repo, urlPath string) ([]byte, error) {
 	url := fmt.Sprintf("%s/repos/%s/%s", ghBaseURL, repo, urlPath)
-	slog.Debug("github api request", "url", url)
+	cached, hasCached := readGHCache(url)
+
+	for attempt := 0; ; attempt++ {
+		slog.Debug("github api request", "url", url)
+
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/vnd.github+json")
+		if auth := ghForge.authorization(); auth != "" {
+			req.Header.Set("Authorization", auth)
+		}
+		if hasCached && cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusOK:
+			writeGHCache(url, resp.Header.Get("ETag"), body)
+			return body, nil
+		case resp.StatusCode == http.StatusNotModified && hasCached:
+			slog.Debug("github api not modified, using cached response", "url", url)
+			return cached.Body, nil
+		case isRateLimited(resp):
+			wait, reset := rateLimitWait(resp.Header, time.Now())
+			if attempt >= ghMaxRateLimitRetries || wait > ghMaxRateLimitWait {
+				return nil, rateLimitError(url, resp.Status, reset)
+			}
+			slog.Warn("github api rate limited, waiting",
+				"status", resp.Status,
+				"wait", wait.Round(time.Second),
+				"resets_at", reset.Format(time.RFC3339),
+			)
+			sleep(wait)
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, fmt.Errorf("GitHub API %s: %w", url, errGHNotFound)
+		default:
+			return nil, fmt.Errorf("GitHub API %s: %s", url, resp.Status)
+		}
+	}
+}
+
+// --- Rate limiting ---
+
+// ghMaxRateLimitWait is the longest ghGet will sleep for a rate limit to
+// reset before giving up; set from -rate-limit-wait.
+var ghMaxRateLimitWait = time.Minute
+
+// ghMaxRateLimitRetries bounds how often a single request is retried after
+// waiting out a rate limit.
+const ghMaxRateLimitRetries = 3
+
+// sleep is time.Sleep, overridden in tests.
+var sleep = time.Sleep
+
+// isRateLimited reports whether resp is a primary or secondary rate-limit
+// rejection rather than an ordinary permission error.
+func isRateLimited(resp *http.Response) bool {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return false
+	}
+	return resp.Header.Get("Retry-After") != "" ||
+		resp.Header.Get("X-RateLimit-Remaining") == "0" ||
+		resp.StatusCode == http.StatusTooManyRequests
+}
+
+// rateLimitWait returns how long to wait before retrying and the time the
+// limit resets, from Retry-After (secondary limits) or X-RateLimit-Reset
+// (primary limits). Without either header it falls back to one minute.
+func rateLimitWait(h http.Header, now time.Time) (time.Duration, time.Time) {
+	if s := h.Get("Retry-After"); s != "" {
+		if secs, err := strconv.Atoi(s); err == nil {
+			wait := time.Duration(secs) * time.Second
+			return wait, now.Add(wait)
+		}
+	}
+	if s := h.Get("X-RateLimit-Reset"); s != "" {
+		if epoch, err := strconv.ParseInt(s, 10, 64); err == nil {
+			reset := time.Unix(epoch, 0)
+			// One extra second absorbs clock skew between us and GitHub.
+			wait := reset.Sub(now) + time.Second
+			if wait < 0 {
+				wait = 0
+			}
+			return wait, reset
+		}
+	}
+	return time.Minute, now.Add(time.Minute)
+}
+
+// rateLimitError builds the error returned when a rate limit is not waited
+// out, pointing anonymous callers at GITHUB_TOKEN.
+func rateLimitError(url, status string, reset time.Time) error {
+	hint := ""
+	if ghForge.token() == "" {
+		hint = "; set GITHUB_TOKEN to raise the limit"
+	}
+	return fmt.Errorf("GitHub API %s: %s: rate limit exceeded, resets at %s (in %s)%s",
+		url, status, reset.Format(time.RFC3339), time.Until(reset).Round(time.Second), hint)
+}
+
+// --- Conditional request cache ---
+
+// ghCacheDir holds ETag-tagged API responses; "" disables the cache. Set
+// from -cache in run.
+var ghCacheDir string
+
+// ghCacheEntry is the on-disk form of one cached API response.
+type ghCacheEntry struct {
+	URL  string `json:"url"`
+	ETag string `json:"etag"`
+	Body []byte `json:"body"`
+}
+
+// ghCachePath returns the cache file for url, named by its SHA-256 so that
+// query strings are safe to use as keys.
+func ghCachePath(url string) string {
+	sum := sha256.Sum256([]byte(url))
+	return filepath.Join(ghCacheDir, hex.EncodeToString(sum[:])+".json")
+}
 
-	req, err := http.NewRequest(http.MethodGet, url, nil)
+// readGHCache returns the cached response for url, if any.
+func readGHCache(url string) (ghCacheEntry, bool) {
+	var e ghCacheEntry
+	if ghCacheDir == "" {
+		return e, false
+	}
+	data, err := os.ReadFile(ghCachePath(url))
 	if err != nil {
-		return nil, err
+		return e, false
 	}
-	req.Header.Set("Accept", "application/vnd.github+json")
-	if tok := os.Getenv("GITHUB_TOKEN"); tok != "" {
-		req.Header.Set("Authorization", "Bearer "+tok)
+	if err := json.Unmarshal(data, &e); err != nil || e.URL != url {
+		return e, false
 	}
+	return e, true
+}
 
-	resp, err := http.DefaultClient.Do(req)
+// writeGHCache stores body for url under etag. Responses without an ETag
+// are not cached since they cannot be revalidated. Failures are logged and
+// otherwise ignored.
+func writeGHCache(url, etag string, body []byte) {
+	if ghCacheDir == "" || etag == "" {
+		return
+	}
+	data, err := json.Marshal(ghCacheEntry{URL: url, ETag: etag, Body: body})
+	if err == nil {
+		if err = os.MkdirAll(ghCacheDir, 0o755); err == nil {
+			err = os.WriteFile(ghCachePath(url), data, 0o644)
+		}
+	}
 	if err != nil {
-		return nil, err
+		slog.Warn("github api cache write failed", "url", url, "error", err)
 	}
-	defer resp.Body.Close()
+}
 
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("GitHub API %s: %s", url, resp.Status)
+// ghReleasePage returns the page fetcher for the releases of repo.
+func ghReleasePage(repo string) releasePageFunc {
+	return func(page int) ([]ghRelease, error) {
+		data, err := ghGet(repo, fmt.Sprintf("releases?per_page=%d&page=%d", ghPageSize, page))
+		if err != nil {
+			return nil, err
+		}
+		var batch []ghRelease
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, fmt.Errorf("decode releases page %d: %w", page, err)
+		}
+		return batch, nil
 	}
-	return io.ReadAll(resp.Body)
 }
 
-// fetchRelease returns release metadata for the given tag, or the latest
-// published release when tag is empty.
+// listReleases returns every release of repo, newest first.
+func listReleases(repo string) ([]ghRelease, error) {
+	return listAllReleases(ghPageSize, ghReleasePage(repo))
+}
+
+// fetchRelease returns release metadata for the given tag, the latest
+// published release when tag is empty, or the best match for a version query.
+//
+// releases/tags/{tag} does not return drafts, so when it answers 404 and a
+// token is set (drafts are only visible to users with push access) the
+// release list is searched for a draft with that tag.
 func fetchRelease(repo, tag string) (ghRelease, error) {
+	if isReleaseQuery(tag) {
+		return queryRelease(repo, tag, ghPageSize, ghReleasePage(repo))
+	}
+
 	var (
 		rel  ghRelease
 		data []byte
 		err  error
 	)
-
 	if tag == "" {
 		slog.Info("fetching latest release", "repo", repo)
 		data, err = ghGet(repo, "releases/latest")
 	} else {
 		slog.Info("fetching release", "repo", repo, "tag", tag)
 		data, err = ghGet(repo, "releases/tags/"+tag)
+		if errors.Is(err, errGHNotFound) && ghForge.token() != "" {
+			return findDraftRelease(repo, tag, err)
+		}
 	}
 	if err != nil {
 		return rel, err
 	}
 	return rel, json.Unmarshal(data, &rel)
 }
+
+// findDraftRelease looks through the release list for a draft tagged tag,
+// returning notFound when there is none. The assets of a draft have no
+// working browser_download_url; they are downloaded through the asset API,
+// which downloadAsset uses whenever a token is set.
+func findDraftRelease(repo, tag string, notFound error) (ghRelease, error) {
+	slog.Debug("release not published, looking for a draft", "repo", repo, "tag", tag)
+	rels, err := listReleases(repo)
+	if err != nil {
+		return ghRelease{}, err
+	}
+	for _, rel := range rels {
+		if rel.Draft && rel.TagName == tag {
+			slog.Info("using draft release", "repo", repo, "tag", tag, "assets", len(rel.Assets))
+			return rel, nil
+		}
+	}
+	return ghRelease{}, notFound
+}
+
+// ghOpenAsset opens a release asset through the authenticated asset API
+// (GET /repos/{repo}/releases/assets/{id} with Accept: application/octet-stream)
+// and returns its body, which the caller must close. Unlike
+// browser_download_url this works for private repositories. GitHub answers
+// with a redirect to a storage host; downloadClient drops the token before
+// following it.
+func ghOpenAsset(apiURL string) (io.ReadCloser, error) {
+	slog.Debug("github asset request", "url", apiURL)
+
+	req, err := http.NewRequest(http.MethodGet, apiURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/octet-stream")
+	if auth := ghForge.authorization(); auth != "" {
+		req.Header.Set("Authorization", auth)
+	}
+
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GitHub asset %s: %s", apiURL, resp.Status)
+	}
+	return resp.Body, nil
+}
@@ -3,20 +3,36 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
-// withMockGitHub starts a test HTTP server, points ghBaseURL at it for the
-// duration of the test, and restores the original value on cleanup.
-func withMockGitHub(t *testing.T, handler http.HandlerFunc) {
+// withMockServer starts a test HTTP server and, for the duration of the
+// test, points each endpoint variable in endpoints at the server URL followed
+// by the given path, restoring the original values on cleanup.
+func withMockServer(t *testing.T, handler http.HandlerFunc, endpoints map[*string]string) *httptest.Server {
 	t.Helper()
 	srv := httptest.NewServer(handler)
 	t.Cleanup(func() { srv.Close() })
-	orig := ghBaseURL
-	ghBaseURL = srv.URL
-	t.Cleanup(func() { ghBaseURL = orig })
+	for ptr, path := range endpoints {
+		orig := *ptr
+		*ptr = srv.URL + path
+		t.Cleanup(func() { *ptr = orig })
+	}
+	return srv
+}
+
+// withMockGitHub points ghBaseURL at a test server for the duration of the
+// test.
+func withMockGitHub(t *testing.T, handler http.HandlerFunc) {
+	t.Helper()
+	withMockServer(t, handler, map[*string]string{&ghBaseURL: ""})
 }
 
 func TestFetchRelease_Latest(t *testing.T) {
@@ -135,3 +151,326 @@ func TestFetchRelease_MultipleAssets(t *testing.T) {
 		t.Errorf("expected 3 assets, got %d", len(got.Assets))
 	}
 }
+
+func TestFetchRelease_Query(t *testing.T) {
+	// Two full pages followed by a short one, to exercise pagination.
+	var tags []string
+	for i := 0; i < 2*ghPageSize; i++ {
+		tags = append(tags, fmt.Sprintf("v1.%d.0", i))
+	}
+	tags = append(tags, "v2.0.0", "v2.1.0-rc.1")
+
+	pages := 0
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/repos/owner/repo/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		pages++
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		start := (page - 1) * ghPageSize
+		end := start + ghPageSize
+		if end > len(tags) {
+			end = len(tags)
+		}
+		batch := []ghRelease{}
+		for _, tag := range tags[start:end] {
+			batch = append(batch, ghRelease{TagName: tag})
+		}
+		json.NewEncoder(w).Encode(batch)
+	})
+
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{">=1.4,<2", "v1.199.0"},
+		{"latest-stable", "v2.0.0"},
+		{"latest-prerelease", "v2.1.0-rc.1"},
+	}
+	for _, tt := range tests {
+		pages = 0
+		got, err := fetchRelease("owner/repo", tt.query)
+		if err != nil {
+			t.Fatalf("fetchRelease(%q): %v", tt.query, err)
+		}
+		if got.TagName != tt.want {
+			t.Errorf("fetchRelease(%q) = %s, want %s", tt.query, got.TagName, tt.want)
+		}
+		if pages != 3 {
+			t.Errorf("fetchRelease(%q) requested %d pages, want 3", tt.query, pages)
+		}
+	}
+}
+
+func TestFetchRelease_QueryNoMatch(t *testing.T) {
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode([]ghRelease{{TagName: "v1.0.0"}})
+	})
+
+	if _, err := fetchRelease("owner/repo", ">=2"); err == nil {
+		t.Fatal("expected error when no release matches, got nil")
+	}
+}
+
+func TestSetGitHubURL_Enterprise(t *testing.T) {
+	origBase, origRaw, origWeb := ghBaseURL, ghRawURL, ghWebURL
+	t.Cleanup(func() { ghBaseURL, ghRawURL, ghWebURL = origBase, origRaw, origWeb })
+
+	if err := setGitHubURL("https://github.example.com/"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if ghBaseURL != "https://github.example.com/api/v3" {
+		t.Errorf("ghBaseURL = %q", ghBaseURL)
+	}
+	if ghRawURL != "https://github.example.com/raw" {
+		t.Errorf("ghRawURL = %q", ghRawURL)
+	}
+	if ghWebURL != "https://github.example.com" {
+		t.Errorf("ghWebURL = %q", ghWebURL)
+	}
+}
+
+func TestSetGitHubURL_PublicKeepsDefaults(t *testing.T) {
+	origBase, origRaw, origWeb := ghBaseURL, ghRawURL, ghWebURL
+	t.Cleanup(func() { ghBaseURL, ghRawURL, ghWebURL = origBase, origRaw, origWeb })
+
+	for _, u := range []string{"", "https://github.com"} {
+		if err := setGitHubURL(u); err != nil {
+			t.Fatalf("setGitHubURL(%q): %v", u, err)
+		}
+		if ghBaseURL != origBase || ghRawURL != origRaw || ghWebURL != origWeb {
+			t.Errorf("setGitHubURL(%q) changed the public endpoints", u)
+		}
+	}
+}
+
+func TestSetGitHubURL_Invalid(t *testing.T) {
+	if err := setGitHubURL("github.example.com"); err == nil {
+		t.Fatal("expected error for URL without scheme, got nil")
+	}
+}
+
+func TestRegisterCredentials_GitHub(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "secret")
+	orig := hostCredentials
+	hostCredentials = map[string]string{}
+	t.Cleanup(func() { hostCredentials = orig })
+
+	ghForge.registerCredentials(ghBaseURL, ghRawURL, ghWebURL)
+	for _, host := range []string{"api.github.com", "raw.githubusercontent.com", "github.com"} {
+		if hostCredentials[host] != "Bearer secret" {
+			t.Errorf("credential for %s = %q, want Bearer secret", host, hostCredentials[host])
+		}
+	}
+}
+
+// withNoSleep replaces sleep with a recorder for the duration of the test.
+func withNoSleep(t *testing.T) *[]time.Duration {
+	t.Helper()
+	var slept []time.Duration
+	orig := sleep
+	sleep = func(d time.Duration) { slept = append(slept, d) }
+	t.Cleanup(func() { sleep = orig })
+	return &slept
+}
+
+func TestGHGet_RateLimitWaitsAndRetries(t *testing.T) {
+	slept := withNoSleep(t)
+	calls := 0
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(10*time.Second).Unix(), 10))
+			http.Error(w, "API rate limit exceeded", http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(ghRelease{TagName: "v1.0.0"})
+	})
+
+	got, err := fetchRelease("owner/repo", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.TagName != "v1.0.0" {
+		t.Errorf("TagName = %q, want v1.0.0", got.TagName)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 requests, got %d", calls)
+	}
+	if len(*slept) != 1 || (*slept)[0] <= 0 || (*slept)[0] > 12*time.Second {
+		t.Errorf("unexpected sleeps: %v", *slept)
+	}
+}
+
+func TestGHGet_RetryAfter(t *testing.T) {
+	slept := withNoSleep(t)
+	calls := 0
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.Header().Set("Retry-After", "5")
+			http.Error(w, "secondary rate limit", http.StatusTooManyRequests)
+			return
+		}
+		json.NewEncoder(w).Encode(ghRelease{TagName: "v1.0.0"})
+	})
+
+	if _, err := fetchRelease("owner/repo", ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(*slept) != 1 || (*slept)[0] != 5*time.Second {
+		t.Errorf("sleeps = %v, want [5s]", *slept)
+	}
+}
+
+func TestGHGet_RateLimitResetTooFar(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	slept := withNoSleep(t)
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-RateLimit-Remaining", "0")
+		w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+		http.Error(w, "API rate limit exceeded", http.StatusForbidden)
+	})
+
+	_, err := fetchRelease("owner/repo", "")
+	if err == nil {
+		t.Fatal("expected rate limit error, got nil")
+	}
+	for _, want := range []string{"rate limit exceeded", "resets at", "GITHUB_TOKEN"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should mention %q", err, want)
+		}
+	}
+	if len(*slept) != 0 {
+		t.Errorf("should not wait for a distant reset, slept %v", *slept)
+	}
+}
+
+func TestGHGet_ForbiddenWithoutRateLimitIsNotRetried(t *testing.T) {
+	withNoSleep(t)
+	calls := 0
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("X-RateLimit-Remaining", "4999")
+		http.Error(w, "forbidden", http.StatusForbidden)
+	})
+
+	if _, err := fetchRelease("owner/repo", ""); err == nil {
+		t.Fatal("expected error for 403, got nil")
+	}
+	if calls != 1 {
+		t.Errorf("expected 1 request, got %d", calls)
+	}
+}
+
+func TestGHGet_ConditionalRequest(t *testing.T) {
+	orig := ghCacheDir
+	ghCacheDir = t.TempDir()
+	t.Cleanup(func() { ghCacheDir = orig })
+
+	calls := 0
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if calls > 1 {
+			t.Errorf("request %d did not send If-None-Match", calls)
+		}
+		w.Header().Set("ETag", `"v1"`)
+		json.NewEncoder(w).Encode(ghRelease{TagName: "v1.2.3"})
+	})
+
+	for i := 0; i < 2; i++ {
+		got, err := fetchRelease("owner/repo", "")
+		if err != nil {
+			t.Fatalf("request %d: unexpected error: %v", i+1, err)
+		}
+		if got.TagName != "v1.2.3" {
+			t.Errorf("request %d: TagName = %q, want v1.2.3", i+1, got.TagName)
+		}
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 requests, got %d", calls)
+	}
+}
+
+func TestGHGet_NotModifiedWithoutCacheIsError(t *testing.T) {
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotModified)
+	})
+
+	if _, err := fetchRelease("owner/repo", ""); err == nil {
+		t.Fatal("expected error for unsolicited 304, got nil")
+	}
+}
+
+func TestFetchRelease_DraftFoundWithToken(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "secret")
+	var srvURL string
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/owner/repo/releases/tags/v2.0.0":
+			http.NotFound(w, r)
+		case "/repos/owner/repo/releases":
+			json.NewEncoder(w).Encode([]ghRelease{
+				{TagName: "v2.0.0", Draft: true, Assets: []ghAsset{{
+					ID:                 7,
+					Name:               "tool_2.0.0_Linux_x86_64.tar.gz",
+					URL:                srvURL + "/repos/owner/repo/releases/assets/7",
+					BrowserDownloadURL: "https://github.com/owner/repo/releases/download/untagged-abc/tool_2.0.0_Linux_x86_64.tar.gz",
+				}}},
+				{TagName: "v1.0.0"},
+			})
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	srvURL = ghBaseURL
+
+	rel, err := fetchRelease("owner/repo", "v2.0.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !rel.Draft || rel.TagName != "v2.0.0" {
+		t.Errorf("release = %+v, want the v2.0.0 draft", rel)
+	}
+
+	entries := resolveAssetsByPlatform(rel.Assets, "tool", "2.0.0", nil)
+	if len(entries) != 1 || entries[0].APIURL != srvURL+"/repos/owner/repo/releases/assets/7" {
+		t.Errorf("entries = %+v, want the draft asset with its API URL", entries)
+	}
+}
+
+func TestFetchRelease_DraftNotFound(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "secret")
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/owner/repo/releases" {
+			json.NewEncoder(w).Encode([]ghRelease{{TagName: "v1.0.0"}})
+			return
+		}
+		http.NotFound(w, r)
+	})
+
+	_, err := fetchRelease("owner/repo", "v2.0.0")
+	if !errors.Is(err, errGHNotFound) {
+		t.Fatalf("err = %v, want the original not-found error", err)
+	}
+}
+
+func TestFetchRelease_NoDraftLookupWithoutToken(t *testing.T) {
+	t.Setenv("GITHUB_TOKEN", "")
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/repos/owner/repo/releases" {
+			t.Error("release list requested without a token")
+		}
+		http.NotFound(w, r)
+	})
+
+	if _, err := fetchRelease("owner/repo", "v2.0.0"); err == nil {
+		t.Fatal("expected error for missing release")
+	}
+}
@@ -0,0 +1,141 @@
+// gitlab.go — GitLab Releases API client (gitlab.com and self-managed).
+//
+// GitLab releases are mapped onto the ghRelease/ghAsset types used by the
+// rest of the pipeline, so asset resolution works the same for both forges.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+)
+
+// GitLab endpoints. They default to gitlab.com, are repointed at a
+// self-managed instance by setGitLabURL, and are overridden in tests to point
+// at an httptest server.
+var (
+	glBaseURL = "https://gitlab.com/api/v4" // REST API root
+	glWebURL  = "https://gitlab.com"        // web UI root, used for raw content and metadata
+)
+
+// glPageSize is the number of releases requested per page when listing.
+const glPageSize = 100
+
+// setGitLabURL points the GitLab endpoints at the instance whose web root is
+// webURL. An empty value keeps gitlab.com.
+func setGitLabURL(webURL string) error {
+	webURL, err := glForge.parseWebURL(webURL, "https://gitlab.example.com")
+	if err != nil || webURL == "" {
+		return err
+	}
+	glWebURL = webURL
+	glBaseURL = webURL + "/api/v4"
+	slog.Debug("using GitLab instance", "api", glBaseURL)
+	return nil
+}
+
+// glLink is one entry of a GitLab release's assets.links list.
+type glLink struct {
+	ID             int64  `json:"id"`
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	DirectAssetURL string `json:"direct_asset_url"`
+	LinkType       string `json:"link_type"`
+}
+
+// glRelease is the subset of GitLab release metadata we care about.
+type glRelease struct {
+	TagName     string `json:"tag_name"`
+	Description string `json:"description"` // release notes, Markdown
+	Upcoming    bool   `json:"upcoming_release"`
+	Assets      struct {
+		Links []glLink `json:"links"`
+	} `json:"assets"`
+}
+
+// toRelease converts r to the forge-neutral ghRelease. Upcoming releases
+// (released_at in the future) are reported as drafts.
+//
+// Link names are free text in GitLab, so when a link's name is not an archive
+// filename but its URL is — typical for generic-package links such as
+// .../packages/generic/tool/1.0.0/tool_1.0.0_Linux_x86_64.tar.gz — the URL
+// basename is used as the asset name.
+func (r glRelease) toRelease() ghRelease {
+	rel := ghRelease{TagName: r.TagName, Draft: r.Upcoming, Body: r.Description}
+	for _, l := range r.Assets.Links {
+		dl := l.DirectAssetURL
+		if dl == "" {
+			dl = l.URL
+		}
+		name := l.Name
+		if base := path.Base(l.URL); !isArchiveName(name) && isArchiveName(base) {
+			name = base
+		}
+		rel.Assets = append(rel.Assets, ghAsset{
+			ID:                 l.ID,
+			Name:               name,
+			BrowserDownloadURL: dl,
+		})
+	}
+	return rel
+}
+
+// glGet performs an authenticated GET to the GitLab REST API for project,
+// given as its full path (group/subgroup/project) or numeric ID.
+func glGet(project, urlPath string) ([]byte, error) {
+	return glForge.get(fmt.Sprintf("%s/projects/%s/%s", glBaseURL, url.PathEscape(project), urlPath))
+}
+
+// glReleasePage returns the page fetcher for the releases of project.
+func glReleasePage(project string) releasePageFunc {
+	return func(page int) ([]ghRelease, error) {
+		data, err := glGet(project, fmt.Sprintf("releases?per_page=%d&page=%d", glPageSize, page))
+		if err != nil {
+			return nil, err
+		}
+		var batch []glRelease
+		if err := json.Unmarshal(data, &batch); err != nil {
+			return nil, fmt.Errorf("decode releases page %d: %w", page, err)
+		}
+		rels := make([]ghRelease, len(batch))
+		for i, r := range batch {
+			rels[i] = r.toRelease()
+		}
+		return rels, nil
+	}
+}
+
+// listGitLabReleases returns every release of project, newest first.
+func listGitLabReleases(project string) ([]ghRelease, error) {
+	return listAllReleases(glPageSize, glReleasePage(project))
+}
+
+// fetchGitLabRelease returns release metadata for the given tag, the latest
+// release when tag is empty, or the best match for a version query.
+func fetchGitLabRelease(project, tag string) (ghRelease, error) {
+	if isReleaseQuery(tag) {
+		return queryRelease(project, tag, glPageSize, glReleasePage(project))
+	}
+
+	var (
+		data []byte
+		err  error
+	)
+	if tag == "" {
+		slog.Info("fetching latest release", "project", project)
+		data, err = glGet(project, "releases/permalink/latest")
+	} else {
+		slog.Info("fetching release", "project", project, "tag", tag)
+		data, err = glGet(project, "releases/"+url.PathEscape(tag))
+	}
+	if err != nil {
+		return ghRelease{}, err
+	}
+	var r glRelease
+	if err := json.Unmarshal(data, &r); err != nil {
+		return ghRelease{}, err
+	}
+	return r.toRelease(), nil
+}
@@ -0,0 +1,178 @@
+// gitlab_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+// withMockGitLab points glBaseURL and glWebURL at a test server for the
+// duration of the test.
+func withMockGitLab(t *testing.T, handler http.HandlerFunc) *httptest.Server {
+	t.Helper()
+	return withMockServer(t, handler, map[*string]string{&glBaseURL: "/api/v4", &glWebURL: ""})
+}
+
+// glReleaseJSON builds a GitLab release with one link per name.
+func glReleaseJSON(tag string, links ...glLink) map[string]any {
+	return map[string]any{
+		"tag_name": tag,
+		"assets":   map[string]any{"links": links},
+	}
+}
+
+func TestFetchGitLabRelease_Latest(t *testing.T) {
+	withMockGitLab(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/projects/group%2Fsub%2Ftool/releases/permalink/latest" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(glReleaseJSON("v1.2.3", glLink{
+			ID:             7,
+			Name:           "tool_1.2.3_Linux_x86_64.tar.gz",
+			URL:            "https://example.com/tool_1.2.3_Linux_x86_64.tar.gz",
+			DirectAssetURL: "https://gitlab.example.com/group/sub/tool/-/releases/v1.2.3/downloads/tool_1.2.3_Linux_x86_64.tar.gz",
+		}))
+	})
+
+	got, err := fetchGitLabRelease("group/sub/tool", "")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.TagName != "v1.2.3" {
+		t.Errorf("TagName = %q, want v1.2.3", got.TagName)
+	}
+	if len(got.Assets) != 1 {
+		t.Fatalf("expected 1 asset, got %d", len(got.Assets))
+	}
+	a := got.Assets[0]
+	if a.Name != "tool_1.2.3_Linux_x86_64.tar.gz" {
+		t.Errorf("asset name = %q", a.Name)
+	}
+	if a.BrowserDownloadURL != "https://gitlab.example.com/group/sub/tool/-/releases/v1.2.3/downloads/tool_1.2.3_Linux_x86_64.tar.gz" {
+		t.Errorf("download URL should prefer direct_asset_url, got %q", a.BrowserDownloadURL)
+	}
+}
+
+func TestFetchGitLabRelease_Tagged(t *testing.T) {
+	withMockGitLab(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/projects/owner%2Ftool/releases/v2.0.0" {
+			http.NotFound(w, r)
+			return
+		}
+		rel := glReleaseJSON("v2.0.0")
+		rel["description"] = "## Changes\n\n- faster"
+		json.NewEncoder(w).Encode(rel)
+	})
+
+	got, err := fetchGitLabRelease("owner/tool", "v2.0.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.TagName != "v2.0.0" {
+		t.Errorf("TagName = %q, want v2.0.0", got.TagName)
+	}
+	if got.Body != "## Changes\n\n- faster" {
+		t.Errorf("Body = %q, want the release description", got.Body)
+	}
+}
+
+func TestFetchGitLabRelease_GenericPackageLinks(t *testing.T) {
+	pkgURL := "https://gitlab.com/api/v4/projects/42/packages/generic/tool/1.0.0/tool_1.0.0_Darwin_arm64.tar.gz"
+	withMockGitLab(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(glReleaseJSON("v1.0.0", glLink{
+			Name:     "macOS (Apple Silicon)",
+			URL:      pkgURL,
+			LinkType: "package",
+		}))
+	})
+
+	got, err := fetchGitLabRelease("owner/tool", "v1.0.0")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(got.Assets) != 1 {
+		t.Fatalf("expected 1 asset, got %d", len(got.Assets))
+	}
+	if got.Assets[0].Name != "tool_1.0.0_Darwin_arm64.tar.gz" {
+		t.Errorf("asset name = %q, want URL basename", got.Assets[0].Name)
+	}
+	if got.Assets[0].BrowserDownloadURL != pkgURL {
+		t.Errorf("download URL = %q, want %q", got.Assets[0].BrowserDownloadURL, pkgURL)
+	}
+
+	// The mapped assets feed the GitHub-style resolution unchanged.
+	entries := resolveAssetsByPlatform(got.Assets, "tool", "1.0.0", []string{"Darwin_arm64"})
+	if len(entries) != 1 || entries[0].URL != pkgURL {
+		t.Errorf("resolveAssetsByPlatform = %+v", entries)
+	}
+}
+
+func TestFetchGitLabRelease_Query(t *testing.T) {
+	withMockGitLab(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/projects/owner%2Ftool/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		if page, _ := strconv.Atoi(r.URL.Query().Get("page")); page != 1 {
+			json.NewEncoder(w).Encode([]any{})
+			return
+		}
+		json.NewEncoder(w).Encode([]any{
+			glReleaseJSON("v2.0.0"),
+			glReleaseJSON("v1.5.0"),
+			glReleaseJSON("v1.4.1"),
+		})
+	})
+
+	got, err := fetchGitLabRelease("owner/tool", "~1.4")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got.TagName != "v1.4.1" {
+		t.Errorf("TagName = %q, want v1.4.1", got.TagName)
+	}
+}
+
+func TestFetchGitLabRelease_Token(t *testing.T) {
+	t.Setenv("GITLAB_TOKEN", "glpat-secret")
+	withMockGitLab(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer glpat-secret" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(glReleaseJSON("v1.0.0"))
+	})
+
+	if _, err := fetchGitLabRelease("owner/tool", "v1.0.0"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestFetchGitLabRelease_404(t *testing.T) {
+	withMockGitLab(t, func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message":"404 Not Found"}`, http.StatusNotFound)
+	})
+
+	if _, err := fetchGitLabRelease("owner/tool", "v9.9.9"); err == nil {
+		t.Fatal("expected error for 404 response, got nil")
+	}
+}
+
+func TestSetGitLabURL(t *testing.T) {
+	origBase, origWeb := glBaseURL, glWebURL
+	t.Cleanup(func() { glBaseURL, glWebURL = origBase, origWeb })
+
+	if err := setGitLabURL("https://gitlab.example.com/"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if glBaseURL != "https://gitlab.example.com/api/v4" {
+		t.Errorf("glBaseURL = %q", glBaseURL)
+	}
+	if glWebURL != "https://gitlab.example.com" {
+		t.Errorf("glWebURL = %q", glWebURL)
+	}
+}
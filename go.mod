@@ -1,3 +1,9 @@
 module github.com/neo4j-labs/buildwheels
 
-go 1.21
+go 1.22
+
+require (
+	github.com/klauspost/compress v1.18.0
+	github.com/ulikunitz/xz v0.5.15
+	gopkg.in/yaml.v3 v3.0.1
+)
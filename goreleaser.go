@@ -0,0 +1,385 @@
+// goreleaser.go — asset names computed from the upstream .goreleaser.yaml.
+//
+// Projects with a custom archives.name_template do not follow the two
+// filename patterns resolveAssetsByPlatform tries. Given their GoReleaser
+// configuration (-goreleaser-config), the exact archive name of every
+// platform is computed by evaluating name_template and format_overrides with
+// GoReleaser's template variables and functions.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// goreleaserUpstream is the -goreleaser-config value that fetches the
+// configuration from the upstream repository at the release tag.
+const goreleaserUpstream = "upstream"
+
+// goreleaserConfigNames are the filenames GoReleaser itself looks for, in
+// order.
+var goreleaserConfigNames = []string{".goreleaser.yml", ".goreleaser.yaml", "goreleaser.yml", "goreleaser.yaml"}
+
+// grDefaultNameTemplate is GoReleaser's default archives.name_template.
+const grDefaultNameTemplate = `{{ .ProjectName }}_{{ .Version }}_{{ .Os }}_{{ .Arch }}{{ with .Arm }}v{{ . }}{{ end }}{{ with .Mips }}_{{ . }}{{ end }}{{ if not (eq .Amd64 "v1") }}{{ .Amd64 }}{{ end }}`
+
+// grConfig is the subset of .goreleaser.yaml that determines archive names.
+type grConfig struct {
+	ProjectName string            `yaml:"project_name"`
+	Builds      []grBuild         `yaml:"builds"`
+	Archives    []grArchiveConfig `yaml:"archives"`
+}
+
+// grBuild is one entry of builds.
+type grBuild struct {
+	ID     string `yaml:"id"`
+	Binary string `yaml:"binary"`
+}
+
+// grArchiveConfig is one entry of archives. GoReleaser v1 uses format and
+// v2 formats; both are read.
+type grArchiveConfig struct {
+	ID              string             `yaml:"id"`
+	Builds          []string           `yaml:"builds"`
+	NameTemplate    string             `yaml:"name_template"`
+	Format          string             `yaml:"format"`
+	Formats         []string           `yaml:"formats"`
+	FormatOverrides []grFormatOverride `yaml:"format_overrides"`
+}
+
+// grFormatOverride is one entry of archives.format_overrides.
+type grFormatOverride struct {
+	Goos    string   `yaml:"goos"`
+	Format  string   `yaml:"format"`
+	Formats []string `yaml:"formats"`
+}
+
+// parseGoReleaserConfig decodes a .goreleaser.yaml.
+func parseGoReleaserConfig(data []byte) (*grConfig, error) {
+	var c grConfig
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("parse GoReleaser config: %w", err)
+	}
+	return &c, nil
+}
+
+// loadGoReleaserConfig reads the configuration named by cfg.GoReleaserConfig:
+// a local path, an http(s) URL, or "upstream" for the repository's own file
+// at tag (or, with -from-dir, the file in the project root next to it).
+func loadGoReleaserConfig(cfg *Config, tag string) (*grConfig, error) {
+	src := cfg.GoReleaserConfig
+	switch {
+	case src == goreleaserUpstream && cfg.FromDir != "":
+		root := filepath.Dir(filepath.Clean(cfg.FromDir))
+		for _, name := range goreleaserConfigNames {
+			if data, err := os.ReadFile(filepath.Join(root, name)); err == nil {
+				slog.Info("using GoReleaser config next to -from-dir", "file", name)
+				return parseGoReleaserConfig(data)
+			}
+		}
+		return nil, fmt.Errorf("no GoReleaser config in %s", root)
+	case src == goreleaserUpstream:
+		if rawFileURL(cfg, tag, goreleaserConfigNames[0]) == "" {
+			return nil, fmt.Errorf("-goreleaser-config upstream needs a forge repository; pass a path instead")
+		}
+		for _, name := range goreleaserConfigNames {
+			data, err := httpGet(rawFileURL(cfg, tag, name))
+			if err == nil {
+				slog.Info("fetched GoReleaser config from repo", "file", name, "ref", tag)
+				return parseGoReleaserConfig(data)
+			}
+			slog.Debug("GoReleaser config candidate not found", "file", name, "error", err)
+		}
+		return nil, fmt.Errorf("no GoReleaser config in %s at %s", cfg.Repo, tag)
+	case strings.HasPrefix(src, "https://"), strings.HasPrefix(src, "http://"):
+		data, err := httpGet(src)
+		if err != nil {
+			return nil, err
+		}
+		return parseGoReleaserConfig(data)
+	}
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+	return parseGoReleaserConfig(data)
+}
+
+// grTemplateFuncs are the GoReleaser template functions that name templates
+// commonly use.
+var grTemplateFuncs = template.FuncMap{
+	"title":      grTitle,
+	"tolower":    strings.ToLower,
+	"toupper":    strings.ToUpper,
+	"trim":       strings.TrimSpace,
+	"trimprefix": strings.TrimPrefix,
+	"trimsuffix": strings.TrimSuffix,
+	"replace":    strings.ReplaceAll,
+	"contains":   strings.Contains,
+}
+
+// errGRUnsupportedFunc marks a template that calls a GoReleaser function
+// missing from grTemplateFuncs.
+var errGRUnsupportedFunc = errors.New("unsupported GoReleaser template function")
+
+// grUndefinedFunc extracts the function name from text/template's parse
+// error for an undefined function.
+var grUndefinedFunc = regexp.MustCompile(`function "([^"]+)" not defined`)
+
+// grTitle upper-cases the first letter of every word and lower-cases the
+// rest, like GoReleaser's title function (cases.Title): "LINUX" becomes
+// "Linux" and "x86_64" becomes "X86_64". As in Unicode word segmentation,
+// underscores, apostrophes and dots do not start a new word; spaces,
+// hyphens and other punctuation do.
+func grTitle(s string) string {
+	prev := ' '
+	return strings.Map(func(r rune) rune {
+		defer func() { prev = r }()
+		if unicode.IsLetter(prev) || unicode.IsDigit(prev) || strings.ContainsRune("_'.", prev) {
+			return unicode.ToLower(r)
+		}
+		return unicode.ToTitle(r)
+	}, s)
+}
+
+// grTemplateData returns the template variables for one target.
+func grTemplateData(projectName, tag, binary string, def platformDef) map[string]any {
+	version := strings.TrimPrefix(tag, "v")
+	data := map[string]any{
+		"ProjectName": projectName,
+		"Tag":         tag,
+		"Version":     version,
+		"RawVersion":  version,
+		"Binary":      binary,
+		"Os":          def.goos,
+		"Arch":        def.goarch,
+		"Arm":         def.goarm,
+		"Arm64":       "",
+		"Amd64":       "",
+		"Mips":        "",
+		"Target":      def.goos + "_" + def.goarch,
+		"IsSnapshot":  false,
+		"Env":         grEnv(),
+	}
+	if v, ok := parseSemver(tag); ok {
+		data["Major"], data["Minor"], data["Patch"] = v.major, v.minor, v.patch
+		data["Prerelease"] = strings.Join(v.pre, ".")
+		data["RawVersion"] = strconv.Itoa(v.major) + "." + strconv.Itoa(v.minor) + "." + strconv.Itoa(v.patch)
+	}
+	switch def.goarch {
+	case "amd64":
+		data["Amd64"] = "v1"
+		data["Target"] = def.goos + "_amd64_v1"
+	case "arm64":
+		data["Arm64"] = "v8.0"
+	case "arm":
+		data["Target"] = def.goos + "_arm_" + def.goarm
+	}
+	return data
+}
+
+// grEnvNames lists the environment variables that name templates may read
+// as .Env; set from -goreleaser-env in run. The rest of the environment,
+// forge tokens and the PyPI password included, is never exposed to an
+// upstream template.
+var grEnvNames []string
+
+// grEnv returns the allow-listed environment as the .Env template variable.
+func grEnv() map[string]string {
+	env := map[string]string{}
+	for _, k := range grEnvNames {
+		if v, ok := os.LookupEnv(k); ok {
+			env[k] = v
+		}
+	}
+	return env
+}
+
+// renderGRTemplate evaluates a GoReleaser template. Folded YAML scalars
+// leave surrounding whitespace, which GoReleaser trims too. A template
+// calling a function outside grTemplateFuncs fails with
+// errGRUnsupportedFunc.
+func renderGRTemplate(tmpl string, data map[string]any) (string, error) {
+	t, err := template.New("name").Option("missingkey=zero").Funcs(grTemplateFuncs).Parse(tmpl)
+	if m := grUndefinedFunc.FindStringSubmatch(fmt.Sprint(err)); m != nil {
+		return "", fmt.Errorf("template %q: %w %q", tmpl, errGRUnsupportedFunc, m[1])
+	}
+	if err != nil {
+		return "", fmt.Errorf("template %q: %w", tmpl, err)
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", fmt.Errorf("template %q: %w", tmpl, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
+
+// formats returns the archive formats a for goos, after format_overrides.
+func (a grArchiveConfig) formats(goos string) []string {
+	for _, o := range a.FormatOverrides {
+		if o.Goos != goos {
+			continue
+		}
+		if len(o.Formats) > 0 {
+			return o.Formats
+		}
+		if o.Format != "" {
+			return []string{o.Format}
+		}
+	}
+	if len(a.Formats) > 0 {
+		return a.Formats
+	}
+	if a.Format != "" {
+		return []string{a.Format}
+	}
+	return []string{"tar.gz"}
+}
+
+// grFormatExt maps a GoReleaser archive format to the archive extension
+// extractBinary understands, or "" for unsupported formats. "binary" assets
+// are the bare executable.
+func grFormatExt(format string) string {
+	switch format {
+	case "tar.gz", "tgz":
+		return "tar.gz"
+	case "tar.xz", "txz":
+		return "tar.xz"
+	case "tar.zst", "tzst":
+		return "tar.zst"
+	case "tar", "zip", "gz":
+		return format
+	case "binary":
+		return "raw"
+	}
+	return ""
+}
+
+// binaryFor returns the binary name template of the first build archive a
+// includes, or "" when it names none.
+func (c *grConfig) binaryFor(a grArchiveConfig) string {
+	for _, b := range c.Builds {
+		if len(a.Builds) == 0 || contains(a.Builds, b.ID) {
+			return b.Binary
+		}
+	}
+	return ""
+}
+
+// contains reports whether list holds s.
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveAssetsByGoReleaser matches release assets against the archive names
+// the GoReleaser configuration produces for each wanted platform. Every
+// archive entry and format is tried; the first name present in the release
+// wins. projectName is used when the configuration sets none.
+func resolveAssetsByGoReleaser(assets []ghAsset, gc *grConfig, projectName, binaryName, tag string, wantPlatforms []string) ([]assetEntry, error) {
+	if gc.ProjectName != "" {
+		projectName = gc.ProjectName
+	}
+	archives := gc.Archives
+	if len(archives) == 0 {
+		archives = []grArchiveConfig{{}}
+	}
+	wanted := buildWantedSet(wantPlatforms)
+	idx := indexAssets(assets)
+
+	var result []assetEntry
+	for _, platKey := range platformKeys() {
+		if !wanted[platKey] {
+			continue
+		}
+		def := knownPlatforms[platKey]
+		ae, ok, err := matchGoReleaserArchive(idx, gc, archives, projectName, binaryName, tag, platKey, def)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			result = append(result, ae)
+		}
+	}
+	return result, nil
+}
+
+// matchGoReleaserArchive finds the asset of one platform.
+func matchGoReleaserArchive(idx map[string]ghAsset, gc *grConfig, archives []grArchiveConfig, projectName, binaryName, tag, platKey string, def platformDef) (assetEntry, bool, error) {
+	var (
+		tried   []string
+		usesEnv bool // whether a rendered name may contain an environment value
+	)
+	for _, a := range archives {
+		binary := binaryName
+		if bt := gc.binaryFor(a); bt != "" {
+			usesEnv = usesEnv || strings.Contains(bt, ".Env")
+			b, err := renderGRTemplate(bt, grTemplateData(projectName, tag, binaryName, def))
+			if err != nil {
+				return assetEntry{}, false, err
+			}
+			binary = path.Base(b)
+		}
+		data := grTemplateData(projectName, tag, binary, def)
+
+		tmpl := a.NameTemplate
+		if tmpl == "" {
+			tmpl = grDefaultNameTemplate
+		}
+		usesEnv = usesEnv || strings.Contains(tmpl, ".Env")
+		name, err := renderGRTemplate(tmpl, data)
+		if err != nil {
+			return assetEntry{}, false, err
+		}
+
+		for _, format := range a.formats(def.goos) {
+			ext := grFormatExt(format)
+			if ext == "" {
+				slog.Debug("unsupported GoReleaser archive format, skipping", "format", format, "platform", platKey)
+				continue
+			}
+			assetName := name + "." + format
+			if ext == "raw" {
+				assetName = name + def.exe
+			}
+			tried = append(tried, assetName)
+			asset, ok := idx[assetName]
+			if !ok {
+				continue
+			}
+			binInArc := def.binaryInArchive(binary)
+			return assetEntry{
+				PlatformKey: platKey,
+				WheelTag:    def.wheelTag,
+				ArchiveExt:  ext,
+				BinaryInArc: binInArc,
+				AssetName:   assetName,
+				URL:         asset.BrowserDownloadURL,
+				APIURL:      asset.URL,
+				AssetID:     asset.ID,
+				Digest:      asset.Digest,
+			}, true, nil
+		}
+	}
+	attrs := []any{"platform", platKey}
+	if !usesEnv {
+		attrs = append(attrs, "tried", tried)
+	}
+	slog.Debug("no asset matches GoReleaser name template, skipping", attrs...)
+	return assetEntry{}, false, nil
+}
@@ -0,0 +1,262 @@
+// goreleaser_test.go
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestRenderGRTemplate(t *testing.T) {
+	data := grTemplateData("tool", "v1.4.2", "tool", knownPlatforms["Darwin_arm64"])
+	tests := map[string]string{
+		`{{ .ProjectName }}_{{ title .Os }}_{{ .Arch }}`:         "tool_Darwin_arm64",
+		`{{ .ProjectName }}-{{ .Version }}-{{ tolower .Os }}`:    "tool-1.4.2-darwin",
+		`{{ .Binary }}_v{{ .Major }}.{{ .Minor }}`:               "tool_v1.4",
+		`{{ replace .Arch "arm64" "aarch64" }}-{{ .Tag }}`:       "aarch64-v1.4.2",
+		"\n  {{ .ProjectName }}_{{ .Os }}\n":                     "tool_darwin",
+		grDefaultNameTemplate:                                    "tool_1.4.2_darwin_arm64",
+		`{{- if eq .Os "darwin" }}macOS{{ else }}other{{ end }}`: "macOS",
+	}
+	for tmpl, want := range tests {
+		got, err := renderGRTemplate(tmpl, data)
+		if err != nil {
+			t.Errorf("renderGRTemplate(%q): %v", tmpl, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("renderGRTemplate(%q) = %q, want %q", tmpl, got, want)
+		}
+	}
+
+	for key, want := range map[string]string{
+		"Linux_x86_64": "tool_1.4.2_linux_amd64",
+		"Linux_armv7":  "tool_1.4.2_linux_armv7",
+		"Windows_i386": "tool_1.4.2_windows_386",
+	} {
+		data := grTemplateData("tool", "v1.4.2", "tool", knownPlatforms[key])
+		if got, _ := renderGRTemplate(grDefaultNameTemplate, data); got != want {
+			t.Errorf("default template for %s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestGRTitle(t *testing.T) {
+	for in, want := range map[string]string{
+		"linux":       "Linux",
+		"LINUX":       "Linux",
+		"x86_64":      "X86_64",
+		"darwin_all":  "Darwin_all",
+		"macOS-ARM64": "Macos-Arm64",
+		"foo bar":     "Foo Bar",
+	} {
+		if got := grTitle(in); got != want {
+			t.Errorf("grTitle(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestRenderGRTemplate_UnsupportedFunc(t *testing.T) {
+	data := grTemplateData("tool", "v1.4.2", "tool", knownPlatforms["Linux_x86_64"])
+	_, err := renderGRTemplate(`{{ .ProjectName }}_{{ incpatch .Version }}`, data)
+	if !errors.Is(err, errGRUnsupportedFunc) {
+		t.Errorf("err = %v, want errGRUnsupportedFunc", err)
+	}
+}
+
+func TestGRTemplateData_EnvAllowList(t *testing.T) {
+	t.Setenv("BUILD_FLAVOR", "fast")
+	t.Setenv("PYPI_PASSWORD", "pypi-secret")
+	orig := grEnvNames
+	grEnvNames = []string{"BUILD_FLAVOR", "UNSET_VARIABLE"}
+	t.Cleanup(func() { grEnvNames = orig })
+
+	data := grTemplateData("tool", "v1.0.0", "tool", knownPlatforms["Linux_x86_64"])
+	got, err := renderGRTemplate(`{{ .Env.BUILD_FLAVOR }}-{{ .Env.PYPI_PASSWORD }}-{{ .Env.UNSET_VARIABLE }}`, data)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	if got != "fast--" {
+		t.Errorf("rendered %q, want only the allow-listed variable", got)
+	}
+}
+
+func TestResolveAssetsByGoReleaser_TitleAndOverrides(t *testing.T) {
+	gc, err := parseGoReleaserConfig([]byte(`
+project_name: tool
+builds:
+  - binary: tool-cli
+archives:
+  - name_template: >-
+      {{ .ProjectName }}_
+      {{- title .Os }}_
+      {{- if eq .Arch "amd64" }}x86_64
+      {{- else }}{{ .Arch }}{{ end }}
+    format_overrides:
+      - goos: windows
+        format: zip
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	assets := assetList(
+		"tool_Linux_x86_64.tar.gz",
+		"tool_Darwin_arm64.tar.gz",
+		"tool_Windows_x86_64.zip",
+		"tool_Windows_x86_64.tar.gz",
+		"checksums.txt",
+	)
+	got, err := resolveAssetsByGoReleaser(assets, gc, "other", "other", "v1.0.0", nil)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	byKey := map[string]assetEntry{}
+	for _, e := range got {
+		byKey[e.PlatformKey] = e
+	}
+	if len(byKey) != 3 {
+		t.Fatalf("got %d entries, want 3: %+v", len(got), got)
+	}
+	if e := byKey["Windows_x86_64"]; e.AssetName != "tool_Windows_x86_64.zip" || e.ArchiveExt != "zip" || e.BinaryInArc != "tool-cli.exe" {
+		t.Errorf("windows entry = %+v", e)
+	}
+	if e := byKey["Linux_x86_64"]; e.AssetName != "tool_Linux_x86_64.tar.gz" || e.BinaryInArc != "tool-cli" {
+		t.Errorf("linux entry = %+v", e)
+	}
+}
+
+func TestResolveAssetsByGoReleaser_V2Formats(t *testing.T) {
+	gc, err := parseGoReleaserConfig([]byte(`
+version: 2
+archives:
+  - formats: [tar.xz, tar.gz]
+    name_template: "{{ .ProjectName }}-{{ .Version }}-{{ .Os }}-{{ .Arch }}"
+    format_overrides:
+      - goos: windows
+        formats: [zip]
+`))
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	assets := assetList("tool-2.0.0-linux-arm64.tar.gz", "tool-2.0.0-windows-arm64.zip")
+	got, err := resolveAssetsByGoReleaser(assets, gc, "tool", "tool", "v2.0.0", []string{"Linux_arm64", "Windows_arm64"})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	var names []string
+	for _, e := range got {
+		names = append(names, e.AssetName)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "tool-2.0.0-linux-arm64.tar.gz" || names[1] != "tool-2.0.0-windows-arm64.zip" {
+		t.Errorf("assets = %v", names)
+	}
+}
+
+func TestResolveAssetsByGoReleaser_DefaultTemplate(t *testing.T) {
+	gc, _ := parseGoReleaserConfig([]byte("project_name: tool\n"))
+	assets := assetList("tool_1.0.0_linux_amd64.tar.gz", "tool_1.0.0_darwin_arm64.tar.gz")
+	got, err := resolveAssetsByGoReleaser(assets, gc, "tool", "tool", "v1.0.0", nil)
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if len(got) != 2 {
+		t.Errorf("got %d entries, want 2: %+v", len(got), got)
+	}
+}
+
+func TestResolveAssetsByGoReleaser_BadTemplate(t *testing.T) {
+	gc := &grConfig{Archives: []grArchiveConfig{{NameTemplate: "{{ .Os"}}}
+	if _, err := resolveAssetsByGoReleaser(assetList("x"), gc, "tool", "tool", "v1.0.0", nil); err == nil {
+		t.Error("expected template error")
+	}
+}
+
+func TestLoadGoReleaserConfig_Upstream(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/owner/tool/v1.0.0/.goreleaser.yaml" {
+			w.Write([]byte("project_name: fetched\n"))
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer srv.Close()
+	orig := ghRawURL
+	ghRawURL = srv.URL
+	t.Cleanup(func() { ghRawURL = orig })
+
+	gc, err := loadGoReleaserConfig(&Config{Repo: "owner/tool", GoReleaserConfig: goreleaserUpstream}, "v1.0.0")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if gc.ProjectName != "fetched" {
+		t.Errorf("project_name = %q, want fetched", gc.ProjectName)
+	}
+}
+
+func TestLoadGoReleaserConfig_UpstreamNextToFromDir(t *testing.T) {
+	root := t.TempDir()
+	dist := filepath.Join(root, "dist")
+	if err := os.Mkdir(dist, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".goreleaser.yml"), []byte("project_name: local\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	gc, err := loadGoReleaserConfig(&Config{FromDir: dist, GoReleaserConfig: goreleaserUpstream}, "v1.0.0")
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if gc.ProjectName != "local" {
+		t.Errorf("project_name = %q, want local", gc.ProjectName)
+	}
+}
+
+func TestResolveRelease_GoReleaserConfigFallsBack(t *testing.T) {
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ghRelease{
+			TagName: "v1.0.0",
+			Assets:  assetList("tool_1.0.0_Linux_x86_64.tar.gz"),
+		})
+	})
+	path := filepath.Join(t.TempDir(), "goreleaser.yaml")
+	if err := os.WriteFile(path, []byte("archives:\n  - name_template: nothing-matches\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rel, err := resolveRelease(&Config{Repo: "owner/tool", Version: "v1.0.0", BinaryName: "tool", GoReleaserConfig: path})
+	if err != nil {
+		t.Fatalf("resolveRelease: %v", err)
+	}
+	if len(rel.Assets) != 1 || rel.Assets[0].AssetName != "tool_1.0.0_Linux_x86_64.tar.gz" {
+		t.Errorf("assets = %+v", rel.Assets)
+	}
+}
+
+func TestResolveRelease_GoReleaserUnsupportedFuncFallsBack(t *testing.T) {
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ghRelease{
+			TagName: "v1.0.0",
+			Assets:  assetList("tool_1.0.0_Linux_x86_64.tar.gz"),
+		})
+	})
+	path := filepath.Join(t.TempDir(), "goreleaser.yaml")
+	cfg := "archives:\n  - name_template: '{{ .ProjectName }}_{{ envOrDefault \"FLAVOR\" \"std\" }}_{{ .Os }}'\n"
+	if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	rel, err := resolveRelease(&Config{Repo: "owner/tool", Version: "v1.0.0", BinaryName: "tool", GoReleaserConfig: path})
+	if err != nil {
+		t.Fatalf("resolveRelease: %v", err)
+	}
+	if len(rel.Assets) != 1 || rel.Assets[0].AssetName != "tool_1.0.0_Linux_x86_64.tar.gz" {
+		t.Errorf("assets = %+v", rel.Assets)
+	}
+}
@@ -0,0 +1,167 @@
+// include.go — extra archive files (completions, man pages, license files)
+// bundled into the wheel with -include.
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// maxIncludeSize is the largest total size of the files collectIncludes
+// reads, in bytes; 0 means no limit. It is set from -max-include-size.
+var maxIncludeSize int64 = 64 << 20
+
+// includeSpec is one parsed -include entry.
+type includeSpec struct {
+	pattern string
+	dest    string // "" = default placement
+}
+
+// parseIncludes parses -include entries, rejecting malformed globs and
+// destinations that would escape the wheel.
+func parseIncludes(entries []string) ([]includeSpec, error) {
+	var specs []includeSpec
+	for _, e := range entries {
+		pattern, dest, _ := strings.Cut(e, "=")
+		pattern = strings.TrimPrefix(path.Clean(pattern), "./")
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("-include %q: %w", e, err)
+		}
+		if dest != "" {
+			dest = path.Clean(dest)
+			if path.IsAbs(dest) || dest == ".." || strings.HasPrefix(dest, "../") {
+				return nil, fmt.Errorf("-include %q: destination must be a relative path inside the wheel", e)
+			}
+		}
+		specs = append(specs, includeSpec{pattern, dest})
+	}
+	return specs, nil
+}
+
+// globMatch matches the archive entry name against pattern like entryMatches
+// matches a binary name, and returns the matched part of name: its basename
+// for a pattern without "/", or the trailing path segments otherwise. Names
+// that are absolute or climb out of the archive root never match, since the
+// matched part would escape the package directory of the wheel.
+func globMatch(name, pattern string) (string, bool) {
+	name = path.Clean(strings.TrimPrefix(name, "./"))
+	if !isLocalArchivePath(name) {
+		return "", false
+	}
+	if !strings.Contains(pattern, "/") {
+		base := path.Base(name)
+		ok, _ := path.Match(pattern, base)
+		return base, ok
+	}
+	segs := strings.Split(name, "/")
+	n := strings.Count(pattern, "/") + 1
+	// The whole path, or the path below one top-level directory.
+	for _, start := range []int{0, 1} {
+		if len(segs)-start != n {
+			continue
+		}
+		rel := strings.Join(segs[start:], "/")
+		if ok, _ := path.Match(pattern, rel); ok {
+			return rel, true
+		}
+	}
+	return "", false
+}
+
+// isLocalArchivePath reports whether the cleaned archive entry name stays
+// below the archive root: relative and without ".." segments.
+func isLocalArchivePath(name string) bool {
+	return name != "." && !path.IsAbs(name) && name != ".." && !strings.HasPrefix(name, "../")
+}
+
+// manPageRe matches man page filenames such as tool.1 or tool.1.gz, capturing
+// the section.
+var manPageRe = regexp.MustCompile(`\.([1-9])(\.gz)?$`)
+
+// includeDest returns where the archive entry name goes in the wheel, as a
+// path relative to the package directory or starting with "share/" for the
+// data scheme. matched is the part of name the glob matched, kept below the
+// package directory for files that are neither man pages nor completions, and
+// command the name users run, which completion files must be named after.
+func includeDest(spec includeSpec, name, matched, command string) string {
+	base := path.Base(name)
+	if spec.dest != "" {
+		return path.Join(spec.dest, base)
+	}
+	dir := path.Dir(name)
+	lower := strings.ToLower(base)
+	switch {
+	case manPageRe.MatchString(base):
+		return "share/man/man" + manPageRe.FindStringSubmatch(base)[1] + "/" + base
+	case strings.HasSuffix(lower, ".bash"), path.Base(dir) == "bash":
+		return "share/bash-completion/completions/" + command
+	case strings.HasSuffix(lower, ".zsh"), path.Base(dir) == "zsh", strings.HasPrefix(base, "_") && path.Ext(base) == "":
+		return "share/zsh/site-functions/_" + command
+	case strings.HasSuffix(lower, ".fish"):
+		return "share/fish/vendor_completions.d/" + command + ".fish"
+	}
+	return matched
+}
+
+// collectIncludes returns the files of the archive matching specs as wheel
+// entries named by includeDest. The binary itself, matched by binaryTarget as
+// in extractBinary, is never included. Bare and single-file compressed
+// binaries have no other files, so nothing is collected from them.
+func collectIncludes(src *io.SectionReader, ext, binaryTarget, command string, specs []includeSpec) ([]wheelEntry, error) {
+	if len(specs) == 0 {
+		return nil, nil
+	}
+	format := archiveFormat(src, ext)
+	if _, isTar := tarCodec(format); !isTar && format != "zip" {
+		slog.Debug("asset is not an archive, nothing to include", "format", format)
+		return nil, nil
+	}
+
+	var out []wheelEntry
+	seen := map[string]string{}
+	var total int64
+	err := walkArchive(src, format, func(name string, mode fs.FileMode, r io.Reader) error {
+		if entryMatches(name, binaryTarget) {
+			return nil
+		}
+		if !isLocalArchivePath(path.Clean(strings.TrimPrefix(name, "./"))) {
+			slog.Warn("skipping archive entry outside the archive root", "file", name)
+			return nil
+		}
+		for _, spec := range specs {
+			matched, ok := globMatch(name, spec.pattern)
+			if !ok {
+				continue
+			}
+			dest := includeDest(spec, name, matched, command)
+			if prev, dup := seen[dest]; dup {
+				return fmt.Errorf("-include: %s and %s both map to %s", prev, name, dest)
+			}
+			if maxIncludeSize > 0 {
+				r = io.LimitReader(r, maxIncludeSize-total+1)
+			}
+			data, err := io.ReadAll(r)
+			if err != nil {
+				return fmt.Errorf("read %s: %w", name, err)
+			}
+			total += int64(len(data))
+			if maxIncludeSize > 0 && total > maxIncludeSize {
+				return fmt.Errorf("-include: included files exceed the maximum total size of %d bytes", maxIncludeSize)
+			}
+			seen[dest] = name
+			slog.Debug("including archive file", "file", name, "dest", dest)
+			out = append(out, wheelEntry{dest, data, mode&0o111 != 0})
+			return nil
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
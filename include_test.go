@@ -0,0 +1,167 @@
+// include_test.go
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestParseIncludes(t *testing.T) {
+	specs, err := parseIncludes([]string{"completions/*", "./LICENSE*=licenses", "docs/*.md=share/doc/tool"})
+	if err != nil {
+		t.Fatalf("parseIncludes: %v", err)
+	}
+	want := []includeSpec{
+		{"completions/*", ""},
+		{"LICENSE*", "licenses"},
+		{"docs/*.md", "share/doc/tool"},
+	}
+	if !reflect.DeepEqual(specs, want) {
+		t.Errorf("got %+v, want %+v", specs, want)
+	}
+
+	for _, bad := range []string{"[", "*=../outside", "*=/etc"} {
+		if _, err := parseIncludes([]string{bad}); err == nil {
+			t.Errorf("parseIncludes(%q): expected error", bad)
+		}
+	}
+}
+
+func TestGlobMatch(t *testing.T) {
+	tests := []struct {
+		name, pattern, want string
+		ok                  bool
+	}{
+		{"tool_1.0_linux/LICENSE", "LICENSE*", "LICENSE", true},
+		{"completions/tool.bash", "completions/*", "completions/tool.bash", true},
+		{"tool_1.0_linux/completions/tool.bash", "completions/*", "completions/tool.bash", true},
+		{"a/b/completions/tool.bash", "completions/*", "", false},
+		{"manpages/tool.1.gz", "completions/*", "", false},
+		{"../evil", "*/*", "", false},
+		{"/etc/passwd", "etc/*", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := globMatch(tt.name, tt.pattern)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("globMatch(%q, %q) = %q, %v; want %q, %v", tt.name, tt.pattern, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestIncludeDest(t *testing.T) {
+	tests := []struct {
+		spec    includeSpec
+		matched string
+		want    string
+	}{
+		{includeSpec{}, "manpages/tool.1.gz", "share/man/man1/tool.1.gz"},
+		{includeSpec{}, "tool.5", "share/man/man5/tool.5"},
+		{includeSpec{}, "completions/tool.bash", "share/bash-completion/completions/tool"},
+		{includeSpec{}, "completions/bash/tool", "share/bash-completion/completions/tool"},
+		{includeSpec{}, "completions/tool.zsh", "share/zsh/site-functions/_tool"},
+		{includeSpec{}, "completions/_tool", "share/zsh/site-functions/_tool"},
+		{includeSpec{}, "completions/tool.fish", "share/fish/vendor_completions.d/tool.fish"},
+		{includeSpec{}, "LICENSE", "LICENSE"},
+		{includeSpec{}, "licenses/THIRD_PARTY.txt", "licenses/THIRD_PARTY.txt"},
+		{includeSpec{dest: "share/doc/tool"}, "docs/README.md", "share/doc/tool/README.md"},
+	}
+	for _, tt := range tests {
+		if got := includeDest(tt.spec, "tool_1.0/"+tt.matched, tt.matched, "tool"); got != tt.want {
+			t.Errorf("includeDest(%+v, %q) = %q, want %q", tt.spec, tt.matched, got, tt.want)
+		}
+	}
+}
+
+func TestCollectIncludes(t *testing.T) {
+	data := makeTarGz(t, map[string][]byte{
+		"tool_1.0_linux/tool":                  []byte("binary"),
+		"tool_1.0_linux/LICENSE":               []byte("MIT"),
+		"tool_1.0_linux/README.md":             []byte("# tool"),
+		"tool_1.0_linux/completions/tool.bash": []byte("complete -F _tool tool"),
+		"tool_1.0_linux/completions/tool.zsh":  []byte("#compdef tool"),
+		"tool_1.0_linux/manpages/tool.1.gz":    []byte("man"),
+	})
+	specs, err := parseIncludes([]string{"completions/*", "manpages/*", "LICENSE*", "tool"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra, err := collectIncludes(sectionOf(data), "tar.gz", "tool", "tool", specs)
+	if err != nil {
+		t.Fatalf("collectIncludes: %v", err)
+	}
+	var got []string
+	for _, e := range extra {
+		got = append(got, e.name)
+	}
+	sort.Strings(got)
+	want := []string{
+		"LICENSE",
+		"share/bash-completion/completions/tool",
+		"share/man/man1/tool.1.gz",
+		"share/zsh/site-functions/_tool",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+
+	// A raw binary has nothing else to include.
+	extra, err = collectIncludes(sectionOf([]byte("\x7fELF")), "raw", "tool", "tool", specs)
+	if err != nil || len(extra) != 0 {
+		t.Errorf("raw: got %v, %v", extra, err)
+	}
+}
+
+func TestCollectIncludes_HostileEntries(t *testing.T) {
+	data := makeTarGz(t, map[string][]byte{
+		"tool":            []byte("binary"),
+		"../evil":         []byte("escape"),
+		"a/../../evil2":   []byte("escape"),
+		"/etc/cron.d/x":   []byte("escape"),
+		"completions/x.1": []byte("man"),
+	})
+	specs, err := parseIncludes([]string{"*/*", "*", "etc/*/*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	extra, err := collectIncludes(sectionOf(data), "tar.gz", "tool", "tool", specs)
+	if err != nil {
+		t.Fatalf("collectIncludes: %v", err)
+	}
+	var got []string
+	for _, e := range extra {
+		got = append(got, e.name)
+	}
+	if want := []string{"share/man/man1/x.1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestCollectIncludes_Conflict(t *testing.T) {
+	data := makeZip(t, map[string][]byte{
+		"tool.exe":        []byte("MZ"),
+		"a/tool.bash":     []byte("one"),
+		"b/bash/complete": []byte("two"),
+	})
+	specs, _ := parseIncludes([]string{"tool.bash", "complete"})
+	if _, err := collectIncludes(sectionOf(data), "zip", "tool.exe", "tool", specs); err == nil {
+		t.Error("expected error for two files with the same destination")
+	}
+}
+
+func TestCollectIncludes_MaxSize(t *testing.T) {
+	defer func(old int64) { maxIncludeSize = old }(maxIncludeSize)
+	maxIncludeSize = 8
+
+	data := makeTarGz(t, map[string][]byte{
+		"tool":      []byte("binary"),
+		"tool.bash": []byte("12345"),
+		"tool.zsh":  []byte("6789"),
+	})
+	specs, _ := parseIncludes([]string{"tool.*"})
+	_, err := collectIncludes(sectionOf(data), "tar.gz", "tool", "tool", specs)
+	if err == nil || !strings.Contains(err.Error(), "maximum total size") {
+		t.Errorf("err = %v, want a maximum total size error", err)
+	}
+}
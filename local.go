@@ -0,0 +1,221 @@
+// local.go — building from a local directory of archives instead of a forge,
+// typically the dist/ directory written by `goreleaser release --snapshot`.
+//
+// When the directory contains GoReleaser's artifacts.json and metadata.json,
+// those describe every archive exactly (goos/goarch, binary name, format)
+// and give the version. Otherwise the directory is globbed for archives,
+// which are then matched by name just like release assets. A directory with
+// an oci-layout file is read as an OCI image layout instead (see oci.go).
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// grMetadata is the subset of GoReleaser's dist/metadata.json we use.
+type grMetadata struct {
+	ProjectName string `json:"project_name"`
+	Tag         string `json:"tag"`
+	Version     string `json:"version"`
+}
+
+// grArtifact is one entry of GoReleaser's dist/artifacts.json.
+type grArtifact struct {
+	Name   string `json:"name"`
+	Path   string `json:"path"`
+	Goos   string `json:"goos"`
+	Goarch string `json:"goarch"`
+	Goarm  string `json:"goarm"`
+	Type   string `json:"type"`
+	Extra  struct {
+		Binaries []string `json:"Binaries"`
+		Format   string   `json:"Format"`
+	} `json:"extra"`
+}
+
+// readGoReleaserMetadata loads dir/metadata.json. It returns ok=false when
+// the file does not exist.
+func readGoReleaserMetadata(dir string) (meta grMetadata, ok bool, err error) {
+	data, err := os.ReadFile(filepath.Join(dir, "metadata.json"))
+	if os.IsNotExist(err) {
+		return meta, false, nil
+	}
+	if err != nil {
+		return meta, false, err
+	}
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return meta, false, fmt.Errorf("metadata.json: %w", err)
+	}
+	return meta, true, nil
+}
+
+// localFileURL returns the file:// URL that downloadAsset reads from disk.
+func localFileURL(p string) string {
+	return "file://" + filepath.ToSlash(p)
+}
+
+// resolveLocalDist resolves the version and assets of a local directory.
+// An explicit cfg.Version overrides the version from metadata.json.
+func resolveLocalDist(cfg *Config) (string, []assetEntry, error) {
+	dir := cfg.FromDir
+	if isOCILayout(dir) {
+		return resolveOCILayout(cfg)
+	}
+	meta, hasMeta, err := readGoReleaserMetadata(dir)
+	if err != nil {
+		return "", nil, err
+	}
+
+	tag, err := localDistVersion(cfg.Version, meta, hasMeta)
+	if err != nil {
+		return "", nil, fmt.Errorf("-from-dir %s: %w", dir, err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "artifacts.json"))
+	switch {
+	case err == nil:
+		var arts []grArtifact
+		if err := json.Unmarshal(data, &arts); err != nil {
+			return "", nil, fmt.Errorf("artifacts.json: %w", err)
+		}
+		slog.Info("using GoReleaser artifacts", "dir", dir, "tag", tag, "artifacts", len(arts))
+		return tag, resolveGoReleaserArtifacts(dir, arts, cfg.BinaryName, cfg.Platforms), nil
+	case !os.IsNotExist(err):
+		return "", nil, err
+	}
+
+	assets, err := globLocalArchives(dir)
+	if err != nil {
+		return "", nil, err
+	}
+	slog.Info("using local archives", "dir", dir, "tag", tag, "archives", len(assets))
+	entries, err := resolveAssets(cfg, assets, tag)
+	return tag, entries, err
+}
+
+// localDistVersion picks the version of a local directory: an explicit
+// -version, else the version from metadata.json, else its tag. The version
+// comes first because snapshot builds name their archives after it while the
+// tag still points at the previous release. A -version query is checked
+// against the metadata version, since a directory holds a single release.
+func localDistVersion(flagVersion string, meta grMetadata, hasMeta bool) (string, error) {
+	metaVersion := meta.Version
+	if metaVersion == "" {
+		metaVersion = meta.Tag
+	}
+	switch {
+	case isReleaseQuery(flagVersion):
+		if !hasMeta || metaVersion == "" {
+			return "", fmt.Errorf("-version %q is a query, which needs metadata.json to match against; pass the exact version", flagVersion)
+		}
+		rel, err := selectRelease([]ghRelease{{TagName: metaVersion}}, flagVersion)
+		if err != nil {
+			return "", fmt.Errorf("metadata.json version %s: %w", metaVersion, err)
+		}
+		return rel.TagName, nil
+	case flagVersion != "":
+		return flagVersion, nil
+	case metaVersion != "":
+		return metaVersion, nil
+	}
+	return "", fmt.Errorf("no metadata.json; -version is required")
+}
+
+// resolveGoReleaserArtifacts turns the Archive entries of artifacts.json into
+// asset entries, using their goos/goarch rather than their filenames to pick
+// the platform.
+func resolveGoReleaserArtifacts(dir string, arts []grArtifact, binaryName string, wantPlatforms []string) []assetEntry {
+	wanted := buildWantedSet(wantPlatforms)
+
+	var result []assetEntry
+	for _, a := range arts {
+		if a.Type != "Archive" {
+			continue
+		}
+		platKey, ok := platformKeyFor(a.Goos, a.Goarch, a.Goarm)
+		if !ok {
+			slog.Debug("no wheel platform for artifact, skipping", "artifact", a.Name, "goos", a.Goos, "goarch", a.Goarch)
+			continue
+		}
+		if !wanted[platKey] {
+			continue
+		}
+		def := knownPlatforms[platKey]
+
+		ext := grFormatExt(a.Extra.Format)
+		if ext == "" {
+			ext = detectArchiveExt(a.Name)
+		}
+
+		bin := binaryName
+		if len(a.Extra.Binaries) > 0 {
+			bin = filepath.Base(a.Extra.Binaries[0])
+		}
+		if def.exe != "" && !strings.HasSuffix(bin, def.exe) {
+			bin += def.exe
+		}
+
+		p, ok := locateArtifact(dir, a)
+		if !ok {
+			slog.Warn("artifact listed in artifacts.json not found, skipping", "artifact", a.Name, "path", a.Path)
+			continue
+		}
+		if abs, err := filepath.Abs(p); err == nil {
+			p = abs
+		}
+
+		result = append(result, assetEntry{
+			PlatformKey: platKey,
+			WheelTag:    def.wheelTag,
+			ArchiveExt:  ext,
+			BinaryInArc: bin,
+			AssetName:   a.Name,
+			URL:         localFileURL(p),
+		})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].PlatformKey < result[j].PlatformKey })
+	return result
+}
+
+// locateArtifact finds an artifact on disk. artifacts.json records paths
+// relative to the directory GoReleaser ran in (usually the parent of dist/),
+// so the archive is looked up by name inside dir first.
+func locateArtifact(dir string, a grArtifact) (string, bool) {
+	for _, p := range []string{
+		filepath.Join(dir, a.Name),
+		filepath.Join(filepath.Dir(dir), a.Path),
+		a.Path,
+	} {
+		if fi, err := os.Stat(p); err == nil && fi.Mode().IsRegular() {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// globLocalArchives lists the archives directly inside dir as assets with
+// file:// download URLs.
+func globLocalArchives(dir string) ([]ghAsset, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var assets []ghAsset
+	for _, e := range entries {
+		if e.IsDir() || detectArchiveExt(e.Name()) == "" {
+			continue
+		}
+		p, err := filepath.Abs(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		assets = append(assets, ghAsset{Name: e.Name(), BrowserDownloadURL: localFileURL(p)})
+	}
+	return assets, nil
+}
@@ -0,0 +1,279 @@
+// local_test.go
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeDist creates a fake GoReleaser dist/ directory inside a temporary
+// project root, with the given archives, metadata.json and (when arts is
+// non-nil) artifacts.json. It returns the dist path.
+func writeDist(t *testing.T, archives map[string][]byte, meta *grMetadata, arts []map[string]any) string {
+	t.Helper()
+	dist := filepath.Join(t.TempDir(), "dist")
+	if err := os.MkdirAll(dist, 0o755); err != nil {
+		t.Fatalf("mkdir: %v", err)
+	}
+	for name, data := range archives {
+		if err := os.WriteFile(filepath.Join(dist, name), data, 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	writeJSON := func(name string, v any) {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatalf("marshal %s: %v", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dist, name), data, 0o644); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+	if meta != nil {
+		writeJSON("metadata.json", meta)
+	}
+	if arts != nil {
+		writeJSON("artifacts.json", arts)
+	}
+	return dist
+}
+
+// grArchive builds one artifacts.json Archive entry.
+func grArchive(name, goos, goarch, binary, format string) map[string]any {
+	return map[string]any{
+		"name":   name,
+		"path":   "dist/" + name,
+		"goos":   goos,
+		"goarch": goarch,
+		"type":   "Archive",
+		"extra":  map[string]any{"Binaries": []string{binary}, "Format": format},
+	}
+}
+
+func TestResolveLocalDist_Artifacts(t *testing.T) {
+	dist := writeDist(t,
+		map[string][]byte{
+			"cli_1.3.0-SNAPSHOT-abc_linux_amd64.tar.gz": []byte("tgz"),
+			"cli_1.3.0-SNAPSHOT-abc_windows_arm64.zip":  []byte("zip"),
+			"cli_1.3.0-SNAPSHOT-abc_freebsd_amd64.zip":  []byte("zip"),
+		},
+		&grMetadata{ProjectName: "cli", Tag: "v1.3.0", Version: "1.3.0-SNAPSHOT-abc"},
+		[]map[string]any{
+			grArchive("cli_1.3.0-SNAPSHOT-abc_linux_amd64.tar.gz", "linux", "amd64", "mycli", "tar.gz"),
+			grArchive("cli_1.3.0-SNAPSHOT-abc_windows_arm64.zip", "windows", "arm64", "mycli", "zip"),
+			grArchive("cli_1.3.0-SNAPSHOT-abc_freebsd_amd64.zip", "freebsd", "amd64", "mycli", "zip"),
+			{"name": "checksums.txt", "path": "dist/checksums.txt", "type": "Checksum"},
+		},
+	)
+
+	tag, entries, err := resolveLocalDist(&Config{FromDir: dist, BinaryName: "cli"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tag != "1.3.0-SNAPSHOT-abc" {
+		t.Errorf("tag = %q, want the metadata version 1.3.0-SNAPSHOT-abc", tag)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries (freebsd has no wheel tag), got %d: %+v", len(entries), entries)
+	}
+
+	linux, windows := entries[0], entries[1]
+	if linux.PlatformKey != "Linux_x86_64" || linux.WheelTag != "manylinux_2_17_x86_64" {
+		t.Errorf("linux entry = %+v", linux)
+	}
+	if linux.BinaryInArc != "mycli" {
+		t.Errorf("linux binary = %q, want mycli (from artifacts.json)", linux.BinaryInArc)
+	}
+	if windows.PlatformKey != "Windows_arm64" || windows.ArchiveExt != "zip" {
+		t.Errorf("windows entry = %+v", windows)
+	}
+	if windows.BinaryInArc != "mycli.exe" {
+		t.Errorf("windows binary = %q, want mycli.exe", windows.BinaryInArc)
+	}
+	if !strings.HasPrefix(linux.URL, "file://") {
+		t.Errorf("URL = %q, want file:// URL", linux.URL)
+	}
+}
+
+func TestResolveLocalDist_VersionFlagOverridesMetadata(t *testing.T) {
+	dist := writeDist(t, nil, &grMetadata{ProjectName: "cli", Tag: "v1.3.0"}, []map[string]any{})
+
+	tag, _, err := resolveLocalDist(&Config{FromDir: dist, Version: "v1.3.1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tag != "v1.3.1" {
+		t.Errorf("tag = %q, want v1.3.1", tag)
+	}
+}
+
+func TestResolveLocalDist_TagWithoutVersion(t *testing.T) {
+	dist := writeDist(t, nil, &grMetadata{ProjectName: "cli", Tag: "v1.3.0"}, []map[string]any{})
+
+	tag, _, err := resolveLocalDist(&Config{FromDir: dist})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tag != "v1.3.0" {
+		t.Errorf("tag = %q, want v1.3.0", tag)
+	}
+}
+
+func TestResolveLocalDist_VersionQuery(t *testing.T) {
+	dist := writeDist(t, nil, &grMetadata{ProjectName: "cli", Tag: "v1.2.4", Version: "1.2.4"}, []map[string]any{})
+
+	tag, _, err := resolveLocalDist(&Config{FromDir: dist, Version: "^1.2"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tag != "1.2.4" {
+		t.Errorf("tag = %q, want 1.2.4", tag)
+	}
+
+	if _, _, err := resolveLocalDist(&Config{FromDir: dist, Version: ">=2"}); err == nil {
+		t.Error("expected error when the metadata version does not match the query, got nil")
+	}
+}
+
+func TestResolveLocalDist_VersionQueryNeedsMetadata(t *testing.T) {
+	dist := writeDist(t, map[string][]byte{"tool_1.2.0_Linux_arm64.tar.gz": []byte("a")}, nil, nil)
+
+	if _, _, err := resolveLocalDist(&Config{FromDir: dist, BinaryName: "tool", Version: "^1.2"}); err == nil {
+		t.Fatal("expected error for a -version query without metadata.json, got nil")
+	}
+}
+
+func TestResolveLocalDist_Glob(t *testing.T) {
+	dist := writeDist(t, map[string][]byte{
+		"tool_2.0.0_Linux_arm64.tar.gz":  []byte("a"),
+		"tool_2.0.0_Darwin_arm64.tar.gz": []byte("b"),
+		"checksums.txt":                  []byte("c"),
+	}, nil, nil)
+
+	tag, entries, err := resolveLocalDist(&Config{FromDir: dist, BinaryName: "tool", Version: "v2.0.0"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tag != "v2.0.0" {
+		t.Errorf("tag = %q, want v2.0.0", tag)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+}
+
+func TestResolveLocalDist_GlobRequiresVersion(t *testing.T) {
+	dist := writeDist(t, map[string][]byte{"tool_Linux_arm64.tar.gz": []byte("a")}, nil, nil)
+
+	if _, _, err := resolveLocalDist(&Config{FromDir: dist, BinaryName: "tool"}); err == nil {
+		t.Fatal("expected error without -version or metadata.json, got nil")
+	}
+}
+
+func TestDownloadAsset_LocalFile(t *testing.T) {
+	want := []byte("local archive")
+	p := filepath.Join(t.TempDir(), "tool.tar.gz")
+	if err := os.WriteFile(p, want, 0o644); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+
+	got, err := downloadBytes(downloadAsset(assetEntry{AssetName: "tool.tar.gz", URL: localFileURL(p)}, t.TempDir()))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestRun_FromDirWithoutNetwork(t *testing.T) {
+	dist := writeDist(t,
+		map[string][]byte{
+			"cli_1.3.0_linux_arm64.tar.gz": makeTarGz(t, map[string][]byte{"cli": []byte("ELF")}),
+		},
+		&grMetadata{ProjectName: "cli", Tag: "v1.3.0", Version: "1.3.0"},
+		[]map[string]any{grArchive("cli_1.3.0_linux_arm64.tar.gz", "linux", "arm64", "cli", "tar.gz")},
+	)
+	root := filepath.Dir(dist)
+	if err := os.WriteFile(filepath.Join(root, "LICENSE"), []byte("MIT"), 0o644); err != nil {
+		t.Fatalf("write license: %v", err)
+	}
+	desc := filepath.Join(root, "README.md")
+	if err := os.WriteFile(desc, []byte("# cli"), 0o644); err != nil {
+		t.Fatalf("write description: %v", err)
+	}
+
+	cfg := &Config{
+		FromDir:         dist,
+		BinaryName:      "cli",
+		PackageName:     "cli",
+		EntryPoint:      "cli",
+		Summary:         "cli",
+		LicenseExpr:     "MIT",
+		DescriptionPath: desc,
+		Output:          t.TempDir(),
+	}
+	if err := run(cfg); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	whl := filepath.Join(cfg.Output, "cli-1.3.0-py3-none-manylinux_2_17_aarch64.whl")
+	entries := wheelEntries(t, whl)
+	if string(entries["cli/cli"]) != "ELF" {
+		t.Errorf("binary in wheel = %q, want ELF", entries["cli/cli"])
+	}
+	metadata := string(entries["cli-1.3.0.dist-info/METADATA"])
+	if strings.Contains(metadata, "Project-URL") {
+		t.Errorf("METADATA should have no Project-URL without -repo:\n%s", metadata)
+	}
+}
+
+func TestRun_FromDirSnapshotVersion(t *testing.T) {
+	dist := writeDist(t,
+		map[string][]byte{
+			"cli_1.3.0-SNAPSHOT-abc1234_linux_arm64.tar.gz": makeTarGz(t, map[string][]byte{"cli": []byte("ELF")}),
+		},
+		&grMetadata{ProjectName: "cli", Tag: "v1.2.0", Version: "1.3.0-SNAPSHOT-abc1234"},
+		[]map[string]any{grArchive("cli_1.3.0-SNAPSHOT-abc1234_linux_arm64.tar.gz", "linux", "arm64", "cli", "tar.gz")},
+	)
+	if err := os.WriteFile(filepath.Join(filepath.Dir(dist), "LICENSE"), []byte("MIT"), 0o644); err != nil {
+		t.Fatalf("write license: %v", err)
+	}
+	cfg := &Config{
+		FromDir:     dist,
+		BinaryName:  "cli",
+		PackageName: "cli",
+		EntryPoint:  "cli",
+		Summary:     "cli",
+		LicenseExpr: "MIT",
+		Output:      t.TempDir(),
+	}
+	if err := run(cfg); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+
+	whl := filepath.Join(cfg.Output, "cli-1.3.0.dev0+abc1234-py3-none-manylinux_2_17_aarch64.whl")
+	entries := wheelEntries(t, whl)
+	if _, ok := entries["cli-1.3.0.dev0+abc1234.dist-info/METADATA"]; !ok {
+		t.Errorf("wheel has no dist-info for 1.3.0.dev0+abc1234")
+	}
+
+	// PyPI rejects local versions, so -upload fails before building.
+	t.Setenv("PYPI_TOKEN", "pypi-token")
+	cfg.Upload = true
+	cfg.PyPIURL = "http://127.0.0.1:1/legacy/"
+	cfg.Output = t.TempDir()
+	err := run(cfg)
+	if err == nil || !strings.Contains(err.Error(), "-py-version") {
+		t.Fatalf("run with -upload: err = %v, want a -py-version error", err)
+	}
+	if files, _ := os.ReadDir(cfg.Output); len(files) != 0 {
+		t.Errorf("built %d wheels before refusing the upload", len(files))
+	}
+	if err := checkUploadVersion("1.3.0.dev0"); err != nil {
+		t.Errorf("checkUploadVersion(1.3.0.dev0): %v", err)
+	}
+}
@@ -6,26 +6,48 @@
 //
 // Required flags:
 //
-//	-repo   owner/name   GitHub repository to fetch releases from
+//	-repo   owner/name   repository to fetch releases from (optional with -from-dir/-url-template)
 //
 // Optional flags:
 //
-//	-version        release tag (default: latest)
-//	-binary-name    binary filename in archives (default: repo name)
+//	-source         release source: github, gitlab, gitea or oci (default: github)
+//	-version        release tag or version query (default: latest)
+//	-github-url     GitHub Enterprise Server URL (default: $GITHUB_URL or github.com)
+//	-forge-url      web root of a self-hosted forge for -source (default: public instance)
+//	-from-dir       build from local archives, e.g. a GoReleaser dist/, or an OCI image layout (no network)
+//	-url-template   build from URLs such as https://dl.example.com/{version}/{binary}_{os}_{arch}.{ext}
+//	-binary-name    binary filename in archives (default: repo or GoReleaser project name,
+//	                or the only executable in an archive that lacks it)
+//	-binary-path    exact path of the binary in archives, e.g. {binary}_{version}_{os}_{arch}/bin/{binary}{exe}
 //	-package-name   Python package name (default: binary-name)
 //	-entry-point    console_scripts entry (default: binary-name)
 //	-summary        one-line PyPI summary
 //	-license-expr   SPDX license expression (default: MIT)
-//	-py-version     Python package version (default: mirrors -version)
+//	-py-version     Python package version (default: -version in PEP 440 normal form)
+//	-backfill       build every release in a range, e.g. v1.0.0..v1.6.3
+//	-backfill-last  build the N newest stable releases
 //	-output         output directory (default: ./dist)
-//	-platforms      comma-separated GoReleaser OS_Arch keys (default: all)
+//	-platforms      comma-separated OS_Arch keys or aliases, e.g. linux_amd64 (default: all PyPI accepts)
+//	-platform-map   YAML file replacing or extending the built-in platform table
 //	-assets         comma-separated asset filenames to download (overrides auto-detect)
+//	-asset-pattern  regexp with (?P<os>...) and (?P<arch>...) groups matched against asset names
+//	-include        comma-separated glob or glob=dir archive files (completions, man pages...) to add to the wheel
+//	-max-binary-size largest extracted binary, e.g. 512M (default: 512M; 0 = no limit)
+//	-max-include-size largest total of -include files (default: 64M; 0 = no limit)
+//	-musllinux      also tag statically linked Linux binaries musllinux (default: true)
+//	-universal2     macOS universal2 wheel: off, add or only (default: off)
+//	-goreleaser-config .goreleaser.yaml path or URL, or "upstream", to compute asset names
+//	-goreleaser-env environment variables -goreleaser-config templates may read as .Env (default: none)
 //	-upload         upload wheels to PyPI (default: false)
 //	-pypi-url       PyPI upload endpoint (default: https://upload.pypi.org/legacy/)
 //	-pypi-user      PyPI username (default: __token__)
-//	-license        path to license file (default: fetch from repo)
+//	-pypi-json-url  JSON API root checked by backfill (default: derived from -pypi-url)
+//	-license        path to license file (default: next to -from-dir, else fetch from repo)
 //	-description    path to Markdown description file (default: DESCRIPTION.md)
-//	-cache          binary cache directory ("" to disable; default: OS cache dir)
+//	-release-notes  append the upstream release notes to the description (default: false)
+//	-release-notes-max truncate appended release notes to N characters (default: 0, no limit)
+//	-cache          binary and API response cache directory ("" to disable; default: OS cache dir)
+//	-rate-limit-wait longest wait for a GitHub rate limit to reset (default: 1m)
 //	-debug          enable debug-level logging
 //
 // Environment variables:
@@ -33,27 +55,41 @@
 //	PYPI_TOKEN    PyPI API token (required when -upload is set)
 //	PYPI_PASSWORD alternative to PYPI_TOKEN
 //	GITHUB_TOKEN  GitHub PAT to avoid API rate limits
+//	GITHUB_URL    default for -github-url
+//	GITLAB_TOKEN  GitLab access token for private projects (-source gitlab)
+//	GITEA_TOKEN   Gitea/Forgejo access token for private repos (-source gitea)
+//	OCI_USERNAME  registry username for private images (-source oci)
+//	OCI_PASSWORD  registry password or token (-source oci)
 package main
 
 import (
-	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"time"
 )
 
 func main() {
 	cfg := &Config{}
 
-	// GitHub source
-	flag.StringVar(&cfg.Repo, "repo", "", "GitHub repository in owner/name format (required)")
-	flag.StringVar(&cfg.Version, "version", "", "Release tag, e.g. v1.4.2 (default: latest)")
+	// Release source
+	flag.StringVar(&cfg.Source, "source", sourceGitHub, "Release source: github, gitlab, gitea or oci")
+	flag.StringVar(&cfg.Repo, "repo", "", "Repository in owner/name format; group/subgroup/project for GitLab; registry/name for OCI (required)")
+	flag.StringVar(&cfg.Version, "version", "", "Release tag, e.g. v1.4.2, or query: '>=1.4,<2', '~1.4', latest-stable, latest-prerelease (default: latest)")
+	flag.StringVar(&cfg.GitHubURL, "github-url", os.Getenv("GITHUB_URL"), "GitHub Enterprise Server URL, e.g. https://github.example.com (default: github.com)")
+	flag.StringVar(&cfg.ForgeURL, "forge-url", "", "Web root of a self-hosted forge for -source, e.g. https://gitlab.example.com or https://codeberg.org")
+	flag.StringVar(&cfg.FromDir, "from-dir", "", "Build from local archives instead of a forge, e.g. a GoReleaser dist/ directory or an OCI image layout")
+	flag.StringVar(&cfg.URLTemplate, "url-template", "", "Build from templated download URLs instead of a forge, e.g. 'https://dl.example.com/{version}/{binary}_{os}_{arch}.{ext}'")
 
 	// Package identity
-	flag.StringVar(&cfg.BinaryName, "binary-name", "", "Binary filename inside archives (default: repo name)")
+	flag.StringVar(&cfg.BinaryName, "binary-name", "", "Binary filename inside archives (default: repo name, or the only executable in the archive)")
+	flag.StringVar(&cfg.BinaryPath, "binary-path", "", "Path of the binary inside archives, with -url-template placeholders, e.g. '{binary}_{version}_{os}_{arch}/bin/{binary}{exe}' (default: any entry named binary-name)")
 	flag.StringVar(&cfg.PackageName, "package-name", "", "Python package name (default: binary-name)")
 	flag.StringVar(&cfg.EntryPoint, "entry-point", "", "console_scripts entry point (default: binary-name)")
 	flag.StringVar(&cfg.Summary, "summary", "", "One-line PyPI summary (default: derived from package name)")
@@ -61,41 +97,102 @@ func main() {
 
 	// Build
 	flag.StringVar(&cfg.Output, "output", "./dist", "Output directory for .whl files")
-	flag.StringVar(&cfg.PyVersion, "py-version", "", "Python package version (default: mirrors -version)")
-	platformsFlag := flag.String("platforms", "", "Comma-separated platform keys (default: all)")
+	flag.StringVar(&cfg.PyVersion, "py-version", "", "Python package version (default: -version in PEP 440 normal form)")
+	platformsFlag := flag.String("platforms", "", "Comma-separated platform keys or aliases, e.g. Linux_x86_64,darwin_arm64 (default: all but Linux_armv6, whose wheel PyPI rejects)")
+	flag.StringVar(&cfg.PlatformMap, "platform-map", "", "YAML file of platform definitions replacing or extending the built-in table")
 	assetsFlag := flag.String("assets", "", "Comma-separated asset filenames to download (overrides auto-detect)")
+	assetPatternFlag := flag.String("asset-pattern", "", `Regular expression matched against asset names, with named groups os and arch (and optionally arm, version, ext, binary), e.g. '^mytool-(?P<version>[^-]+)-(?P<os>linux|darwin)-(?P<arch>amd64|arm64)\.tar\.gz$'`)
+	includeFlag := flag.String("include", "", "Comma-separated archive files to add to the wheel, each glob or glob=dir, e.g. 'completions/*,docs/*.md=share/doc/tool'; a share/ dir goes under the data scheme, others are relative to the package")
+	maxBinaryFlag := flag.String("max-binary-size", "512M", "Largest binary to extract, guarding against decompression bombs, e.g. 512M or 2G (0 = no limit)")
+	maxIncludeFlag := flag.String("max-include-size", "64M", "Largest total size of -include files (0 = no limit)")
+	flag.BoolVar(&cfg.Musllinux, "musllinux", true, "Also tag wheels of statically linked Linux binaries musllinux_1_1, for Alpine")
+	flag.StringVar(&cfg.Universal2, "universal2", universal2Off, "macOS universal2 wheel: off, add (alongside thin wheels) or only (instead of them)")
+	flag.StringVar(&cfg.GoReleaserConfig, "goreleaser-config", "", `Compute asset names from a .goreleaser.yaml name_template: a path, a URL, or "upstream" for the repo's own file at the release tag`)
+	goreleaserEnvFlag := flag.String("goreleaser-env", "", "Comma-separated environment variables that -goreleaser-config templates may read as .Env (default: none)")
+	flag.StringVar(&cfg.Backfill, "backfill", "", "Build every release in a version range, e.g. v1.0.0..v1.6.3 (either end may be omitted)")
+	flag.IntVar(&cfg.BackfillLast, "backfill-last", 0, "Build the N newest stable releases")
 
 	// PyPI upload
 	flag.BoolVar(&cfg.Upload, "upload", false, "Upload built wheels to PyPI")
 	flag.StringVar(&cfg.PyPIURL, "pypi-url", defaultPyPIURL, "PyPI upload endpoint")
 	flag.StringVar(&cfg.PyPIUser, "pypi-user", "__token__", "PyPI username")
+	flag.StringVar(&cfg.PyPIJSONURL, "pypi-json-url", "", "PyPI JSON API root used by backfill to skip published versions (default: derived from -pypi-url)")
 
 	// Input files
-	flag.StringVar(&cfg.LicensePath, "license", "", "Path to license file (default: fetch from repo)")
+	flag.StringVar(&cfg.LicensePath, "license", "", "Path to license file (default: next to -from-dir, else fetch from repo)")
 	flag.StringVar(&cfg.DescriptionPath, "description", "DESCRIPTION.md", "Path to Markdown description file")
+	flag.BoolVar(&cfg.ReleaseNotes, "release-notes", false, "Append the upstream release notes to the PyPI description")
+	flag.IntVar(&cfg.ReleaseNotesMax, "release-notes-max", 0, "Truncate appended release notes to this many characters (0 = no limit)")
 
 	// Cache & logging
-	flag.StringVar(&cfg.CacheDir, "cache", defaultCacheDir(), `Binary cache directory ("" to disable)`)
+	flag.StringVar(&cfg.CacheDir, "cache", defaultCacheDir(), `Binary and API response cache directory ("" to disable)`)
+	flag.DurationVar(&cfg.RateLimitWait, "rate-limit-wait", time.Minute, "Longest time to wait for a GitHub rate limit to reset before failing")
 	flag.BoolVar(&cfg.Debug, "debug", false, "Enable debug-level logging")
 
 	flag.Parse()
 	setupLogging(cfg.Debug)
 
-	// Validate -repo
-	if cfg.Repo == "" {
-		fmt.Fprintln(os.Stderr, "error: -repo is required (e.g. -repo neo4j/mcp)")
+	// Validate -repo; it is optional when building from a local directory or
+	// a URL template.
+	if cfg.Repo == "" && cfg.FromDir == "" && cfg.URLTemplate == "" {
+		fmt.Fprintln(os.Stderr, "error: -repo is required (e.g. -repo neo4j/mcp) unless -from-dir or -url-template is given")
 		flag.Usage()
 		os.Exit(1)
 	}
-	if !strings.Contains(cfg.Repo, "/") {
+	if cfg.Repo != "" && !strings.Contains(cfg.Repo, "/") {
 		fmt.Fprintln(os.Stderr, "error: -repo must be in owner/name format (e.g. neo4j/mcp)")
 		os.Exit(1)
 	}
 
-	// Derive defaults from the repo name component.
-	repoName := strings.SplitN(cfg.Repo, "/", 2)[1]
+	// Backfill builds a list of releases, so it excludes -version.
+	if cfg.Backfill != "" && cfg.BackfillLast > 0 {
+		fmt.Fprintln(os.Stderr, "error: -backfill and -backfill-last are mutually exclusive")
+		os.Exit(1)
+	}
+	if (cfg.Backfill != "" || cfg.BackfillLast > 0) && cfg.Version != "" {
+		fmt.Fprintln(os.Stderr, "error: -version cannot be combined with -backfill or -backfill-last")
+		os.Exit(1)
+	}
+	if *assetPatternFlag != "" {
+		if cfg.GoReleaserConfig != "" {
+			fmt.Fprintln(os.Stderr, "error: -asset-pattern and -goreleaser-config are mutually exclusive")
+			os.Exit(1)
+		}
+		re, err := compileAssetPattern(*assetPatternFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+		cfg.AssetPattern = re
+	}
+	if p := cfg.BinaryPath; path.IsAbs(p) || strings.Contains("/"+p+"/", "/../") {
+		fmt.Fprintln(os.Stderr, "error: -binary-path must be a relative path inside the archive")
+		os.Exit(1)
+	}
+	switch cfg.Universal2 {
+	case universal2Add, universal2Only, universal2Off:
+	default:
+		fmt.Fprintf(os.Stderr, "error: -universal2 must be add, only or off, not %q\n", cfg.Universal2)
+		os.Exit(1)
+	}
+
+	// Derive defaults from the last path component of the repo, or from the
+	// GoReleaser project name when building from a local dist/ directory.
+	defaultName := ""
+	if cfg.Repo != "" {
+		defaultName = path.Base(cfg.Repo)
+	} else if cfg.FromDir != "" {
+		if meta, ok, err := readGoReleaserMetadata(cfg.FromDir); err == nil && ok {
+			defaultName = meta.ProjectName
+		}
+	}
 	if cfg.BinaryName == "" {
-		cfg.BinaryName = repoName
+		if defaultName == "" {
+			fmt.Fprintln(os.Stderr, "error: -binary-name is required without -repo (unless -from-dir has a metadata.json)")
+			os.Exit(1)
+		}
+		cfg.BinaryName = defaultName
+		cfg.InferBinary = cfg.BinaryPath == ""
 	}
 	if cfg.PackageName == "" {
 		cfg.PackageName = cfg.BinaryName
@@ -107,12 +204,26 @@ func main() {
 		cfg.Summary = fmt.Sprintf("%s — packaged as a Python wheel", cfg.PackageName)
 	}
 
+	// The platform map must be applied before -platforms is resolved against it.
+	if cfg.PlatformMap != "" {
+		if err := loadPlatformMap(cfg.PlatformMap); err != nil {
+			fmt.Fprintf(os.Stderr, "error: -platform-map: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
 	// Parse comma-separated list flags.
 	if *platformsFlag != "" {
-		for _, k := range strings.Split(*platformsFlag, ",") {
-			if k = strings.TrimSpace(k); k != "" {
-				cfg.Platforms = append(cfg.Platforms, k)
+		for _, p := range strings.Split(*platformsFlag, ",") {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			k, ok := canonicalPlatformKey(p)
+			if !ok {
+				fmt.Fprintf(os.Stderr, "error: unknown platform %q in -platforms\n", p)
+				os.Exit(1)
 			}
+			cfg.Platforms = append(cfg.Platforms, k)
 		}
 	}
 	if *assetsFlag != "" {
@@ -122,6 +233,40 @@ func main() {
 			}
 		}
 	}
+	if *goreleaserEnvFlag != "" {
+		for _, e := range strings.Split(*goreleaserEnvFlag, ",") {
+			if e = strings.TrimSpace(e); e != "" {
+				cfg.GoReleaserEnv = append(cfg.GoReleaserEnv, e)
+			}
+		}
+	}
+	if *includeFlag != "" {
+		for _, g := range strings.Split(*includeFlag, ",") {
+			if g = strings.TrimSpace(g); g != "" {
+				cfg.Include = append(cfg.Include, g)
+			}
+		}
+		if _, err := parseIncludes(cfg.Include); err != nil {
+			fmt.Fprintf(os.Stderr, "error: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	for _, f := range []struct {
+		name string
+		val  string
+		dst  *int64
+	}{
+		{"max-binary-size", *maxBinaryFlag, &cfg.MaxBinarySize},
+		{"max-include-size", *maxIncludeFlag, &cfg.MaxIncludeSize},
+	} {
+		n, err := parseByteSize(f.val)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "error: -%s: %v\n", f.name, err)
+			os.Exit(1)
+		}
+		*f.dst = n
+	}
 
 	if err := run(cfg); err != nil {
 		slog.Error("fatal error", "error", err)
@@ -136,9 +281,22 @@ func run(cfg *Config) error {
 		return fmt.Errorf("mkdir %s: %w", cfg.Output, err)
 	}
 
+	if err := configureSource(cfg); err != nil {
+		return err
+	}
+	ghMaxRateLimitWait = cfg.RateLimitWait
+	maxBinarySize = cfg.MaxBinarySize
+	maxIncludeSize = cfg.MaxIncludeSize
+	grEnvNames = cfg.GoReleaserEnv
+	if cfg.CacheDir != "" {
+		ghCacheDir = filepath.Join(cfg.CacheDir, "github-api")
+	}
+
 	// Log resolved config so mismatched defaults are immediately visible.
 	slog.Info("config",
+		"source", cfg.Source,
 		"repo", cfg.Repo,
+		"from_dir", cfg.FromDir,
 		"binary_name", cfg.BinaryName,
 		"package_name", cfg.PackageName,
 		"entry_point", cfg.EntryPoint,
@@ -166,44 +324,195 @@ func run(cfg *Config) error {
 		return fmt.Errorf("description: %w", err)
 	}
 
-	rel, err := fetchRelease(cfg.Repo, cfg.Version)
+	include, err := parseIncludes(cfg.Include)
+	if err != nil {
+		return err
+	}
+
+	in := buildInputs{licenseData: licenseData, descriptionData: descriptionData, pypiPassword: pypiPassword, include: include}
+	if cfg.Backfill != "" || cfg.BackfillLast > 0 {
+		return runBackfill(cfg, in)
+	}
+
+	rel, err := resolveRelease(cfg)
 	if err != nil {
-		return fmt.Errorf("fetch release: %w", err)
+		return err
 	}
 
-	binaryVersion := strings.TrimPrefix(rel.TagName, "v")
 	pyVersion := cfg.PyVersion
 	if pyVersion == "" {
-		pyVersion = binaryVersion
+		if pyVersion, err = normalizeVersion(rel.Tag); err != nil {
+			return err
+		}
+	}
+	if cfg.Upload {
+		if err := checkUploadVersion(pyVersion); err != nil {
+			return err
+		}
+	}
+	built, _ := buildRelease(cfg, rel, pyVersion, in)
+
+	slog.Info("done", "wheels_built", len(built), "output_dir", cfg.Output)
+	return nil
+}
+
+// buildInputs holds what every release build shares: the license and
+// description files, the PyPI password and the -include globs.
+type buildInputs struct {
+	licenseData     []byte
+	descriptionData []byte
+	pypiPassword    string
+	include         []includeSpec
+}
+
+// fetchedBinary is the binary of one asset, with the files -include adds.
+type fetchedBinary struct {
+	file  *os.File     // temporary file holding the binary
+	name  string       // filename of the binary
+	extra []wheelEntry // -include files, named as buildWheel expects
+}
+
+// section returns a reader of the whole binary.
+func (fb fetchedBinary) section() (*io.SectionReader, error) {
+	st, err := fb.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	return io.NewSectionReader(fb.file, 0, st.Size()), nil
+}
+
+// remove closes and deletes the temporary binary file.
+func (fb fetchedBinary) remove() {
+	fb.file.Close()
+	os.Remove(fb.file.Name())
+}
+
+// createBinaryTemp creates the temporary file a binary is written to.
+func createBinaryTemp() (*os.File, error) {
+	f, err := os.CreateTemp("", ".buildwheels-binary-*")
+	if err != nil {
+		return nil, fmt.Errorf("create temp file: %w", err)
+	}
+	return f, nil
+}
+
+// fetchBinary downloads the asset of ae and extracts its binary into a
+// temporary file, which the caller must remove, together with the files
+// matching include. A universal entry is built by fetching each of its thin
+// binaries and combining them; its other files come from the first. With
+// cfg.InferBinary set, an archive without ae.BinaryInArc yields its only
+// executable instead.
+func fetchBinary(ae assetEntry, cacheDir string, cfg *Config, include []includeSpec) (fetchedBinary, error) {
+	if len(ae.Universal) > 0 {
+		return fetchUniversal(ae, cacheDir, cfg, include)
+	}
+
+	dl, err := downloadAsset(ae, cacheDir)
+	if err != nil {
+		return fetchedBinary{}, fmt.Errorf("download: %w", err)
 	}
+	defer dl.remove()
+	archive, src, err := dl.open()
+	if err != nil {
+		return fetchedBinary{}, fmt.Errorf("download: %w", err)
+	}
+	defer archive.Close()
+
+	out, err := createBinaryTemp()
+	if err != nil {
+		return fetchedBinary{}, err
+	}
+	fb := fetchedBinary{file: out}
+	binInArc := ae.BinaryInArc
+	err = extractBinary(src, ae.ArchiveExt, binInArc, out)
+	if errors.Is(err, errBinaryNotFound) && cfg.InferBinary {
+		inferred, inferErr := inferBinary(src, ae.ArchiveExt)
+		if inferErr != nil {
+			fb.remove()
+			return fetchedBinary{}, fmt.Errorf("extract: %w; %v", err, inferErr)
+		}
+		slog.Info("inferred binary from archive contents", "asset", ae.AssetName, "binary", inferred)
+		binInArc = inferred
+		err = extractBinary(src, ae.ArchiveExt, binInArc, out)
+	}
+	if err != nil {
+		fb.remove()
+		return fetchedBinary{}, fmt.Errorf("extract: %w", err)
+	}
+	fb.name = path.Base(binInArc)
+	fb.extra, err = collectIncludes(src, ae.ArchiveExt, binInArc, cfg.EntryPoint, include)
+	if err != nil {
+		fb.remove()
+		return fetchedBinary{}, fmt.Errorf("include: %w", err)
+	}
+	return fb, nil
+}
+
+// fetchUniversal fetches the thin binaries of a universal entry and combines
+// them into a fat one.
+func fetchUniversal(ae assetEntry, cacheDir string, cfg *Config, include []includeSpec) (fetchedBinary, error) {
+	var fb fetchedBinary
+	thin := make([]*io.SectionReader, len(ae.Universal))
+	for i, part := range ae.Universal {
+		pb, err := fetchBinary(part, cacheDir, cfg, include)
+		if err != nil {
+			return fetchedBinary{}, err
+		}
+		defer pb.remove()
+		if thin[i], err = pb.section(); err != nil {
+			return fetchedBinary{}, err
+		}
+		if i == 0 {
+			fb = pb
+		}
+	}
+	out, err := createBinaryTemp()
+	if err != nil {
+		return fetchedBinary{}, err
+	}
+	fb.file = out
+	if err := lipo(out, thin...); err != nil {
+		fb.remove()
+		return fetchedBinary{}, err
+	}
+	return fb, nil
+}
+
+// buildFetchedWheel builds the wheel of a fetched binary for ae.
+func buildFetchedWheel(fb fetchedBinary, ae assetEntry, binaryVersion string, cfg *Config, pyVersion string, descriptionData, licenseData []byte) (string, error) {
+	binary, err := fb.section()
+	if err != nil {
+		return "", err
+	}
+	plat := wheelPlatformTag(ae, binary, cfg.Musllinux)
+	return buildWheel(
+		binary, fb.name, binaryVersion,
+		cfg, pyVersion, plat,
+		descriptionData, licenseData,
+		fb.extra...,
+	)
+}
+
+// buildRelease runs the download/extract/build (and optional upload) loop for
+// the resolved assets of one release. It returns the paths of the wheels
+// built and the number of assets that failed.
+func buildRelease(cfg *Config, rel resolvedRelease, pyVersion string, in buildInputs) (built []string, failed int) {
+	binaryVersion := strings.TrimPrefix(rel.Tag, "v")
 	slog.Info("resolved release",
 		"binary_version", binaryVersion,
 		"py_version", pyVersion,
 	)
 
-	// Log available asset names at debug so mismatches are immediately obvious.
-	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
-		names := make([]string, len(rel.Assets))
-		for i, a := range rel.Assets {
-			names[i] = a.Name
-		}
-		slog.Debug("release assets available", "count", len(names), "assets", names)
+	if len(rel.Assets) == 0 {
+		slog.Warn("no matching assets found in release", "tag", rel.Tag)
 	}
 
-	// Decide which assets to process.
-	var assetURLs []assetEntry
-	if len(cfg.AssetNames) > 0 {
-		assetURLs = resolveAssetsByName(rel.Assets, cfg.AssetNames)
-	} else {
-		assetURLs = resolveAssetsByPlatform(rel.Assets, cfg.BinaryName, binaryVersion, cfg.Platforms)
+	descriptionData := in.descriptionData
+	if cfg.ReleaseNotes {
+		descriptionData = appendReleaseNotes(descriptionData, rel.Tag, rel.Notes, cfg.ReleaseNotesMax, releasePageURL(cfg, rel.Tag))
 	}
 
-	if len(assetURLs) == 0 {
-		slog.Warn("no matching assets found in release", "tag", rel.TagName)
-	}
-
-	var built []string
-	for _, ae := range assetURLs {
+	for _, ae := range rel.Assets {
 		slog.Info("building wheel",
 			"platform", ae.PlatformKey,
 			"wheel_tag", ae.WheelTag,
@@ -215,33 +524,27 @@ func run(cfg *Config) error {
 			cacheDir = filepath.Join(cfg.CacheDir, binaryVersion)
 		}
 
-		archiveData, err := cachedDownload(ae.URL, cacheDir)
+		fb, err := fetchBinary(ae, cacheDir, cfg, in.include)
 		if err != nil {
-			slog.Error("download failed", "asset", ae.AssetName, "error", err)
+			slog.Error("could not get binary", "asset", ae.AssetName, "error", err)
+			failed++
 			continue
 		}
 
-		binaryData, err := extractBinary(archiveData, ae.ArchiveExt, ae.BinaryInArc)
-		if err != nil {
-			slog.Error("extraction failed", "asset", ae.AssetName, "error", err)
-			continue
-		}
-
-		outPath, err := buildWheel(
-			binaryData, ae.BinaryInArc, binaryVersion,
-			cfg, pyVersion, ae.WheelTag,
-			descriptionData, licenseData,
-		)
+		outPath, err := buildFetchedWheel(fb, ae, binaryVersion, cfg, pyVersion, descriptionData, in.licenseData)
+		fb.remove()
 		if err != nil {
 			slog.Error("wheel build failed", "platform", ae.PlatformKey, "error", err)
+			failed++
 			continue
 		}
 		slog.Info("wheel built", "file", filepath.Base(outPath))
 
 		if cfg.Upload {
 			slog.Info("uploading wheel", "file", filepath.Base(outPath), "pypi_url", cfg.PyPIURL)
-			if err := uploadToPyPI(outPath, cfg.PackageName, pyVersion, cfg.PyPIURL, cfg.PyPIUser, pypiPassword); err != nil {
+			if err := uploadToPyPI(outPath, cfg.PackageName, pyVersion, cfg.PyPIURL, cfg.PyPIUser, in.pypiPassword); err != nil {
 				slog.Error("upload failed", "file", filepath.Base(outPath), "error", err)
+				failed++
 				continue
 			}
 			slog.Info("wheel uploaded", "file", filepath.Base(outPath))
@@ -249,7 +552,5 @@ func run(cfg *Config) error {
 
 		built = append(built, outPath)
 	}
-
-	slog.Info("done", "wheels_built", len(built), "output_dir", cfg.Output)
-	return nil
+	return built, failed
 }
@@ -0,0 +1,289 @@
+// oci.go — OCI content model and manifest resolution, shared by the registry
+// client (ociregistry.go) and the image layout reader (ocilayout.go).
+//
+// Binaries are read from two shapes of OCI content:
+//
+//   - ORAS artifacts: layers carrying an org.opencontainers.image.title
+//     annotation. Archive titles (tool_1.0.0_Linux_x86_64.tar.gz) are
+//     matched like release assets; a layer titled with the binary name is
+//     the binary itself.
+//   - Container images: the binary is read from the top layer of each
+//     platform's image, which is where `COPY tool /` in a FROM scratch or
+//     distroless Dockerfile puts it.
+//
+// Multi-platform content is an image index whose entries carry platform
+// os/architecture fields; each is mapped onto knownPlatforms by GOOS/GOARCH.
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"sort"
+	"strings"
+)
+
+// OCI and Docker media types and annotations we read.
+const (
+	ociIndexType       = "application/vnd.oci.image.index.v1+json"
+	ociManifestType    = "application/vnd.oci.image.manifest.v1+json"
+	dockerListType     = "application/vnd.docker.distribution.manifest.list.v2+json"
+	dockerManifestType = "application/vnd.docker.distribution.manifest.v2+json"
+
+	ociTitleAnnotation   = "org.opencontainers.image.title"
+	ociRefNameAnnotation = "org.opencontainers.image.ref.name"
+	ociVersionAnnotation = "org.opencontainers.image.version"
+)
+
+// ociDescriptor references a manifest or blob by digest.
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Platform    *ociPlatform      `json:"platform,omitempty"`
+}
+
+// ociPlatform is the platform of an image index entry or image config.
+type ociPlatform struct {
+	OS           string `json:"os"`
+	Architecture string `json:"architecture"`
+	Variant      string `json:"variant,omitempty"`
+}
+
+// ociManifest covers both image indexes (Manifests set) and image manifests
+// (Config and Layers set), in their OCI and Docker flavours.
+type ociManifest struct {
+	MediaType   string            `json:"mediaType"`
+	Manifests   []ociDescriptor   `json:"manifests"`
+	Config      ociDescriptor     `json:"config"`
+	Layers      []ociDescriptor   `json:"layers"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+// ociStore is where manifests and blobs are read from: a registry or an
+// image layout directory.
+type ociStore interface {
+	// fetchManifest returns the manifest or index with the given digest (or,
+	// for registries, tag). Content fetched by digest is verified against it.
+	fetchManifest(ref string) ([]byte, error)
+	// fetchBlob returns a small blob such as an image config, verified
+	// against its digest.
+	fetchBlob(digest string) ([]byte, error)
+	// blobURL returns the URL downloadAsset fetches a layer from.
+	blobURL(digest string) string
+}
+
+// ociDigestHash returns a new hash for the algorithm of digest
+// ("sha256:<hex>" or "sha512:<hex>") and the hex sum it must produce.
+func ociDigestHash(digest string) (hash.Hash, string, error) {
+	alg, want, _ := strings.Cut(digest, ":")
+	var h hash.Hash
+	switch alg {
+	case "sha256":
+		h = sha256.New()
+	case "sha512":
+		h = sha512.New()
+	default:
+		return nil, "", fmt.Errorf("unsupported digest %q", digest)
+	}
+	if _, err := hex.DecodeString(want); err != nil || len(want) != 2*h.Size() || strings.ToLower(want) != want {
+		return nil, "", fmt.Errorf("malformed digest %q", digest)
+	}
+	return h, want, nil
+}
+
+// verifyOCIDigest checks that data is the content addressed by digest.
+func verifyOCIDigest(data []byte, digest string) error {
+	h, want, err := ociDigestHash(digest)
+	if err != nil {
+		return err
+	}
+	h.Write(data)
+	if hex.EncodeToString(h.Sum(nil)) != want {
+		return fmt.Errorf("content does not match digest %s", digest)
+	}
+	return nil
+}
+
+// ociDigestReader hashes what is read through it. The read that reaches EOF
+// fails when the content does not match the digest, so a blob streamed into
+// the cache is never committed unless it is the one its descriptor names.
+type ociDigestReader struct {
+	io.ReadCloser
+	h      hash.Hash
+	digest string
+	want   string
+}
+
+// newOCIDigestReader wraps rc to be checked against digest.
+func newOCIDigestReader(rc io.ReadCloser, digest string) (io.ReadCloser, error) {
+	h, want, err := ociDigestHash(digest)
+	if err != nil {
+		return nil, err
+	}
+	return &ociDigestReader{ReadCloser: rc, h: h, digest: digest, want: want}, nil
+}
+
+func (r *ociDigestReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.h.Write(p[:n])
+	if err == io.EOF && hex.EncodeToString(r.h.Sum(nil)) != r.want {
+		return n, fmt.Errorf("content does not match digest %s", r.digest)
+	}
+	return n, err
+}
+
+// resolveOCIManifest turns a top-level index or manifest into asset entries.
+func resolveOCIManifest(store ociStore, data []byte, tag string, cfg *Config) ([]assetEntry, error) {
+	var m ociManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("decode manifest: %w", err)
+	}
+	if len(m.Manifests) > 0 {
+		return resolveOCIIndex(store, m, cfg)
+	}
+
+	// A single manifest of titled archives (one ORAS push of every
+	// platform's archive) is matched by filename like a release. Bare
+	// binaries count only when their title names a platform.
+	var assets []ghAsset
+	for _, l := range m.Layers {
+		title := l.Annotations[ociTitleAnnotation]
+		ext := detectArchiveExt(title)
+		if ext == "raw" {
+			if _, _, _, ok := parsePlatform(title); !ok {
+				continue
+			}
+		}
+		if ext != "" {
+			assets = append(assets, ghAsset{Name: title, BrowserDownloadURL: store.blobURL(l.Digest), Digest: l.Digest})
+		}
+	}
+	if len(assets) > 0 {
+		if len(cfg.AssetNames) > 0 {
+			return resolveAssetsByName(assets, cfg.AssetNames, cfg.BinaryName), nil
+		}
+		return resolveAssetsByPlatform(assets, cfg.BinaryName, strings.TrimPrefix(tag, "v"), cfg.Platforms), nil
+	}
+
+	// Otherwise it is a single-platform image, described by its config.
+	cfgData, err := store.fetchBlob(m.Config.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("fetch image config: %w", err)
+	}
+	var plat ociPlatform
+	if err := json.Unmarshal(cfgData, &plat); err != nil {
+		return nil, fmt.Errorf("decode image config: %w", err)
+	}
+	platKey, ok := platformKeyFor(plat.OS, plat.Architecture, strings.TrimPrefix(plat.Variant, "v"))
+	if !ok || !buildWantedSet(cfg.Platforms)[platKey] {
+		slog.Warn("image platform not wanted, skipping", "os", plat.OS, "arch", plat.Architecture)
+		return nil, nil
+	}
+	if ae, ok := ociLayerEntry(store, m, platKey, cfg.BinaryName); ok {
+		return []assetEntry{ae}, nil
+	}
+	return nil, nil
+}
+
+// resolveOCIIndex picks one manifest per wanted platform from an image index
+// by its platform field. Entries without a known platform (attestations,
+// unknown/unknown) are skipped, as are later duplicates of a platform.
+func resolveOCIIndex(store ociStore, index ociManifest, cfg *Config) ([]assetEntry, error) {
+	wanted := buildWantedSet(cfg.Platforms)
+	seen := map[string]bool{}
+
+	var result []assetEntry
+	for _, d := range index.Manifests {
+		if d.Platform == nil {
+			continue
+		}
+		platKey, ok := platformKeyFor(d.Platform.OS, d.Platform.Architecture, strings.TrimPrefix(d.Platform.Variant, "v"))
+		if !ok {
+			slog.Debug("no wheel platform for index entry, skipping", "os", d.Platform.OS, "arch", d.Platform.Architecture)
+			continue
+		}
+		if !wanted[platKey] || seen[platKey] {
+			continue
+		}
+		seen[platKey] = true
+
+		data, err := store.fetchManifest(d.Digest)
+		if err != nil {
+			return nil, fmt.Errorf("fetch %s manifest: %w", platKey, err)
+		}
+		var m ociManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return nil, fmt.Errorf("decode %s manifest: %w", platKey, err)
+		}
+		if ae, ok := ociLayerEntry(store, m, platKey, cfg.BinaryName); ok {
+			result = append(result, ae)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].PlatformKey < result[j].PlatformKey })
+	return result, nil
+}
+
+// ociLayerEntry chooses the layer of a single-platform manifest that holds
+// the binary: a titled archive or bare binary if there is one, otherwise the
+// top image layer.
+func ociLayerEntry(store ociStore, m ociManifest, platKey, binaryName string) (assetEntry, bool) {
+	def := knownPlatforms[platKey]
+	binInArc := def.binaryInArchive(binaryName)
+	entry := func(l ociDescriptor, name, ext string) assetEntry {
+		return assetEntry{
+			PlatformKey: platKey,
+			WheelTag:    def.wheelTag,
+			ArchiveExt:  ext,
+			BinaryInArc: binInArc,
+			AssetName:   name,
+			URL:         store.blobURL(l.Digest),
+			Digest:      l.Digest,
+		}
+	}
+
+	for _, l := range m.Layers {
+		title := l.Annotations[ociTitleAnnotation]
+		if ext := detectArchiveExt(title); ext != "" && ext != "raw" {
+			return entry(l, title, ext), true
+		}
+		if title == binInArc {
+			return entry(l, platKey+"_"+title, "raw"), true
+		}
+	}
+
+	if len(m.Layers) == 0 {
+		slog.Warn("manifest has no layers, skipping", "platform", platKey)
+		return assetEntry{}, false
+	}
+	top := m.Layers[len(m.Layers)-1]
+	ext := ociLayerExt(top.MediaType)
+	if ext == "" {
+		slog.Warn("unsupported layer media type, skipping", "platform", platKey, "media_type", top.MediaType)
+		return assetEntry{}, false
+	}
+	_, hex, _ := strings.Cut(top.Digest, ":")
+	if len(hex) > 12 {
+		hex = hex[:12]
+	}
+	return entry(top, fmt.Sprintf("%s_layer_%s.%s", platKey, hex, ext), ext), true
+}
+
+// ociLayerExt maps an image layer media type to an archive extension.
+func ociLayerExt(mediaType string) string {
+	switch {
+	case strings.HasSuffix(mediaType, ".tar+gzip"), strings.HasSuffix(mediaType, ".tar.gzip"):
+		return "tar.gz"
+	case strings.HasSuffix(mediaType, ".tar+zstd"):
+		return "tar.zst"
+	case strings.HasSuffix(mediaType, ".tar"):
+		return "tar"
+	}
+	return ""
+}
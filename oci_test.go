@@ -0,0 +1,259 @@
+// oci_test.go
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ociBlob marshals v (unless it already is []byte) and returns the bytes
+// with their digest.
+func ociBlob(t *testing.T, v any) ([]byte, string) {
+	t.Helper()
+	data, ok := v.([]byte)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(v); err != nil {
+			t.Fatalf("marshal: %v", err)
+		}
+	}
+	sum := sha256.Sum256(data)
+	return data, "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// testRegistry is an in-process stand-in for an OCI distribution registry
+// serving one repository. When token is set, every /v2/ request needs it as
+// a Bearer token, which is handed out by /token.
+type testRegistry struct {
+	t        *testing.T
+	name     string
+	token    string
+	blobs    map[string][]byte // digest → content, manifests included
+	tags     map[string]string // tag → manifest digest
+	tagOrder []string
+}
+
+func newTestRegistry(t *testing.T, name string) *testRegistry {
+	return &testRegistry{t: t, name: name, blobs: map[string][]byte{}, tags: map[string]string{}}
+}
+
+// add stores v as a blob and returns its descriptor.
+func (tr *testRegistry) add(mediaType string, v any) ociDescriptor {
+	data, digest := ociBlob(tr.t, v)
+	tr.blobs[digest] = data
+	return ociDescriptor{MediaType: mediaType, Digest: digest, Size: int64(len(data))}
+}
+
+// tag points tag at the manifest d.
+func (tr *testRegistry) tag(tag string, d ociDescriptor) {
+	tr.tags[tag] = d.Digest
+	tr.tagOrder = append(tr.tagOrder, tag)
+}
+
+func (tr *testRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		json.NewEncoder(w).Encode(map[string]string{"token": tr.token})
+		return
+	}
+	if tr.token != "" && r.Header.Get("Authorization") != "Bearer "+tr.token {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="http://`+r.Host+`/token",service="test",scope="repository:`+tr.name+`:pull"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	prefix := "/v2/" + tr.name + "/"
+	rest, ok := strings.CutPrefix(r.URL.Path, prefix)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	switch {
+	case rest == "tags/list":
+		json.NewEncoder(w).Encode(map[string]any{"name": tr.name, "tags": tr.tagOrder})
+	case strings.HasPrefix(rest, "manifests/"):
+		ref := strings.TrimPrefix(rest, "manifests/")
+		if d, ok := tr.tags[ref]; ok {
+			ref = d
+		}
+		data, ok := tr.blobs[ref]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	case strings.HasPrefix(rest, "blobs/"):
+		data, ok := tr.blobs[strings.TrimPrefix(rest, "blobs/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write(data)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// serve starts the registry and returns the -repo value for it.
+func (tr *testRegistry) serve() string {
+	srv := httptest.NewServer(tr)
+	tr.t.Cleanup(srv.Close)
+	orig := hostCredentials
+	hostCredentials = map[string]string{}
+	tr.t.Cleanup(func() { hostCredentials = orig })
+	return strings.TrimPrefix(srv.URL, "http://") + "/" + tr.name
+}
+
+// addImage stores a two-layer image for os/arch whose top layer holds the
+// binary and returns its manifest descriptor with the platform set.
+func (tr *testRegistry) addImage(goos, goarch string, binary []byte) ociDescriptor {
+	base := tr.add("application/vnd.oci.image.layer.v1.tar+gzip", makeTarGz(tr.t, map[string][]byte{"etc/passwd": []byte("root")}))
+	top := tr.add("application/vnd.oci.image.layer.v1.tar+gzip", makeTarGz(tr.t, map[string][]byte{"usr/local/bin/tool": binary}))
+	config := tr.add("application/vnd.oci.image.config.v1+json", ociPlatform{OS: goos, Architecture: goarch})
+	d := tr.add(ociManifestType, ociManifest{MediaType: ociManifestType, Config: config, Layers: []ociDescriptor{base, top}})
+	d.Platform = &ociPlatform{OS: goos, Architecture: goarch}
+	return d
+}
+
+func TestResolveOCIRegistry_ImageIndex(t *testing.T) {
+	tr := newTestRegistry(t, "org/tool")
+	tr.token = "pull-token"
+	amd64 := tr.addImage("linux", "amd64", []byte("amd64 binary"))
+	arm64 := tr.addImage("linux", "arm64", []byte("arm64 binary"))
+	attestation := tr.add(ociManifestType, ociManifest{MediaType: ociManifestType})
+	attestation.Platform = &ociPlatform{OS: "unknown", Architecture: "unknown"}
+	tr.tag("v1.2.0", tr.add(ociIndexType, ociManifest{
+		MediaType: ociIndexType,
+		Manifests: []ociDescriptor{amd64, arm64, attestation},
+	}))
+	repo := tr.serve()
+
+	tag, entries, err := resolveOCIRegistry(&Config{Source: sourceOCI, Repo: repo, Version: "v1.2.0", BinaryName: "tool"})
+	if err != nil {
+		t.Fatalf("resolveOCIRegistry: %v", err)
+	}
+	if tag != "v1.2.0" {
+		t.Errorf("tag = %q, want v1.2.0", tag)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(entries), entries)
+	}
+	if entries[0].PlatformKey != "Linux_arm64" || entries[1].PlatformKey != "Linux_x86_64" {
+		t.Errorf("platforms = %s, %s", entries[0].PlatformKey, entries[1].PlatformKey)
+	}
+
+	// Layer downloads go through the normal pipeline with the pull token.
+	ae := entries[1]
+	if ae.ArchiveExt != "tar.gz" || ae.BinaryInArc != "tool" {
+		t.Errorf("entry = %+v", ae)
+	}
+	cacheDir := t.TempDir()
+	archive, err := downloadBytes(downloadAsset(ae, cacheDir))
+	if err != nil {
+		t.Fatalf("downloadAsset: %v", err)
+	}
+	bin, err := extract(archive, ae.ArchiveExt, ae.BinaryInArc)
+	if err != nil {
+		t.Fatalf("extractBinary: %v", err)
+	}
+	if string(bin) != "amd64 binary" {
+		t.Errorf("binary = %q", bin)
+	}
+	if _, err := os.Stat(filepath.Join(cacheDir, ae.AssetName)); err != nil {
+		t.Errorf("expected layer cached under its asset name: %v", err)
+	}
+}
+
+func TestResolveOCIRegistry_ORASArchives(t *testing.T) {
+	tr := newTestRegistry(t, "tool")
+	var layers []ociDescriptor
+	for _, name := range []string{"tool_2.0.0_Linux_x86_64.tar.gz", "tool_2.0.0_Windows_x86_64.zip", "checksums.txt"} {
+		l := tr.add("application/vnd.oci.image.layer.v1.tar", []byte(name))
+		l.Annotations = map[string]string{ociTitleAnnotation: name}
+		layers = append(layers, l)
+	}
+	config := tr.add("application/vnd.oci.empty.v1+json", []byte("{}"))
+	tr.tag("v2.0.0", tr.add(ociManifestType, ociManifest{MediaType: ociManifestType, Config: config, Layers: layers}))
+	repo := tr.serve()
+
+	_, entries, err := resolveOCIRegistry(&Config{Source: sourceOCI, Repo: repo, Version: "v2.0.0", BinaryName: "tool"})
+	if err != nil {
+		t.Fatalf("resolveOCIRegistry: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(entries), entries)
+	}
+	for _, ae := range entries {
+		data, err := downloadBytes(downloadAsset(ae, ""))
+		if err != nil {
+			t.Fatalf("downloadAsset(%s): %v", ae.AssetName, err)
+		}
+		if string(data) != ae.AssetName {
+			t.Errorf("%s: downloaded %q", ae.AssetName, data)
+		}
+	}
+}
+
+func TestDownloadAsset_OCIDigestMismatchNotCached(t *testing.T) {
+	tr := newTestRegistry(t, "tool")
+	l := tr.add("application/vnd.oci.image.layer.v1.tar", []byte("tool archive"))
+	l.Annotations = map[string]string{ociTitleAnnotation: "tool_2.0.0_Linux_x86_64.tar.gz"}
+	config := tr.add("application/vnd.oci.empty.v1+json", []byte("{}"))
+	tr.tag("v2.0.0", tr.add(ociManifestType, ociManifest{MediaType: ociManifestType, Config: config, Layers: []ociDescriptor{l}}))
+	repo := tr.serve()
+
+	_, entries, err := resolveOCIRegistry(&Config{Source: sourceOCI, Repo: repo, Version: "v2.0.0", BinaryName: "tool"})
+	if err != nil {
+		t.Fatalf("resolveOCIRegistry: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Digest != l.Digest {
+		t.Fatalf("entries = %+v, want one with digest %s", entries, l.Digest)
+	}
+
+	// The registry now serves different content under the layer's digest.
+	tr.blobs[l.Digest] = []byte("tampered archive")
+	cacheDir := t.TempDir()
+	if _, err := downloadAsset(entries[0], cacheDir); err == nil || !strings.Contains(err.Error(), "does not match digest") {
+		t.Fatalf("downloadAsset error = %v, want a digest mismatch", err)
+	}
+	if files, _ := os.ReadDir(cacheDir); len(files) != 0 {
+		t.Errorf("cache dir has %d files after a digest mismatch, want 0", len(files))
+	}
+}
+
+func TestFetchBlob_OCIDigestMismatch(t *testing.T) {
+	tr := newTestRegistry(t, "tool")
+	d := tr.add("application/vnd.oci.image.config.v1+json", ociPlatform{OS: "linux", Architecture: "amd64"})
+	tr.blobs[d.Digest] = []byte(`{"os":"windows","architecture":"amd64"}`)
+	reg := newOCIRegistry(tr.serve())
+	if _, err := reg.fetchBlob(d.Digest); err == nil {
+		t.Error("fetchBlob: expected a digest mismatch error")
+	}
+	if _, err := reg.fetchManifest(d.Digest); err == nil {
+		t.Error("fetchManifest by digest: expected a digest mismatch error")
+	}
+}
+
+func TestVerifyOCIDigest(t *testing.T) {
+	data, digest := ociBlob(t, []byte("blob"))
+	if err := verifyOCIDigest(data, digest); err != nil {
+		t.Errorf("matching content: %v", err)
+	}
+	for _, d := range []string{
+		"sha256:" + strings.Repeat("0", 64),
+		"md5:" + strings.Repeat("0", 32),
+		"sha256:../../etc/passwd",
+		strings.ToUpper(digest),
+		"",
+	} {
+		if err := verifyOCIDigest(data, d); err == nil {
+			t.Errorf("verifyOCIDigest(%q): expected error", d)
+		}
+	}
+}
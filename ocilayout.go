@@ -0,0 +1,100 @@
+// ocilayout.go — OCI image layout directories read through -from-dir.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ociLayout reads an OCI image layout directory (oci-layout, index.json and
+// blobs/), as written by `oras copy --to-oci-layout` or
+// `docker buildx build --output type=oci`.
+type ociLayout struct {
+	dir string
+}
+
+// isOCILayout reports whether dir is an OCI image layout.
+func isOCILayout(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, "oci-layout"))
+	return err == nil
+}
+
+func (l ociLayout) blobPath(digest string) string {
+	alg, hex, _ := strings.Cut(digest, ":")
+	return filepath.Join(l.dir, "blobs", alg, hex)
+}
+
+func (l ociLayout) fetchManifest(digest string) ([]byte, error) {
+	return l.fetchBlob(digest)
+}
+
+func (l ociLayout) fetchBlob(digest string) ([]byte, error) {
+	if _, _, err := ociDigestHash(digest); err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(l.blobPath(digest))
+	if err == nil {
+		err = verifyOCIDigest(data, digest)
+	}
+	return data, err
+}
+
+func (l ociLayout) blobURL(digest string) string {
+	p := l.blobPath(digest)
+	if abs, err := filepath.Abs(p); err == nil {
+		p = abs
+	}
+	return localFileURL(p)
+}
+
+// resolveOCILayout resolves the image tagged cfg.Version in the layout at
+// cfg.FromDir. Without -version a layout holding a single tagged image uses
+// that image and its tag; a layout whose index.json lists platform images
+// directly is read as one multi-platform image and needs -version.
+func resolveOCILayout(cfg *Config) (string, []assetEntry, error) {
+	layout := ociLayout{dir: cfg.FromDir}
+	indexData, err := os.ReadFile(filepath.Join(layout.dir, "index.json"))
+	if err != nil {
+		return "", nil, err
+	}
+	var index ociManifest
+	if err := json.Unmarshal(indexData, &index); err != nil {
+		return "", nil, fmt.Errorf("index.json: %w", err)
+	}
+
+	tag := cfg.Version
+	var top *ociDescriptor
+	for i, d := range index.Manifests {
+		name := d.Annotations[ociRefNameAnnotation]
+		if tag != "" && (name == tag || strings.HasSuffix(name, ":"+tag)) {
+			top = &index.Manifests[i]
+			break
+		}
+	}
+	if tag == "" && len(index.Manifests) == 1 {
+		top = &index.Manifests[0]
+		tag = top.Annotations[ociRefNameAnnotation]
+		if i := strings.LastIndex(tag, ":"); i >= 0 {
+			tag = tag[i+1:]
+		}
+	}
+	if tag == "" {
+		return "", nil, fmt.Errorf("-from-dir %s is an OCI layout without a single tagged image; -version is required", layout.dir)
+	}
+
+	data := indexData
+	if top != nil {
+		if data, err = layout.fetchManifest(top.Digest); err != nil {
+			return "", nil, err
+		}
+	} else if len(index.Manifests) == 0 || index.Manifests[0].Platform == nil {
+		return "", nil, fmt.Errorf("tag %q not found in %s/index.json", tag, layout.dir)
+	}
+	slog.Info("using OCI image layout", "dir", layout.dir, "tag", tag)
+	entries, err := resolveOCIManifest(layout, data, tag, cfg)
+	return tag, entries, err
+}
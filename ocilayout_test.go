@@ -0,0 +1,95 @@
+// ocilayout_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeOCILayout writes the blobs of tr as an OCI image layout whose
+// index.json lists the given descriptors, and returns its directory.
+func writeOCILayout(t *testing.T, tr *testRegistry, manifests ...ociDescriptor) string {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(p string, data []byte) {
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatalf("mkdir: %v", err)
+		}
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			t.Fatalf("write %s: %v", p, err)
+		}
+	}
+	write(filepath.Join(dir, "oci-layout"), []byte(`{"imageLayoutVersion":"1.0.0"}`))
+	index, _ := ociBlob(t, ociManifest{MediaType: ociIndexType, Manifests: manifests})
+	write(filepath.Join(dir, "index.json"), index)
+	for digest, data := range tr.blobs {
+		write(filepath.Join(dir, "blobs", "sha256", strings.TrimPrefix(digest, "sha256:")), data)
+	}
+	return dir
+}
+
+func TestResolveLocalDist_OCILayoutWithORASBinaries(t *testing.T) {
+	tr := newTestRegistry(t, "tool")
+	var platforms []ociDescriptor
+	for _, p := range []ociPlatform{{OS: "linux", Architecture: "amd64"}, {OS: "windows", Architecture: "amd64"}} {
+		title := "tool"
+		if p.OS == "windows" {
+			title = "tool.exe"
+		}
+		l := tr.add("application/vnd.oci.image.layer.v1.tar", []byte(p.OS+" binary"))
+		l.Annotations = map[string]string{ociTitleAnnotation: title}
+		config := tr.add("application/vnd.oci.empty.v1+json", []byte("{}"))
+		d := tr.add(ociManifestType, ociManifest{MediaType: ociManifestType, Config: config, Layers: []ociDescriptor{l}})
+		d.Platform = &ociPlatform{OS: p.OS, Architecture: p.Architecture}
+		platforms = append(platforms, d)
+	}
+	index := tr.add(ociIndexType, ociManifest{MediaType: ociIndexType, Manifests: platforms})
+	index.Annotations = map[string]string{ociRefNameAnnotation: "v0.9.0"}
+	dir := writeOCILayout(t, tr, index)
+
+	tag, entries, err := resolveLocalDist(&Config{FromDir: dir, BinaryName: "tool"})
+	if err != nil {
+		t.Fatalf("resolveLocalDist: %v", err)
+	}
+	if tag != "v0.9.0" {
+		t.Errorf("tag = %q, want v0.9.0 from ref.name", tag)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(entries), entries)
+	}
+	win := entries[1]
+	if win.PlatformKey != "Windows_x86_64" || win.ArchiveExt != "raw" || win.BinaryInArc != "tool.exe" {
+		t.Errorf("windows entry = %+v", win)
+	}
+	data, err := downloadBytes(downloadAsset(win, ""))
+	if err != nil {
+		t.Fatalf("downloadAsset: %v", err)
+	}
+	bin, err := extract(data, win.ArchiveExt, win.BinaryInArc)
+	if err != nil || string(bin) != "windows binary" {
+		t.Errorf("binary = %q, %v", bin, err)
+	}
+}
+
+func TestResolveLocalDist_OCILayoutUnknownTag(t *testing.T) {
+	tr := newTestRegistry(t, "tool")
+	img := tr.addImage("linux", "amd64", []byte("bin"))
+	img.Platform = nil
+	img.Annotations = map[string]string{ociRefNameAnnotation: "v1.0.0"}
+	dir := writeOCILayout(t, tr, img)
+
+	if _, _, err := resolveLocalDist(&Config{FromDir: dir, BinaryName: "tool", Version: "v2.0.0"}); err == nil {
+		t.Fatal("expected error for a tag missing from index.json")
+	}
+
+	// The single image is found without -version, from its image config.
+	tag, entries, err := resolveLocalDist(&Config{FromDir: dir, BinaryName: "tool"})
+	if err != nil {
+		t.Fatalf("resolveLocalDist: %v", err)
+	}
+	if tag != "v1.0.0" || len(entries) != 1 || entries[0].PlatformKey != "Linux_x86_64" {
+		t.Errorf("tag = %q, entries = %+v", tag, entries)
+	}
+}
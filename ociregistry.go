@@ -0,0 +1,304 @@
+// ociregistry.go — OCI distribution API client (-source oci).
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// ociRegistry is an OCI distribution API client for one repository.
+type ociRegistry struct {
+	base string // e.g. https://ghcr.io/v2/owner/tool
+	name string // repository name, e.g. owner/tool
+	auth string // Authorization header value, set after a 401 challenge
+}
+
+// newOCIRegistry parses ref, given as registry/name (ghcr.io/owner/tool,
+// localhost:5000/tool). As with docker pull, a first component without a dot
+// or port that is not "localhost" means Docker Hub. Loopback registries are
+// spoken to over plain HTTP.
+func newOCIRegistry(ref string) *ociRegistry {
+	host, name, _ := strings.Cut(ref, "/")
+	if !strings.ContainsAny(host, ".:") && host != "localhost" {
+		host, name = "docker.io", ref
+	}
+	if host == "docker.io" {
+		host = "registry-1.docker.io"
+		if !strings.Contains(name, "/") {
+			name = "library/" + name
+		}
+	}
+	scheme := "https"
+	if isLoopbackHost(host) {
+		scheme = "http"
+	}
+	return &ociRegistry{base: fmt.Sprintf("%s://%s/v2/%s", scheme, host, name), name: name}
+}
+
+// isLoopbackHost reports whether host (with optional port) is this machine.
+func isLoopbackHost(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.Trim(host, "[]")
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// get performs a GET against the registry. A 401 answer is met once with the
+// credential its WWW-Authenticate challenge asks for.
+func (r *ociRegistry) get(u string, accept ...string) ([]byte, http.Header, error) {
+	for attempt := 0; ; attempt++ {
+		slog.Debug("oci registry request", "url", u)
+		req, err := http.NewRequest(http.MethodGet, u, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, a := range accept {
+			req.Header.Add("Accept", a)
+		}
+		if r.auth != "" {
+			req.Header.Set("Authorization", r.auth)
+		}
+
+		resp, err := downloadClient.Do(req)
+		if err != nil {
+			return nil, nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if err := r.authorize(challenge); err != nil {
+				return nil, nil, err
+			}
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, nil, fmt.Errorf("OCI registry %s: %s", u, resp.Status)
+		}
+		data, err := io.ReadAll(resp.Body)
+		return data, resp.Header, err
+	}
+}
+
+// ociCredentials returns the registry username and password from the
+// environment. The password may also be a token.
+func ociCredentials() (user, pass string) {
+	return os.Getenv("OCI_USERNAME"), os.Getenv("OCI_PASSWORD")
+}
+
+// authorize answers a WWW-Authenticate challenge. Basic challenges use
+// OCI_USERNAME/OCI_PASSWORD directly; Bearer challenges exchange them (or
+// nothing, for anonymous pulls) for a pull token at the challenge's realm.
+// The result is also registered for layer downloads from the registry host.
+func (r *ociRegistry) authorize(challenge string) error {
+	user, pass := ociCredentials()
+	scheme, params := parseAuthChallenge(challenge)
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if user == "" {
+			return fmt.Errorf("OCI registry %s requires credentials: set OCI_USERNAME and OCI_PASSWORD", r.base)
+		}
+		r.auth = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+	case "bearer":
+		tok, err := r.fetchToken(params, user, pass)
+		if err != nil {
+			return err
+		}
+		r.auth = "Bearer " + tok
+	default:
+		return fmt.Errorf("OCI registry %s: unsupported authentication challenge %q", r.base, challenge)
+	}
+	registerCredential(r.base, r.auth)
+	return nil
+}
+
+// fetchToken requests a pull token from the realm of a Bearer challenge.
+func (r *ociRegistry) fetchToken(params map[string]string, user, pass string) (string, error) {
+	realm := params["realm"]
+	if realm == "" {
+		return "", fmt.Errorf("OCI registry %s: Bearer challenge without realm", r.base)
+	}
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + r.name + ":pull"
+	}
+	q := url.Values{"scope": {scope}}
+	if s := params["service"]; s != "" {
+		q.Set("service", s)
+	}
+	u := realm + "?" + q.Encode()
+	slog.Debug("oci token request", "url", u)
+
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return "", err
+	}
+	if user != "" {
+		req.SetBasicAuth(user, pass)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("OCI token %s: %s", realm, resp.Status)
+	}
+	var body struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("decode OCI token: %w", err)
+	}
+	if body.Token != "" {
+		return body.Token, nil
+	}
+	if body.AccessToken != "" {
+		return body.AccessToken, nil
+	}
+	return "", fmt.Errorf("OCI token %s: empty token", realm)
+}
+
+// parseAuthChallenge splits a WWW-Authenticate value such as
+// `Bearer realm="https://auth.example.com/token",service="registry"` into its
+// scheme and parameters. Quoted values may contain commas.
+func parseAuthChallenge(h string) (string, map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(h), " ")
+	params := map[string]string{}
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		key, after, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		var val string
+		if strings.HasPrefix(after, `"`) {
+			val, after, _ = strings.Cut(after[1:], `"`)
+		} else {
+			val, after, _ = strings.Cut(after, ",")
+			after = "," + after
+		}
+		params[strings.ToLower(strings.TrimSpace(key))] = val
+		rest = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(after), ","))
+	}
+	return scheme, params
+}
+
+func (r *ociRegistry) fetchManifest(ref string) ([]byte, error) {
+	data, _, err := r.get(r.base+"/manifests/"+ref, ociIndexType, ociManifestType, dockerListType, dockerManifestType)
+	if err == nil && strings.Contains(ref, ":") {
+		err = verifyOCIDigest(data, ref)
+	}
+	return data, err
+}
+
+func (r *ociRegistry) fetchBlob(digest string) ([]byte, error) {
+	data, _, err := r.get(r.blobURL(digest))
+	if err == nil {
+		err = verifyOCIDigest(data, digest)
+	}
+	return data, err
+}
+
+func (r *ociRegistry) blobURL(digest string) string {
+	return r.base + "/blobs/" + digest
+}
+
+// listTags returns every tag of the repository, following Link pagination.
+func (r *ociRegistry) listTags() ([]string, error) {
+	var tags []string
+	for u := r.base + "/tags/list"; u != ""; {
+		data, hdr, err := r.get(u)
+		if err != nil {
+			return nil, err
+		}
+		var page struct {
+			Tags []string `json:"tags"`
+		}
+		if err := json.Unmarshal(data, &page); err != nil {
+			return nil, fmt.Errorf("decode tags: %w", err)
+		}
+		tags = append(tags, page.Tags...)
+		u = nextLink(u, hdr.Get("Link"))
+	}
+	return tags, nil
+}
+
+// nextLink resolves the rel="next" target of a Link header against the
+// request URL, or returns "" when there is none.
+func nextLink(reqURL, link string) string {
+	if !strings.Contains(link, `rel="next"`) {
+		return ""
+	}
+	start, end := strings.Index(link, "<"), strings.Index(link, ">")
+	if start < 0 || end < start {
+		return ""
+	}
+	base, err := url.Parse(reqURL)
+	if err != nil {
+		return ""
+	}
+	next, err := base.Parse(link[start+1 : end])
+	if err != nil {
+		return ""
+	}
+	return next.String()
+}
+
+// resolveOCIRegistry resolves cfg.Version against the registry repository
+// cfg.Repo. Version queries are matched against the repository's tags.
+// Without -version the "latest" tag is used, and its version is read from
+// the org.opencontainers.image.version annotation.
+func resolveOCIRegistry(cfg *Config) (string, []assetEntry, error) {
+	reg := newOCIRegistry(cfg.Repo)
+	tag := cfg.Version
+	switch {
+	case tag == "":
+		tag = "latest"
+	case isReleaseQuery(tag):
+		slog.Info("resolving release query", "repo", cfg.Repo, "query", tag)
+		rels, err := listSourceReleases(cfg)
+		if err != nil {
+			return "", nil, err
+		}
+		rel, err := selectRelease(rels, tag)
+		if err != nil {
+			return "", nil, err
+		}
+		slog.Info("release query matched", "query", tag, "tag", rel.TagName)
+		tag = rel.TagName
+	}
+
+	slog.Info("fetching OCI manifest", "repo", cfg.Repo, "tag", tag)
+	data, err := reg.fetchManifest(tag)
+	if err != nil {
+		return "", nil, fmt.Errorf("fetch manifest: %w", err)
+	}
+	if cfg.Version == "" {
+		var m ociManifest
+		if err := json.Unmarshal(data, &m); err != nil {
+			return "", nil, fmt.Errorf("decode manifest: %w", err)
+		}
+		v := m.Annotations[ociVersionAnnotation]
+		if v == "" {
+			return "", nil, fmt.Errorf("tag %q has no %s annotation; pass -version", tag, ociVersionAnnotation)
+		}
+		slog.Info("latest tag resolved by annotation", "version", v)
+		tag = v
+	}
+	entries, err := resolveOCIManifest(reg, data, tag, cfg)
+	return tag, entries, err
+}
@@ -0,0 +1,91 @@
+// ociregistry_test.go
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestResolveOCIRegistry_VersionQuery(t *testing.T) {
+	tr := newTestRegistry(t, "tool")
+	for _, v := range []string{"v1.0.0", "v1.2.0", "v2.0.0-rc.1", "latest"} {
+		tr.tag(v, tr.add(ociIndexType, ociManifest{MediaType: ociIndexType, Manifests: []ociDescriptor{tr.addImage("linux", "amd64", []byte(v))}}))
+	}
+	repo := tr.serve()
+
+	tag, _, err := resolveOCIRegistry(&Config{Source: sourceOCI, Repo: repo, Version: "^1.0", BinaryName: "tool"})
+	if err != nil {
+		t.Fatalf("resolveOCIRegistry: %v", err)
+	}
+	if tag != "v1.2.0" {
+		t.Errorf("tag = %q, want v1.2.0", tag)
+	}
+}
+
+func TestResolveOCIRegistry_LatestUsesVersionAnnotation(t *testing.T) {
+	tr := newTestRegistry(t, "tool")
+	tr.tag("latest", tr.add(ociIndexType, ociManifest{
+		MediaType:   ociIndexType,
+		Manifests:   []ociDescriptor{tr.addImage("linux", "amd64", []byte("bin"))},
+		Annotations: map[string]string{ociVersionAnnotation: "3.1.0"},
+	}))
+	repo := tr.serve()
+
+	tag, entries, err := resolveOCIRegistry(&Config{Source: sourceOCI, Repo: repo, BinaryName: "tool"})
+	if err != nil {
+		t.Fatalf("resolveOCIRegistry: %v", err)
+	}
+	if tag != "3.1.0" || len(entries) != 1 {
+		t.Errorf("tag = %q, entries = %d; want 3.1.0 and 1", tag, len(entries))
+	}
+}
+
+func TestResolveOCIRegistry_LatestWithoutAnnotation(t *testing.T) {
+	tr := newTestRegistry(t, "tool")
+	tr.tag("latest", tr.add(ociIndexType, ociManifest{MediaType: ociIndexType, Manifests: []ociDescriptor{tr.addImage("linux", "amd64", []byte("bin"))}}))
+	repo := tr.serve()
+
+	_, _, err := resolveOCIRegistry(&Config{Source: sourceOCI, Repo: repo, BinaryName: "tool"})
+	if err == nil || !strings.Contains(err.Error(), "-version") {
+		t.Fatalf("err = %v, want a -version error", err)
+	}
+}
+
+func TestNewOCIRegistry(t *testing.T) {
+	tests := []struct {
+		ref, base string
+	}{
+		{"ghcr.io/owner/tool", "https://ghcr.io/v2/owner/tool"},
+		{"localhost:5000/tool", "http://localhost:5000/v2/tool"},
+		{"127.0.0.1:5000/a/b", "http://127.0.0.1:5000/v2/a/b"},
+		{"docker.io/alpine", "https://registry-1.docker.io/v2/library/alpine"},
+		{"owner/tool", "https://registry-1.docker.io/v2/owner/tool"},
+	}
+	for _, tt := range tests {
+		if got := newOCIRegistry(tt.ref).base; got != tt.base {
+			t.Errorf("newOCIRegistry(%q).base = %q, want %q", tt.ref, got, tt.base)
+		}
+	}
+}
+
+func TestParseAuthChallenge(t *testing.T) {
+	scheme, params := parseAuthChallenge(`Bearer realm="https://auth.example.com/token",service="registry.example.com",scope="repository:a/b:pull,push"`)
+	if scheme != "Bearer" {
+		t.Errorf("scheme = %q", scheme)
+	}
+	want := map[string]string{
+		"realm":   "https://auth.example.com/token",
+		"service": "registry.example.com",
+		"scope":   "repository:a/b:pull,push",
+	}
+	for k, v := range want {
+		if params[k] != v {
+			t.Errorf("params[%s] = %q, want %q", k, params[k], v)
+		}
+	}
+
+	scheme, params = parseAuthChallenge(`Basic realm=registry`)
+	if scheme != "Basic" || params["realm"] != "registry" {
+		t.Errorf("basic challenge = %q %v", scheme, params)
+	}
+}
@@ -6,35 +6,210 @@ import (
 	"fmt"
 	"log/slog"
 	"path"
+	"sort"
 	"strings"
+	"unicode"
 )
 
 // platformDef maps a GoReleaser OS_Arch key to the Python wheel platform tag
 // and archive format used for that target.
 type platformDef struct {
 	wheelTag   string // Python wheel platform tag
-	archiveExt string // "tar.gz" or "zip"
-	windows    bool   // whether the binary gets an .exe suffix
+	archiveExt string // default archive format, one of archiveFormats
+	exe        string // executable suffix of the binary, ".exe" on Windows
+	goos       string // Go GOOS value, e.g. "linux"
+	goarch     string // Go GOARCH value, e.g. "amd64"
+	goarm      string // Go GOARM value for goarch "arm", e.g. "7"; "" otherwise
+	binaryPath string // path of the binary in archives, with {binary} and {exe}; "" = basename {binary}{exe}
 }
 
-// knownPlatforms is the canonical set of supported build targets.
+// binaryInArchive returns the name of the binary called binaryName in this
+// target's archives.
+func (d platformDef) binaryInArchive(binaryName string) string {
+	if d.binaryPath != "" {
+		return strings.NewReplacer("{binary}", binaryName, "{exe}", d.exe).Replace(d.binaryPath)
+	}
+	if d.exe != "" && strings.HasSuffix(binaryName, d.exe) {
+		return binaryName
+	}
+	return binaryName + d.exe
+}
+
+// knownPlatforms is the canonical set of supported build targets. Keys follow
+// GoReleaser's widely used {{ title .Os }}_{{ .Arch }}{{ with .Arm }}v{{ . }}{{ end }}
+// spelling, with x86_64 for amd64 and i386 for 386. -platform-map replaces
+// or extends it (see platformmap.go).
+//
+// Darwin_all is a universal binary with x86_64 and arm64 slices (see
+// universal.go).
+//
+// ARMv6 has no manylinux tag, so its wheel carries the plain linux_armv6l
+// tag, which piwheels and private indexes accept but PyPI does not. Such
+// platforms are built only when -platforms names them (see buildWantedSet).
 var knownPlatforms = map[string]platformDef{
-	"Darwin_x86_64":  {"macosx_10_9_x86_64", "tar.gz", false},
-	"Darwin_arm64":   {"macosx_11_0_arm64", "tar.gz", false},
-	"Linux_x86_64":   {"manylinux_2_17_x86_64", "tar.gz", false},
-	"Linux_arm64":    {"manylinux_2_17_aarch64", "tar.gz", false},
-	"Windows_x86_64": {"win_amd64", "zip", true},
-	"Windows_arm64":  {"win_arm64", "zip", true},
+	"Darwin_x86_64":  {wheelTag: "macosx_10_9_x86_64", archiveExt: "tar.gz", goos: "darwin", goarch: "amd64"},
+	"Darwin_arm64":   {wheelTag: "macosx_11_0_arm64", archiveExt: "tar.gz", goos: "darwin", goarch: "arm64"},
+	"Darwin_all":     {wheelTag: "macosx_11_0_universal2", archiveExt: "tar.gz", goos: "darwin", goarch: "all"},
+	"Linux_x86_64":   {wheelTag: "manylinux_2_17_x86_64", archiveExt: "tar.gz", goos: "linux", goarch: "amd64"},
+	"Linux_arm64":    {wheelTag: "manylinux_2_17_aarch64", archiveExt: "tar.gz", goos: "linux", goarch: "arm64"},
+	"Linux_i386":     {wheelTag: "manylinux_2_17_i686", archiveExt: "tar.gz", goos: "linux", goarch: "386"},
+	"Linux_armv6":    {wheelTag: "linux_armv6l", archiveExt: "tar.gz", goos: "linux", goarch: "arm", goarm: "6"},
+	"Linux_armv7":    {wheelTag: "manylinux_2_17_armv7l", archiveExt: "tar.gz", goos: "linux", goarch: "arm", goarm: "7"},
+	"Linux_ppc64le":  {wheelTag: "manylinux_2_17_ppc64le", archiveExt: "tar.gz", goos: "linux", goarch: "ppc64le"},
+	"Linux_s390x":    {wheelTag: "manylinux_2_17_s390x", archiveExt: "tar.gz", goos: "linux", goarch: "s390x"},
+	"Linux_riscv64":  {wheelTag: "manylinux_2_31_riscv64", archiveExt: "tar.gz", goos: "linux", goarch: "riscv64"},
+	"Windows_x86_64": {wheelTag: "win_amd64", archiveExt: "zip", exe: ".exe", goos: "windows", goarch: "amd64"},
+	"Windows_arm64":  {wheelTag: "win_arm64", archiveExt: "zip", exe: ".exe", goos: "windows", goarch: "arm64"},
+	"Windows_i386":   {wheelTag: "win32", archiveExt: "zip", exe: ".exe", goos: "windows", goarch: "386"},
+}
+
+// defaultGoarm is the ARM version assumed when an asset or artifact names
+// plain "arm". It matches GoReleaser's default goarm, and ARMv6 binaries also
+// run on ARMv7.
+const defaultGoarm = "6"
+
+// osAliases maps the OS spellings found in asset names to GOOS.
+var osAliases = map[string]string{
+	"linux":   "linux",
+	"darwin":  "darwin",
+	"macos":   "darwin",
+	"osx":     "darwin",
+	"windows": "windows",
+	"win":     "windows",
+}
+
+// archAlias is the GOARCH (and, for 32-bit ARM, GOARM) an architecture
+// spelling stands for.
+type archAlias struct {
+	goarch, goarm string
+}
+
+// archAliases maps the architecture spellings found in asset names to
+// GOARCH/GOARM. "all" and "universal" name a macOS universal binary, which
+// runs on every Darwin architecture. GoReleaser's "arm_7" and "arm-v7"
+// spellings are joined into "armv7" by nameTokens.
+var archAliases = map[string]archAlias{
+	"amd64":     {"amd64", ""},
+	"x86_64":    {"amd64", ""},
+	"x64":       {"amd64", ""},
+	"arm64":     {"arm64", ""},
+	"aarch64":   {"arm64", ""},
+	"386":       {"386", ""},
+	"i386":      {"386", ""},
+	"i686":      {"386", ""},
+	"x86":       {"386", ""},
+	"arm":       {"arm", defaultGoarm},
+	"armv6":     {"arm", "6"},
+	"armv6l":    {"arm", "6"},
+	"armv7":     {"arm", "7"},
+	"armv7l":    {"arm", "7"},
+	"armhf":     {"arm", "7"},
+	"ppc64le":   {"ppc64le", ""},
+	"s390x":     {"s390x", ""},
+	"riscv64":   {"riscv64", ""},
+	"all":       {"all", ""},
+	"universal": {"all", ""},
+}
+
+// platformKeys returns the knownPlatforms keys in sorted order, so that
+// resolution does not depend on map iteration order.
+func platformKeys() []string {
+	keys := make([]string, 0, len(knownPlatforms))
+	for k := range knownPlatforms {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// nameTokens lower-cases name and splits it into alphanumeric tokens.
+// "x86_64" and "x86-64" are kept as one token, and an "arm" token followed by
+// an ARM version ("arm_7", "arm-v7") becomes "armv7".
+func nameTokens(name string) []string {
+	lower := strings.ToLower(name)
+	lower = strings.NewReplacer("x86_64", "amd64", "x86-64", "amd64").Replace(lower)
+	fields := strings.FieldsFunc(lower, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := fields[:0]
+	for i := 0; i < len(fields); i++ {
+		tok := fields[i]
+		if tok == "arm" && i+1 < len(fields) {
+			if v := strings.TrimPrefix(fields[i+1], "v"); len(v) == 1 && v >= "5" && v <= "7" {
+				tok = "armv" + v
+				i++
+			}
+		}
+		tokens = append(tokens, tok)
+	}
+	return tokens
+}
+
+// parsePlatform finds an OS and an architecture token in name, in any of the
+// spellings in osAliases and archAliases, and returns them as
+// GOOS/GOARCH/GOARM. When a token occurs more than once the last occurrence
+// wins, since the platform conventionally ends the name.
+func parsePlatform(name string) (goos, goarch, goarm string, ok bool) {
+	for _, tok := range nameTokens(name) {
+		if v, found := osAliases[tok]; found {
+			goos = v
+		}
+		if v, found := archAliases[tok]; found {
+			goarch, goarm = v.goarch, v.goarm
+		}
+	}
+	return goos, goarch, goarm, goos != "" && goarch != ""
+}
+
+// canonicalPlatformKey returns the knownPlatforms key for a platform written
+// in any common spelling, e.g. "linux_amd64", "macOS-arm64" or
+// "Linux_x86_64".
+func canonicalPlatformKey(s string) (string, bool) {
+	if _, ok := knownPlatforms[s]; ok {
+		return s, true
+	}
+	goos, goarch, goarm, ok := parsePlatform(s)
+	if !ok {
+		return "", false
+	}
+	return platformKeyFor(goos, goarch, goarm)
+}
+
+// platformKeyFor returns the knownPlatforms key for a GOOS/GOARCH/GOARM
+// triple. goarm only matters for goarch "arm", where "" means defaultGoarm.
+// When a -platform-map gives several keys the same triple, the first in
+// sorted order wins.
+func platformKeyFor(goos, goarch, goarm string) (string, bool) {
+	if goarch != "arm" {
+		goarm = ""
+	} else if goarm == "" {
+		goarm = defaultGoarm
+	}
+	for _, k := range platformKeys() {
+		def := knownPlatforms[k]
+		if def.goos == goos && def.goarch == goarch && def.goarm == goarm {
+			return k, true
+		}
+	}
+	return "", false
 }
 
 // assetEntry is a release asset fully resolved and ready to download.
 type assetEntry struct {
 	PlatformKey string // GoReleaser OS_Arch key, e.g. "Linux_x86_64"
 	WheelTag    string // Python wheel platform tag
-	ArchiveExt  string // "tar.gz" or "zip"
+	ArchiveExt  string // one of archiveFormats, or "raw"
 	BinaryInArc string // filename of the binary inside the archive
 	AssetName   string // GitHub release asset filename
 	URL         string // download URL
+	APIURL      string // GitHub asset API URL, used for authenticated downloads
+	AssetID     int64  // forge asset ID; a re-uploaded asset gets a new one
+	Digest      string // OCI content digest the download must match, if known
+
+	// Universal holds the thin Darwin entries whose binaries are combined
+	// into this entry's universal binary; the entry itself has no asset.
+	Universal []assetEntry
 }
 
 // resolveAssetsByPlatform matches release assets against knownPlatforms using
@@ -43,35 +218,49 @@ type assetEntry struct {
 // Patterns tried per platform (first match wins):
 //  1. {binary}_{version}_{OS_Arch}.{ext}
 //  2. {binary}_{OS_Arch}.{ext}  (no-version fallback)
+//  3. any {binary}<sep>...{os}<sep>{arch}.{ext} asset, with the OS and
+//     architecture in any spelling of osAliases/archAliases, e.g.
+//     {binary}_{version}_linux_amd64.tar.gz or {binary}-macOS-arm64.zip
 //
-// wantPlatforms filters by GoReleaser key; pass nil for all platforms.
+// A Darwin platform without its own asset falls back to a universal
+// ({binary}_darwin_all) one. wantPlatforms filters by platform key in any
+// spelling; pass nil for all platforms.
 func resolveAssetsByPlatform(assets []ghAsset, binaryName, version string, wantPlatforms []string) []assetEntry {
 	wanted := buildWantedSet(wantPlatforms)
 	idx := indexAssets(assets)
 
 	var result []assetEntry
-	for platKey, def := range knownPlatforms {
+	for _, platKey := range platformKeys() {
 		if !wanted[platKey] {
 			continue
 		}
+		def := knownPlatforms[platKey]
 
-		binInArc := binaryName
-		if def.windows {
-			binInArc = binaryName + ".exe"
-		}
+		binInArc := def.binaryInArchive(binaryName)
 
+		suffix := "." + def.archiveExt
+		if def.archiveExt == "raw" {
+			suffix = def.exe
+		}
 		// Primary pattern: {binary}_{version}_{OS_Arch}.{ext}
-		primary := fmt.Sprintf("%s_%s_%s.%s", binaryName, version, platKey, def.archiveExt)
+		primary := fmt.Sprintf("%s_%s_%s%s", binaryName, version, platKey, suffix)
 		// Fallback pattern: {binary}_{OS_Arch}.{ext}  (no version in filename)
-		fallback := fmt.Sprintf("%s_%s.%s", binaryName, platKey, def.archiveExt)
+		fallback := fmt.Sprintf("%s_%s%s", binaryName, platKey, suffix)
 
 		slog.Debug("trying asset names", "platform", platKey, "primary", primary, "fallback", fallback)
 
 		assetName := primary
-		url, ok := idx[primary]
+		asset, ok := idx[primary]
 		if !ok {
 			assetName = fallback
-			url, ok = idx[fallback]
+			asset, ok = idx[fallback]
+		}
+		if !ok {
+			asset, ok = matchAliasedAsset(assets, binaryName, version, def.goos, def.goarch, def.goarm)
+			if !ok && def.goos == "darwin" {
+				asset, ok = matchAliasedAsset(assets, binaryName, version, def.goos, "all", "")
+			}
+			assetName = asset.Name
 		}
 		if !ok {
 			slog.Debug("no asset found for platform, skipping",
@@ -82,27 +271,75 @@ func resolveAssetsByPlatform(assets []ghAsset, binaryName, version string, wantP
 			continue
 		}
 
+		ext := detectArchiveExt(assetName)
+		if ext == "" {
+			ext = def.archiveExt
+		}
 		result = append(result, assetEntry{
 			PlatformKey: platKey,
 			WheelTag:    def.wheelTag,
-			ArchiveExt:  def.archiveExt,
+			ArchiveExt:  ext,
 			BinaryInArc: binInArc,
 			AssetName:   assetName,
-			URL:         url,
+			URL:         asset.BrowserDownloadURL,
+			APIURL:      asset.URL,
+			AssetID:     asset.ID,
+			Digest:      asset.Digest,
 		})
 	}
 	return result
 }
 
+// matchAliasedAsset returns the asset of binaryName whose name parses as
+// goos/goarch/goarm. When several match, one naming version is preferred,
+// then an archive over a bare binary, then the first by name.
+func matchAliasedAsset(assets []ghAsset, binaryName, version, goos, goarch, goarm string) (ghAsset, bool) {
+	prefix := strings.ToLower(binaryName)
+	var matches []ghAsset
+	for _, a := range assets {
+		lower := strings.ToLower(a.Name)
+		rest, ok := strings.CutPrefix(lower, prefix)
+		if !ok || rest == "" || !strings.ContainsRune("_-.", rune(rest[0])) {
+			continue
+		}
+		if detectArchiveExt(a.Name) == "" {
+			continue
+		}
+		if gotOS, gotArch, gotArm, ok := parsePlatform(rest); ok && gotOS == goos && gotArch == goarch && gotArm == goarm {
+			matches = append(matches, a)
+		}
+	}
+	if len(matches) == 0 {
+		return ghAsset{}, false
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		vi := version != "" && strings.Contains(matches[i].Name, version)
+		vj := version != "" && strings.Contains(matches[j].Name, version)
+		if vi != vj {
+			return vi
+		}
+		ri := detectArchiveExt(matches[i].Name) == "raw"
+		rj := detectArchiveExt(matches[j].Name) == "raw"
+		if ri != rj {
+			return rj
+		}
+		return matches[i].Name < matches[j].Name
+	})
+	if len(matches) > 1 {
+		slog.Debug("several assets match platform, using first", "goos", goos, "goarch", goarch, "asset", matches[0].Name)
+	}
+	return matches[0], true
+}
+
 // resolveAssetsByName resolves a caller-specified list of asset filenames,
 // inferring platform metadata from the filename where possible. This is the
 // path taken when -assets is supplied on the CLI.
-func resolveAssetsByName(assets []ghAsset, assetNames []string) []assetEntry {
+func resolveAssetsByName(assets []ghAsset, assetNames []string, binaryName string) []assetEntry {
 	idx := indexAssets(assets)
 
 	var result []assetEntry
 	for _, name := range assetNames {
-		url, ok := idx[name]
+		asset, ok := idx[name]
 		if !ok {
 			slog.Warn("specified asset not found in release, skipping", "asset", name)
 			continue
@@ -111,11 +348,15 @@ func resolveAssetsByName(assets []ghAsset, assetNames []string) []assetEntry {
 		ext := detectArchiveExt(name)
 		platKey, wheelTag := inferPlatform(name)
 
-		// Binary name is the first underscore-delimited segment of the filename.
-		binBase := strings.SplitN(path.Base(name), "_", 2)[0]
+		// Without a binary name, guess the first underscore-delimited segment
+		// of the filename.
+		binBase := binaryName
+		if binBase == "" {
+			binBase = strings.SplitN(path.Base(name), "_", 2)[0]
+		}
 		binInArc := binBase
-		if strings.Contains(strings.ToLower(name), "windows") {
-			binInArc = binBase + ".exe"
+		if def, ok := knownPlatforms[platKey]; ok {
+			binInArc = def.binaryInArchive(binBase)
 		}
 
 		result = append(result, assetEntry{
@@ -124,61 +365,115 @@ func resolveAssetsByName(assets []ghAsset, assetNames []string) []assetEntry {
 			ArchiveExt:  ext,
 			BinaryInArc: binInArc,
 			AssetName:   name,
-			URL:         url,
+			URL:         asset.BrowserDownloadURL,
+			APIURL:      asset.URL,
+			AssetID:     asset.ID,
+			Digest:      asset.Digest,
 		})
 	}
 	return result
 }
 
-// detectArchiveExt returns "tar.gz", "zip", or "" based on the filename suffix.
+// detectArchiveExt returns the asset format named by the filename suffix:
+// "tar.gz" for .tar.gz and .tgz, "tar.xz", "tar.bz2", "tar.zst", "zip", a
+// single compressed binary ("gz", "xz", "bz2", "zst"), or "raw" for a bare
+// binary — a .exe or a name without a file extension. Other files, such as
+// checksums.txt, yield "".
 func detectArchiveExt(name string) string {
 	switch {
-	case strings.HasSuffix(name, ".tar.gz"):
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
 		return "tar.gz"
+	case strings.HasSuffix(name, ".tar.xz"):
+		return "tar.xz"
+	case strings.HasSuffix(name, ".tar.bz2"):
+		return "tar.bz2"
+	case strings.HasSuffix(name, ".tar.zst"):
+		return "tar.zst"
 	case strings.HasSuffix(name, ".zip"):
 		return "zip"
+	case strings.HasSuffix(name, ".gz"):
+		return "gz"
+	case strings.HasSuffix(name, ".xz"):
+		return "xz"
+	case strings.HasSuffix(name, ".bz2"):
+		return "bz2"
+	case strings.HasSuffix(name, ".zst"):
+		return "zst"
+	case strings.HasSuffix(name, ".exe"), !hasFileExt(name):
+		return "raw"
 	default:
 		return ""
 	}
 }
 
-// inferPlatform returns the best-matching GoReleaser platform key and Python
-// wheel tag for an asset filename that follows GoReleaser conventions.
-// Returns ("unknown", "any") when no match is found.
+// isArchiveName reports whether name is that of an archive or a compressed
+// binary, as opposed to a bare binary or an unrelated file.
+func isArchiveName(name string) bool {
+	ext := detectArchiveExt(name)
+	return ext != "" && ext != "raw"
+}
+
+// hasFileExt reports whether name ends in a file extension such as ".txt".
+// The dotted version of tool-1.2.3-linux-amd64 is not one: an extension is
+// alphanumeric and not all digits.
+func hasFileExt(name string) bool {
+	ext := strings.TrimPrefix(path.Ext(name), ".")
+	if ext == "" {
+		return false
+	}
+	digits := true
+	for _, r := range ext {
+		switch {
+		case r >= '0' && r <= '9':
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+			digits = false
+		default:
+			return false
+		}
+	}
+	return !digits
+}
+
+// inferPlatform returns the GoReleaser platform key and Python wheel tag for
+// an asset filename, recognising the OS and architecture in any spelling of
+// osAliases/archAliases. Returns ("unknown", "any") when no match is found.
 func inferPlatform(name string) (platKey, wheelTag string) {
-	lower := strings.ToLower(name)
-	for k, def := range knownPlatforms {
-		parts := strings.SplitN(strings.ToLower(k), "_", 2)
-		if len(parts) == 2 &&
-			strings.Contains(lower, parts[0]) &&
-			strings.Contains(lower, parts[1]) {
-			return k, def.wheelTag
+	if goos, goarch, goarm, ok := parsePlatform(name); ok {
+		if k, ok := platformKeyFor(goos, goarch, goarm); ok {
+			return k, knownPlatforms[k].wheelTag
 		}
 	}
 	return "unknown", "any"
 }
 
-// buildWantedSet converts a platform filter slice into a lookup set.
-// An empty slice means "all known platforms".
+// buildWantedSet converts a platform filter slice into a lookup set of
+// knownPlatforms keys. Entries may use any spelling canonicalPlatformKey
+// understands. An empty slice means every known platform whose wheel PyPI
+// accepts; one tagged plain linux_* (Linux_armv6) must be named explicitly.
 func buildWantedSet(platforms []string) map[string]bool {
 	s := make(map[string]bool, len(knownPlatforms))
 	if len(platforms) == 0 {
-		for k := range knownPlatforms {
+		for k, def := range knownPlatforms {
+			if strings.HasPrefix(def.wheelTag, "linux_") {
+				continue
+			}
 			s[k] = true
 		}
 		return s
 	}
-	for _, k := range platforms {
-		s[k] = true
+	for _, p := range platforms {
+		if k, ok := canonicalPlatformKey(p); ok {
+			s[k] = true
+		}
 	}
 	return s
 }
 
-// indexAssets builds a name→URL map from a slice of ghAsset for O(1) lookup.
-func indexAssets(assets []ghAsset) map[string]string {
-	m := make(map[string]string, len(assets))
+// indexAssets builds a name→asset map from a slice of ghAsset for O(1) lookup.
+func indexAssets(assets []ghAsset) map[string]ghAsset {
+	m := make(map[string]ghAsset, len(assets))
 	for _, a := range assets {
-		m[a.Name] = a.BrowserDownloadURL
+		m[a.Name] = a
 	}
 	return m
 }
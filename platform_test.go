@@ -6,11 +6,17 @@ import (
 )
 
 // assetList is a test helper that builds a []ghAsset from filenames,
-// using "https://example.com/<name>" as the download URL.
+// using "https://example.com/<name>" as the download URL and
+// "https://api.example.com/assets/<name>" as the API URL.
 func assetList(names ...string) []ghAsset {
 	out := make([]ghAsset, len(names))
 	for i, n := range names {
-		out[i] = ghAsset{Name: n, BrowserDownloadURL: "https://example.com/" + n}
+		out[i] = ghAsset{
+			ID:                 int64(i + 1),
+			Name:               n,
+			URL:                "https://api.example.com/assets/" + n,
+			BrowserDownloadURL: "https://example.com/" + n,
+		}
 	}
 	return out
 }
@@ -73,8 +79,9 @@ func TestResolveAssets_AllPlatformsWhenFilterEmpty(t *testing.T) {
 	}
 	assets := assetList(names...)
 	result := resolveAssetsByPlatform(assets, "mytool", "1.0.0", nil)
-	if len(result) != len(knownPlatforms) {
-		t.Errorf("expected %d entries for all platforms, got %d", len(knownPlatforms), len(result))
+	// Every platform but Linux_armv6, whose wheel PyPI rejects.
+	if len(result) != len(knownPlatforms)-1 {
+		t.Errorf("expected %d entries for all platforms, got %d", len(knownPlatforms)-1, len(result))
 	}
 }
 
@@ -100,6 +107,17 @@ func TestResolveAssets_NotFound(t *testing.T) {
 	}
 }
 
+func TestResolveAssets_APIURLSet(t *testing.T) {
+	assets := assetList("mytool_1.0.0_Linux_x86_64.tar.gz")
+	result := resolveAssetsByPlatform(assets, "mytool", "1.0.0", []string{"Linux_x86_64"})
+	if len(result) != 1 {
+		t.Fatalf("expected 1 entry, got %d", len(result))
+	}
+	if result[0].APIURL != "https://api.example.com/assets/mytool_1.0.0_Linux_x86_64.tar.gz" {
+		t.Errorf("unexpected API URL: %s", result[0].APIURL)
+	}
+}
+
 func TestResolveAssets_WheelTagSet(t *testing.T) {
 	assets := assetList("mytool_1.0.0_Linux_x86_64.tar.gz")
 	result := resolveAssetsByPlatform(assets, "mytool", "1.0.0", []string{"Linux_x86_64"})
@@ -111,6 +129,165 @@ func TestResolveAssets_WheelTagSet(t *testing.T) {
 	}
 }
 
+func TestResolveAssets_Aliases(t *testing.T) {
+	assets := assetList(
+		"mytool_1.2.3_linux_amd64.tar.gz",
+		"mytool_1.2.3_linux_aarch64.tar.gz",
+		"mytool-1.2.3-macOS-arm64.zip",
+		"mytool_osx_x64.tar.gz",
+		"mytool_1.2.3_win_x86_64.zip",
+		"mytool_1.2.3_checksums.txt",
+		"othertool_1.2.3_windows_arm64.zip",
+	)
+	got := resolveAssetsByPlatform(assets, "mytool", "1.2.3", nil)
+
+	want := map[string]string{
+		"Linux_x86_64":   "mytool_1.2.3_linux_amd64.tar.gz",
+		"Linux_arm64":    "mytool_1.2.3_linux_aarch64.tar.gz",
+		"Darwin_arm64":   "mytool-1.2.3-macOS-arm64.zip",
+		"Darwin_x86_64":  "mytool_osx_x64.tar.gz",
+		"Windows_x86_64": "mytool_1.2.3_win_x86_64.zip",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for _, e := range got {
+		if e.AssetName != want[e.PlatformKey] {
+			t.Errorf("%s: asset = %q, want %q", e.PlatformKey, e.AssetName, want[e.PlatformKey])
+		}
+	}
+	for _, e := range got {
+		if e.PlatformKey == "Darwin_arm64" && e.ArchiveExt != "zip" {
+			t.Errorf("Darwin_arm64 ArchiveExt = %q, want zip", e.ArchiveExt)
+		}
+	}
+}
+
+func TestResolveAssets_AliasPrefersVersionedName(t *testing.T) {
+	assets := assetList("mytool_linux_amd64.tar.gz", "mytool_1.2.3_linux_amd64.tar.gz")
+	for i := 0; i < 20; i++ {
+		got := resolveAssetsByPlatform(assets, "mytool", "1.2.3", []string{"Linux_x86_64"})
+		if len(got) != 1 || got[0].AssetName != "mytool_1.2.3_linux_amd64.tar.gz" {
+			t.Fatalf("got %+v, want the versioned asset", got)
+		}
+	}
+}
+
+func TestResolveAssets_DarwinAllFallback(t *testing.T) {
+	assets := assetList("mytool_1.2.3_darwin_all.tar.gz", "mytool_1.2.3_darwin_arm64.tar.gz")
+	got := resolveAssetsByPlatform(assets, "mytool", "1.2.3", []string{"Darwin_x86_64", "Darwin_arm64"})
+	if len(got) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(got), got)
+	}
+	for _, e := range got {
+		want := "mytool_1.2.3_darwin_all.tar.gz"
+		if e.PlatformKey == "Darwin_arm64" {
+			want = "mytool_1.2.3_darwin_arm64.tar.gz"
+		}
+		if e.AssetName != want {
+			t.Errorf("%s: asset = %q, want %q", e.PlatformKey, e.AssetName, want)
+		}
+	}
+}
+
+func TestResolveAssets_ExtendedArchitectures(t *testing.T) {
+	assets := assetList(
+		"mytool_1.2.3_Linux_armv7.tar.gz",
+		"mytool_1.2.3_linux_arm_6.tar.gz",
+		"mytool_1.2.3_linux_386.tar.gz",
+		"mytool_1.2.3_linux_ppc64le.tar.gz",
+		"mytool_1.2.3_linux_s390x.tar.gz",
+		"mytool_1.2.3_linux_riscv64.tar.gz",
+		"mytool_1.2.3_windows_i386.zip",
+	)
+	want := map[string]string{
+		"Linux_armv7":   "manylinux_2_17_armv7l",
+		"Linux_i386":    "manylinux_2_17_i686",
+		"Linux_ppc64le": "manylinux_2_17_ppc64le",
+		"Linux_s390x":   "manylinux_2_17_s390x",
+		"Linux_riscv64": "manylinux_2_31_riscv64",
+		"Windows_i386":  "win32",
+	}
+	got := resolveAssetsByPlatform(assets, "mytool", "1.2.3", nil)
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for _, e := range got {
+		if e.WheelTag != want[e.PlatformKey] {
+			t.Errorf("%s: wheel tag = %q, want %q", e.PlatformKey, e.WheelTag, want[e.PlatformKey])
+		}
+		if e.PlatformKey == "Windows_i386" && e.BinaryInArc != "mytool.exe" {
+			t.Errorf("Windows_i386 binary = %q, want mytool.exe", e.BinaryInArc)
+		}
+	}
+
+	// ARMv6 is built only when asked for, since PyPI rejects linux_armv6l.
+	got = resolveAssetsByPlatform(assets, "mytool", "1.2.3", []string{"linux_armv6"})
+	if len(got) != 1 || got[0].PlatformKey != "Linux_armv6" || got[0].WheelTag != "linux_armv6l" {
+		t.Errorf("-platforms linux_armv6: got %+v", got)
+	}
+}
+
+func TestPlatformKeyFor_Arm(t *testing.T) {
+	tests := []struct {
+		goarch, goarm, want string
+	}{
+		{"arm", "7", "Linux_armv7"},
+		{"arm", "6", "Linux_armv6"},
+		{"arm", "", "Linux_armv6"},
+		{"arm64", "7", "Linux_arm64"},
+	}
+	for _, tt := range tests {
+		if got, ok := platformKeyFor("linux", tt.goarch, tt.goarm); !ok || got != tt.want {
+			t.Errorf("platformKeyFor(linux, %q, %q) = %q, %v, want %q", tt.goarch, tt.goarm, got, ok, tt.want)
+		}
+	}
+	if got, ok := platformKeyFor("linux", "arm", "5"); ok {
+		t.Errorf("platformKeyFor(linux, arm, 5) = %q, want no match", got)
+	}
+}
+
+func TestPlatformKeyFor_DuplicateTriple(t *testing.T) {
+	orig := knownPlatforms
+	t.Cleanup(func() { knownPlatforms = orig })
+	knownPlatforms = map[string]platformDef{
+		"Linux_x86_64_musl": {wheelTag: "musllinux_1_1_x86_64", goos: "linux", goarch: "amd64"},
+		"Linux_x86_64":      {wheelTag: "manylinux_2_17_x86_64", goos: "linux", goarch: "amd64"},
+	}
+	for i := 0; i < 20; i++ {
+		if got, _ := platformKeyFor("linux", "amd64", ""); got != "Linux_x86_64" {
+			t.Fatalf("platformKeyFor = %q, want the first key in sorted order", got)
+		}
+	}
+}
+
+func TestCanonicalPlatformKey(t *testing.T) {
+	tests := map[string]string{
+		"Linux_x86_64":  "Linux_x86_64",
+		"linux_amd64":   "Linux_x86_64",
+		"macOS-arm64":   "Darwin_arm64",
+		"darwin/amd64":  "Darwin_x86_64",
+		"win_x64":       "Windows_x86_64",
+		"Linux_aarch64": "Linux_arm64",
+		"linux_arm_7":   "Linux_armv7",
+		"linux-armv6l":  "Linux_armv6",
+		"linux_i686":    "Linux_i386",
+		"windows_386":   "Windows_i386",
+		"darwin_all":    "Darwin_all",
+	}
+	for in, want := range tests {
+		got, ok := canonicalPlatformKey(in)
+		if !ok || got != want {
+			t.Errorf("canonicalPlatformKey(%q) = %q, %v, want %q", in, got, ok, want)
+		}
+	}
+	for _, in := range []string{"plan9_amd64", "linux", "linux_all"} {
+		if got, ok := canonicalPlatformKey(in); ok {
+			t.Errorf("canonicalPlatformKey(%q) = %q, want no match", in, got)
+		}
+	}
+}
+
 // --- resolveAssetsByName ---
 
 func TestResolveAssetsByName_Explicit(t *testing.T) {
@@ -118,7 +295,7 @@ func TestResolveAssetsByName_Explicit(t *testing.T) {
 		"mytool_1.0.0_Linux_x86_64.tar.gz",
 		"mytool_1.0.0_Windows_x86_64.zip",
 	)
-	result := resolveAssetsByName(assets, []string{"mytool_1.0.0_Linux_x86_64.tar.gz"})
+	result := resolveAssetsByName(assets, []string{"mytool_1.0.0_Linux_x86_64.tar.gz"}, "")
 	if len(result) != 1 {
 		t.Fatalf("expected 1 entry, got %d", len(result))
 	}
@@ -129,7 +306,7 @@ func TestResolveAssetsByName_Explicit(t *testing.T) {
 
 func TestResolveAssetsByName_NotFound(t *testing.T) {
 	assets := assetList("mytool_1.0.0_Linux_x86_64.tar.gz")
-	result := resolveAssetsByName(assets, []string{"nonexistent.tar.gz"})
+	result := resolveAssetsByName(assets, []string{"nonexistent.tar.gz"}, "")
 	if len(result) != 0 {
 		t.Fatalf("expected 0 entries, got %d", len(result))
 	}
@@ -143,7 +320,7 @@ func TestResolveAssetsByName_MultipleAssets(t *testing.T) {
 	result := resolveAssetsByName(assets, []string{
 		"mytool_1.0.0_Linux_x86_64.tar.gz",
 		"mytool_1.0.0_Darwin_arm64.tar.gz",
-	})
+	}, "")
 	if len(result) != 2 {
 		t.Fatalf("expected 2 entries, got %d", len(result))
 	}
@@ -157,11 +334,20 @@ func TestDetectArchiveExt(t *testing.T) {
 		want string
 	}{
 		{"foo.tar.gz", "tar.gz"},
+		{"foo.tgz", "tar.gz"},
+		{"foo.tar.xz", "tar.xz"},
+		{"foo.tar.bz2", "tar.bz2"},
+		{"foo.tar.zst", "tar.zst"},
 		{"foo.zip", "zip"},
-		{"foo.exe", ""},
-		{"foo", ""},
+		{"foo.exe", "raw"},
+		{"foo", "raw"},
+		{"foo-1.2.3-linux-amd64", "raw"},
+		{"foo_1.2.3_darwin_arm64", "raw"},
 		{"foo.tar", ""},
-		{"foo.gz", ""},
+		{"foo.gz", "gz"},
+		{"foo-linux-amd64.xz", "xz"},
+		{"checksums.txt", ""},
+		{"foo_1.2.3_linux_amd64.tar.gz.sha256", ""},
 	}
 	for _, tt := range tests {
 		got := detectArchiveExt(tt.name)
@@ -185,6 +371,9 @@ func TestInferPlatform(t *testing.T) {
 		{"tool_1.0_linux_arm64.tar.gz", "Linux_arm64", "manylinux_2_17_aarch64"},
 		{"tool_1.0_darwin_x86_64.tar.gz", "Darwin_x86_64", "macosx_10_9_x86_64"},
 		{"tool_1.0_windows_arm64.zip", "Windows_arm64", "win_arm64"},
+		{"tool_1.0_macOS_aarch64.tar.gz", "Darwin_arm64", "macosx_11_0_arm64"},
+		{"tool-1.0-win-x64.zip", "Windows_x86_64", "win_amd64"},
+		{"tool_1.0_Linux_amd64.tar.gz", "Linux_x86_64", "manylinux_2_17_x86_64"},
 		{"completely_unknown.tar.gz", "unknown", "any"},
 	}
 	for _, tt := range tests {
@@ -200,11 +389,11 @@ func TestInferPlatform(t *testing.T) {
 
 // --- buildWantedSet ---
 
-func TestBuildWantedSet_NilMeansAll(t *testing.T) {
+func TestBuildWantedSet_NilMeansAllPyPIPlatforms(t *testing.T) {
 	s := buildWantedSet(nil)
-	if len(s) != len(knownPlatforms) {
-		t.Errorf("nil input should produce a set with all %d platforms, got %d",
-			len(knownPlatforms), len(s))
+	if len(s) != len(knownPlatforms)-1 || s["Linux_armv6"] {
+		t.Errorf("nil input should produce a set with the %d platforms PyPI accepts, got %v",
+			len(knownPlatforms)-1, s)
 	}
 }
 
@@ -221,6 +410,13 @@ func TestBuildWantedSet_Specific(t *testing.T) {
 	}
 }
 
+func TestBuildWantedSet_Aliases(t *testing.T) {
+	s := buildWantedSet([]string{"linux_amd64", "macos_arm64"})
+	if !s["Linux_x86_64"] || !s["Darwin_arm64"] || len(s) != 2 {
+		t.Errorf("set = %v, want Linux_x86_64 and Darwin_arm64", s)
+	}
+}
+
 // --- indexAssets ---
 
 func TestIndexAssets(t *testing.T) {
@@ -229,13 +425,41 @@ func TestIndexAssets(t *testing.T) {
 		{Name: "b.zip", BrowserDownloadURL: "https://example.com/b.zip"},
 	}
 	idx := indexAssets(assets)
-	if idx["a.tar.gz"] != "https://example.com/a.tar.gz" {
+	if idx["a.tar.gz"].BrowserDownloadURL != "https://example.com/a.tar.gz" {
 		t.Error("index lookup for a.tar.gz failed")
 	}
-	if idx["b.zip"] != "https://example.com/b.zip" {
+	if idx["b.zip"].BrowserDownloadURL != "https://example.com/b.zip" {
 		t.Error("index lookup for b.zip failed")
 	}
 	if _, ok := idx["missing"]; ok {
 		t.Error("unexpected key 'missing' in index")
 	}
 }
+
+func TestResolveAssets_RawBinaries(t *testing.T) {
+	assets := assetList(
+		"mytool-linux-amd64",
+		"mytool-linux-amd64.sha256",
+		"mytool-windows-amd64.exe",
+		"mytool-darwin-arm64.gz",
+		"mytool_1.2.3_linux_arm64",
+		"mytool_1.2.3_linux_arm64.tar.gz",
+	)
+	got := resolveAssetsByPlatform(assets, "mytool", "1.2.3", nil)
+	want := map[string][2]string{
+		"Linux_x86_64":   {"mytool-linux-amd64", "raw"},
+		"Windows_x86_64": {"mytool-windows-amd64.exe", "raw"},
+		"Darwin_arm64":   {"mytool-darwin-arm64.gz", "gz"},
+		// An archive is preferred over a bare binary.
+		"Linux_arm64": {"mytool_1.2.3_linux_arm64.tar.gz", "tar.gz"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d entries, want %d: %+v", len(got), len(want), got)
+	}
+	for _, e := range got {
+		w := want[e.PlatformKey]
+		if e.AssetName != w[0] || e.ArchiveExt != w[1] {
+			t.Errorf("%s: asset = %q (%s), want %q (%s)", e.PlatformKey, e.AssetName, e.ArchiveExt, w[0], w[1])
+		}
+	}
+}
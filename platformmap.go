@@ -0,0 +1,175 @@
+// platformmap.go — user-supplied platform definitions (-platform-map).
+//
+// A YAML file corrects or adds entries of knownPlatforms without rebuilding
+// the tool:
+//
+//	replace: false            # true discards the compiled-in table first
+//	platforms:
+//	  Darwin_x86_64:          # asset key, as in {binary}_{version}_{key}.{ext}
+//	    wheel_tag: macosx_10_15_x86_64
+//	  Linux_loong64:
+//	    wheel_tag: manylinux_2_36_loongarch64
+//	    format: tar.gz
+//	    os: linux
+//	    arch: loong64
+//	    binary_path: bin/{binary}
+//	    exe_suffix: ""
+//
+// Fields left out of an entry for an existing key keep their compiled-in
+// value.
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// platformMapFile is the layout of a -platform-map file.
+type platformMapFile struct {
+	Replace   bool                        `yaml:"replace"`
+	Platforms map[string]platformMapEntry `yaml:"platforms"`
+}
+
+// platformMapEntry is one platform of a -platform-map file. Pointers tell a
+// field set to "" apart from one left out.
+type platformMapEntry struct {
+	WheelTag   *string `yaml:"wheel_tag"`
+	Format     *string `yaml:"format"`
+	OS         *string `yaml:"os"`
+	Arch       *string `yaml:"arch"`
+	Arm        *string `yaml:"arm"`
+	BinaryPath *string `yaml:"binary_path"`
+	ExeSuffix  *string `yaml:"exe_suffix"`
+}
+
+// loadPlatformMap reads a -platform-map file and applies it to
+// knownPlatforms.
+func loadPlatformMap(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var pm platformMapFile
+	if err := yaml.Unmarshal(data, &pm); err != nil {
+		return fmt.Errorf("parse %s: %w", file, err)
+	}
+	merged, err := mergePlatformMap(knownPlatforms, pm)
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	knownPlatforms = merged
+	osAliases, archAliases = mergeAliases(merged)
+	slog.Info("applied platform map", "file", file, "entries", len(pm.Platforms), "platforms", len(merged))
+	return nil
+}
+
+// mergePlatformMap returns base with the entries of pm applied. base is not
+// modified.
+func mergePlatformMap(base map[string]platformDef, pm platformMapFile) (map[string]platformDef, error) {
+	out := make(map[string]platformDef, len(base)+len(pm.Platforms))
+	if !pm.Replace {
+		for k, def := range base {
+			out[k] = def
+		}
+	}
+
+	keys := make([]string, 0, len(pm.Platforms))
+	for k := range pm.Platforms {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		e := pm.Platforms[key]
+		def, exists := out[key]
+		if !exists {
+			if e.WheelTag == nil || *e.WheelTag == "" {
+				return nil, fmt.Errorf("platform %s: wheel_tag is required for a new platform", key)
+			}
+			def = newPlatformDef(key, e)
+		}
+		set := func(dst *string, src *string) {
+			if src != nil {
+				*dst = *src
+			}
+		}
+		set(&def.wheelTag, e.WheelTag)
+		set(&def.archiveExt, e.Format)
+		set(&def.goos, e.OS)
+		set(&def.goarch, e.Arch)
+		set(&def.goarm, e.Arm)
+		set(&def.binaryPath, e.BinaryPath)
+		set(&def.exe, e.ExeSuffix)
+
+		if !slices.Contains(archiveFormats, def.archiveExt) {
+			return nil, fmt.Errorf("platform %s: unsupported format %q (want one of %s)", key, def.archiveExt, strings.Join(archiveFormats, ", "))
+		}
+		if exists {
+			slog.Debug("platform map overrides platform", "platform", key, "wheel_tag", def.wheelTag)
+		} else {
+			slog.Debug("platform map adds platform", "platform", key, "wheel_tag", def.wheelTag)
+		}
+		out[key] = def
+	}
+	return out, nil
+}
+
+// newPlatformDef returns the defaults of a platform that is not compiled in:
+// GOOS/GOARCH parsed from its key where possible, and the Windows archive
+// format and executable suffix for Windows targets.
+func newPlatformDef(key string, e platformMapEntry) platformDef {
+	var def platformDef
+	def.goos, def.goarch, def.goarm, _ = parsePlatform(key)
+	if def.goos == "" || def.goarch == "" {
+		// Keys such as Linux_loong64 name an architecture without an alias.
+		if osPart, archPart, ok := strings.Cut(key, "_"); ok {
+			if def.goos == "" {
+				def.goos = strings.ToLower(osPart)
+			}
+			if def.goarch == "" {
+				def.goarch = strings.ToLower(archPart)
+			}
+		}
+	}
+	def.archiveExt = "tar.gz"
+	if def.goos == "windows" || (e.OS != nil && *e.OS == "windows") {
+		def.archiveExt, def.exe = "zip", ".exe"
+	}
+	return def
+}
+
+// mergeAliases returns copies of osAliases and archAliases extended with the
+// GOOS and GOARCH of every platform that they do not already recognise, e.g.
+// "loong64" for a new target, so that its assets can be matched by name.
+func mergeAliases(platforms map[string]platformDef) (map[string]string, map[string]archAlias) {
+	osOut := make(map[string]string, len(osAliases))
+	for k, v := range osAliases {
+		osOut[k] = v
+	}
+	archOut := make(map[string]archAlias, len(archAliases))
+	for k, v := range archAliases {
+		archOut[k] = v
+	}
+
+	keys := make([]string, 0, len(platforms))
+	for k := range platforms {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		def := platforms[k]
+		if _, ok := osOut[def.goos]; !ok && def.goos != "" {
+			osOut[def.goos] = def.goos
+		}
+		if _, ok := archOut[def.goarch]; !ok && def.goarch != "" {
+			archOut[def.goarch] = archAlias{def.goarch, def.goarm}
+		}
+	}
+	return osOut, archOut
+}
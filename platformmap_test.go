@@ -0,0 +1,131 @@
+// platformmap_test.go
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+func parsePlatformMapFile(t *testing.T, src string) platformMapFile {
+	t.Helper()
+	var pm platformMapFile
+	if err := yaml.Unmarshal([]byte(src), &pm); err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	return pm
+}
+
+func TestMergePlatformMap_OverrideAndExtend(t *testing.T) {
+	pm := parsePlatformMapFile(t, `
+platforms:
+  Darwin_x86_64:
+    wheel_tag: macosx_10_15_x86_64
+  Linux_loong64:
+    wheel_tag: manylinux_2_36_loongarch64
+    binary_path: bin/{binary}
+  Windows_x86_64:
+    exe_suffix: ".com"
+`)
+	got, err := mergePlatformMap(knownPlatforms, pm)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if len(got) != len(knownPlatforms)+1 {
+		t.Errorf("got %d platforms, want %d", len(got), len(knownPlatforms)+1)
+	}
+	if def := got["Darwin_x86_64"]; def.wheelTag != "macosx_10_15_x86_64" || def.goarch != "amd64" || def.archiveExt != "tar.gz" {
+		t.Errorf("Darwin_x86_64 = %+v, want only the wheel tag changed", def)
+	}
+	if knownPlatforms["Darwin_x86_64"].wheelTag != "macosx_10_9_x86_64" {
+		t.Error("mergePlatformMap modified its input")
+	}
+	loong := got["Linux_loong64"]
+	if loong.goos != "linux" || loong.goarch != "loong64" || loong.archiveExt != "tar.gz" {
+		t.Errorf("Linux_loong64 = %+v", loong)
+	}
+	if b := loong.binaryInArchive("tool"); b != "bin/tool" {
+		t.Errorf("binary in archive = %q, want bin/tool", b)
+	}
+	if b := got["Windows_x86_64"].binaryInArchive("tool"); b != "tool.com" {
+		t.Errorf("Windows binary = %q, want tool.com", b)
+	}
+}
+
+func TestMergeAliases(t *testing.T) {
+	platforms := map[string]platformDef{
+		"Linux_x86_64":  knownPlatforms["Linux_x86_64"],
+		"Linux_loong64": {goos: "linux", goarch: "loong64"},
+		"Plan9_amd64":   {goos: "plan9", goarch: "amd64"},
+	}
+	osAl, archAl := mergeAliases(platforms)
+	if archAl["loong64"] != (archAlias{"loong64", ""}) {
+		t.Errorf("loong64 alias = %+v, want it registered", archAl["loong64"])
+	}
+	if osAl["plan9"] != "plan9" {
+		t.Errorf("plan9 alias = %q, want it registered", osAl["plan9"])
+	}
+	if _, ok := archAliases["loong64"]; ok {
+		t.Error("mergeAliases modified archAliases")
+	}
+	if _, ok := osAliases["plan9"]; ok {
+		t.Error("mergeAliases modified osAliases")
+	}
+}
+
+func TestMergePlatformMap_Replace(t *testing.T) {
+	pm := parsePlatformMapFile(t, `
+replace: true
+platforms:
+  Linux_x86_64:
+    wheel_tag: manylinux_2_28_x86_64
+`)
+	got, err := mergePlatformMap(knownPlatforms, pm)
+	if err != nil {
+		t.Fatalf("merge: %v", err)
+	}
+	if len(got) != 1 || got["Linux_x86_64"].wheelTag != "manylinux_2_28_x86_64" || got["Linux_x86_64"].goarch != "amd64" {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func TestMergePlatformMap_Errors(t *testing.T) {
+	tests := map[string]string{
+		"missing wheel tag":  "platforms:\n  Linux_loong64:\n    format: tar.gz\n",
+		"unsupported format": "platforms:\n  Linux_x86_64:\n    format: rar\n",
+	}
+	for name, src := range tests {
+		if _, err := mergePlatformMap(knownPlatforms, parsePlatformMapFile(t, src)); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+}
+
+func TestLoadPlatformMap(t *testing.T) {
+	orig, origOS, origArch := knownPlatforms, osAliases, archAliases
+	t.Cleanup(func() { knownPlatforms, osAliases, archAliases = orig, origOS, origArch })
+
+	file := filepath.Join(t.TempDir(), "platforms.yaml")
+	if err := os.WriteFile(file, []byte("platforms:\n  Linux_loong64:\n    wheel_tag: manylinux_2_36_loongarch64\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadPlatformMap(file); err != nil {
+		t.Fatalf("loadPlatformMap: %v", err)
+	}
+
+	assets := assetList("tool_1.0.0_linux_loong64.tar.gz")
+	got := resolveAssetsByPlatform(assets, "tool", "1.0.0", []string{"Linux_loong64"})
+	if len(got) != 1 || got[0].WheelTag != "manylinux_2_36_loongarch64" {
+		t.Errorf("got %+v, want the mapped loong64 asset", got)
+	}
+
+	if err := os.WriteFile(file, []byte("platforms: ["), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadPlatformMap(file); err == nil || !strings.Contains(err.Error(), file) {
+		t.Errorf("err = %v, want a parse error naming the file", err)
+	}
+}
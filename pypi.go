@@ -16,27 +16,54 @@ import (
 	"strings"
 )
 
-// wheelDigests returns the MD5 and SHA-256 hex digests of the wheel bytes.
-// Both are required by the PyPI legacy upload API.
-func wheelDigests(data []byte) (md5hex, sha256hex string) {
-	m := md5.Sum(data) //nolint:gosec
-	s := sha256.Sum256(data)
-	return fmt.Sprintf("%x", m), fmt.Sprintf("%x", s)
+// wheelDigests returns the MD5 and SHA-256 hex digests of the wheel read
+// from r. Both are required by the PyPI legacy upload API.
+func wheelDigests(r io.Reader) (md5hex, sha256hex string, err error) {
+	m := md5.New() //nolint:gosec
+	s := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(m, s), r); err != nil {
+		return "", "", err
+	}
+	return fmt.Sprintf("%x", m.Sum(nil)), fmt.Sprintf("%x", s.Sum(nil)), nil
+}
+
+// checkUploadVersion rejects a version PyPI would refuse on upload: one with
+// a local label, such as "1.3.0.dev0+abc1234" from a snapshot build. It is
+// checked before any wheel is built, so -upload fails early.
+func checkUploadVersion(version string) error {
+	if _, local, ok := strings.Cut(version, "+"); ok {
+		return fmt.Errorf("-upload: version %s has the local label %q, which PyPI rejects; pass -py-version without it, e.g. -py-version %s",
+			version, local, strings.SplitN(version, "+", 2)[0])
+	}
+	return nil
 }
 
 // uploadToPyPI uploads a single wheel file to a PyPI-compatible legacy upload
 // endpoint. username is "__token__" when using an API token as the password.
+// The wheel is streamed from disk twice, once to hash it and once as the
+// request body, so it is never held in memory. Only the form fields and
+// multipart framing are buffered, which also gives the request a
+// Content-Length. The body is reopened from disk when a 307 or 308 redirect
+// makes net/http send it again.
 func uploadToPyPI(wheelPath, pkg, version, pypiURL, username, password string) error {
-	wheelData, err := os.ReadFile(wheelPath)
+	f, err := os.Open(wheelPath)
+	if err != nil {
+		return fmt.Errorf("read wheel: %w", err)
+	}
+	st, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("read wheel: %w", err)
+	}
+	md5hex, sha256hex, err := wheelDigests(f)
+	f.Close()
 	if err != nil {
 		return fmt.Errorf("read wheel: %w", err)
 	}
-
-	md5hex, sha256hex := wheelDigests(wheelData)
 	filename := filepath.Base(wheelPath)
 
-	body := new(bytes.Buffer)
-	mw := multipart.NewWriter(body)
+	head := new(bytes.Buffer)
+	mw := multipart.NewWriter(head)
 
 	fields := map[string]string{
 		":action":          "file_upload",
@@ -59,19 +86,40 @@ func uploadToPyPI(wheelPath, pkg, version, pypiURL, username, password string) e
 	h.Set("Content-Disposition",
 		fmt.Sprintf(`form-data; name="content"; filename=%q`, filename))
 	h.Set("Content-Type", "application/zip")
-	fw, err := mw.CreatePart(h)
-	if err != nil {
+	if _, err := mw.CreatePart(h); err != nil {
 		return err
 	}
-	if _, err = fw.Write(wheelData); err != nil {
+	// The wheel goes between the part header written so far and the closing
+	// boundary that Close writes.
+	headLen := head.Len()
+	if err := mw.Close(); err != nil {
 		return err
 	}
-	mw.Close()
+	tail := bytes.Clone(head.Bytes()[headLen:])
+	prefix := head.Bytes()[:headLen]
 
+	openBody := func() (io.ReadCloser, error) {
+		f, err := os.Open(wheelPath)
+		if err != nil {
+			return nil, fmt.Errorf("read wheel: %w", err)
+		}
+		r := io.MultiReader(bytes.NewReader(prefix), f, bytes.NewReader(tail))
+		return struct {
+			io.Reader
+			io.Closer
+		}{r, f}, nil
+	}
+	body, err := openBody()
+	if err != nil {
+		return err
+	}
 	req, err := http.NewRequest(http.MethodPost, pypiURL, body)
 	if err != nil {
+		body.Close()
 		return err
 	}
+	req.GetBody = openBody
+	req.ContentLength = int64(len(prefix)) + st.Size() + int64(len(tail))
 	req.Header.Set("Content-Type", mw.FormDataContentType())
 	req.SetBasicAuth(username, password)
 
@@ -0,0 +1,90 @@
+// pypi_test.go
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUploadToPyPI_StreamsWheel(t *testing.T) {
+	wheel := []byte("PK\x03\x04 wheel contents")
+	path := filepath.Join(t.TempDir(), "tool-1.0.0-py3-none-any.whl")
+	if err := os.WriteFile(path, wheel, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var fields map[string]string
+	var content []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ContentLength <= int64(len(wheel)) {
+			t.Errorf("Content-Length = %d, want the full multipart body", r.ContentLength)
+		}
+		if user, pass, _ := r.BasicAuth(); user != "__token__" || pass != "pypi-token" {
+			t.Errorf("basic auth = %q, %q", user, pass)
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("parse form: %v", err)
+			return
+		}
+		fields = map[string]string{}
+		for k, v := range r.MultipartForm.Value {
+			fields[k] = v[0]
+		}
+		fh := r.MultipartForm.File["content"][0]
+		if fh.Filename != filepath.Base(path) {
+			t.Errorf("filename = %q", fh.Filename)
+		}
+		f, _ := fh.Open()
+		content, _ = io.ReadAll(f)
+	}))
+	defer srv.Close()
+
+	if err := uploadToPyPI(path, "tool", "1.0.0", srv.URL, "__token__", "pypi-token"); err != nil {
+		t.Fatalf("uploadToPyPI: %v", err)
+	}
+	if string(content) != string(wheel) {
+		t.Errorf("uploaded content = %q, want %q", content, wheel)
+	}
+	if want := fmt.Sprintf("%x", sha256.Sum256(wheel)); fields["sha2_digest"] != want {
+		t.Errorf("sha2_digest = %q, want %q", fields["sha2_digest"], want)
+	}
+	if fields["name"] != "tool" || fields["version"] != "1.0.0" {
+		t.Errorf("fields = %v", fields)
+	}
+}
+
+func TestUploadToPyPI_FollowsPermanentRedirect(t *testing.T) {
+	wheel := []byte("PK\x03\x04 wheel contents")
+	path := filepath.Join(t.TempDir(), "tool-1.0.0-py3-none-any.whl")
+	if err := os.WriteFile(path, wheel, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var content []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/legacy" {
+			http.Redirect(w, r, "/legacy/", http.StatusPermanentRedirect)
+			return
+		}
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("parse form: %v", err)
+			return
+		}
+		f, _ := r.MultipartForm.File["content"][0].Open()
+		content, _ = io.ReadAll(f)
+	}))
+	defer srv.Close()
+
+	if err := uploadToPyPI(path, "tool", "1.0.0", srv.URL+"/legacy", "__token__", "pypi-token"); err != nil {
+		t.Fatalf("uploadToPyPI: %v", err)
+	}
+	if string(content) != string(wheel) {
+		t.Errorf("uploaded content after redirect = %q, want %q", content, wheel)
+	}
+}
@@ -0,0 +1,373 @@
+// semver.go — semantic version parsing and the -version query language used
+// to pick a release when an exact tag is not given.
+//
+// Supported queries:
+//
+//	latest-stable       highest non-prerelease version
+//	latest-prerelease   highest version, prereleases included
+//	>=1.4,<2            comma- or space-separated comparators, all must hold
+//	~1.4                >=1.4.0, <1.5.0
+//	^1.4                >=1.4.0, <2.0.0 (^0.4 is >=0.4.0, <0.5.0)
+//
+// Comparator operators are =, !=, >, >=, < and <=. Prerelease versions only
+// satisfy a constraint when one of its comparators itself names a prerelease,
+// mirroring the behaviour of npm and Cargo.
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+)
+
+const (
+	queryLatestStable     = "latest-stable"
+	queryLatestPrerelease = "latest-prerelease"
+)
+
+// semver is a parsed semantic version. Build metadata is discarded since it
+// does not take part in precedence.
+type semver struct {
+	major, minor, patch int
+	pre                 []string // prerelease identifiers; nil for a stable version
+	parts               int      // number of numeric components given (1–3)
+}
+
+// parseSemver parses s as a semantic version. A leading "v" is accepted and
+// the minor and patch components may be omitted ("1.4" parses as 1.4.0).
+// Numeric components and identifiers must not have leading zeros, and
+// prerelease identifiers must be non-empty, as SemVer 2.0.0 requires.
+func parseSemver(s string) (semver, bool) {
+	var v semver
+	s = strings.TrimPrefix(strings.TrimSpace(s), "v")
+	if i := strings.IndexByte(s, '+'); i >= 0 {
+		s = s[:i]
+	}
+	if i := strings.IndexByte(s, '-'); i >= 0 {
+		v.pre = strings.Split(s[i+1:], ".")
+		for _, id := range v.pre {
+			if !validPrereleaseIdent(id) {
+				return semver{}, false
+			}
+		}
+		s = s[:i]
+	}
+
+	nums := strings.Split(s, ".")
+	if len(nums) == 0 || len(nums) > 3 {
+		return v, false
+	}
+	dst := []*int{&v.major, &v.minor, &v.patch}
+	for i, n := range nums {
+		if !isNumericIdent(n) {
+			return semver{}, false
+		}
+		x, err := strconv.Atoi(n)
+		if err != nil {
+			return semver{}, false
+		}
+		*dst[i] = x
+	}
+	v.parts = len(nums)
+	return v, true
+}
+
+// isNumericIdent reports whether s is a SemVer numeric identifier: one or
+// more ASCII digits without a leading zero.
+func isNumericIdent(s string) bool {
+	if s == "" || (len(s) > 1 && s[0] == '0') {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// validPrereleaseIdent reports whether s is a valid prerelease identifier:
+// non-empty, made of [0-9A-Za-z-], and without a leading zero when numeric.
+func validPrereleaseIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	numeric := true
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r == '-':
+			numeric = false
+		default:
+			return false
+		}
+	}
+	return !numeric || isNumericIdent(s)
+}
+
+// isPrerelease reports whether v carries prerelease identifiers.
+func (v semver) isPrerelease() bool {
+	return len(v.pre) > 0
+}
+
+// compare returns -1, 0 or 1 depending on whether v sorts before, equal to or
+// after o, following semver 2.0.0 precedence rules.
+func (v semver) compare(o semver) int {
+	for _, d := range [][2]int{{v.major, o.major}, {v.minor, o.minor}, {v.patch, o.patch}} {
+		if d[0] != d[1] {
+			if d[0] < d[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	// A version without prerelease identifiers has higher precedence.
+	switch {
+	case len(v.pre) == 0 && len(o.pre) == 0:
+		return 0
+	case len(v.pre) == 0:
+		return 1
+	case len(o.pre) == 0:
+		return -1
+	}
+
+	for i := 0; i < len(v.pre) && i < len(o.pre); i++ {
+		if c := comparePrereleaseIdent(v.pre[i], o.pre[i]); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case len(v.pre) < len(o.pre):
+		return -1
+	case len(v.pre) > len(o.pre):
+		return 1
+	}
+	return 0
+}
+
+// comparePrereleaseIdent compares a single dot-separated prerelease
+// identifier. Numeric identifiers compare numerically and sort before
+// alphanumeric ones.
+func comparePrereleaseIdent(a, b string) int {
+	aNum, bNum := isNumericIdent(a), isNumericIdent(b)
+	switch {
+	case aNum && bNum:
+		an, _ := strconv.Atoi(a)
+		bn, _ := strconv.Atoi(b)
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		}
+		return 0
+	case aNum:
+		return -1
+	case bNum:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+// bump returns the smallest version above every version sharing v's first
+// n numeric components, e.g. bump(1.4.2, 2) is 1.5.0.
+func (v semver) bump(n int) semver {
+	switch n {
+	case 1:
+		return semver{major: v.major + 1, parts: 3}
+	case 2:
+		return semver{major: v.major, minor: v.minor + 1, parts: 3}
+	default:
+		return semver{major: v.major, minor: v.minor, patch: v.patch + 1, parts: 3}
+	}
+}
+
+// comparator is a single "<op><version>" term of a constraint.
+type comparator struct {
+	op  string
+	ver semver
+}
+
+func (c comparator) matches(v semver) bool {
+	cmp := v.compare(c.ver)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	}
+	return false
+}
+
+// constraint is a set of comparators that must all hold.
+type constraint []comparator
+
+// parseConstraint parses a comma- or space-separated list of comparators.
+// Partial versions are widened to the range they describe, so "<=1.4" means
+// "<1.5.0" and "=1.4" means ">=1.4.0, <1.5.0".
+func parseConstraint(s string) (constraint, error) {
+	var terms []string
+	for _, part := range strings.Split(s, ",") {
+		fields := strings.Fields(part)
+		for i := 0; i < len(fields); i++ {
+			f := fields[i]
+			// Allow whitespace between an operator and its version: ">= 1.4".
+			if strings.Trim(f, "<>=!~^") == "" && i+1 < len(fields) {
+				f += fields[i+1]
+				i++
+			}
+			terms = append(terms, f)
+		}
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty version constraint")
+	}
+
+	var c constraint
+	for _, term := range terms {
+		op := term[:len(term)-len(strings.TrimLeft(term, "<>=!~^"))]
+		ver, ok := parseSemver(term[len(op):])
+		if !ok {
+			return nil, fmt.Errorf("invalid version in constraint term %q", term)
+		}
+
+		switch op {
+		case "~":
+			n := ver.parts
+			if n > 2 {
+				n = 2
+			}
+			c = append(c, comparator{">=", ver}, comparator{"<", ver.bump(n)})
+		case "^":
+			// Bump the left-most non-zero component that was given.
+			n := 1
+			if ver.major == 0 && ver.parts > 1 {
+				n = 2
+				if ver.minor == 0 && ver.parts > 2 {
+					n = 3
+				}
+			}
+			c = append(c, comparator{">=", ver}, comparator{"<", ver.bump(n)})
+		case "", "=":
+			if ver.parts == 3 {
+				c = append(c, comparator{"=", ver})
+			} else {
+				c = append(c, comparator{">=", ver}, comparator{"<", ver.bump(ver.parts)})
+			}
+		case ">":
+			if ver.parts < 3 {
+				c = append(c, comparator{">=", ver.bump(ver.parts)})
+			} else {
+				c = append(c, comparator{">", ver})
+			}
+		case "<=":
+			if ver.parts < 3 {
+				c = append(c, comparator{"<", ver.bump(ver.parts)})
+			} else {
+				c = append(c, comparator{"<=", ver})
+			}
+		case ">=", "<", "!=":
+			c = append(c, comparator{op, ver})
+		default:
+			return nil, fmt.Errorf("unknown operator %q in constraint term %q", op, term)
+		}
+	}
+	return c, nil
+}
+
+// allowsPrerelease reports whether any comparator names a prerelease version.
+func (c constraint) allowsPrerelease() bool {
+	for _, cmp := range c {
+		if cmp.ver.isPrerelease() {
+			return true
+		}
+	}
+	return false
+}
+
+// matches reports whether v satisfies every comparator in c.
+func (c constraint) matches(v semver) bool {
+	if v.isPrerelease() && !c.allowsPrerelease() {
+		return false
+	}
+	for _, cmp := range c {
+		if !cmp.matches(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// isReleaseQuery reports whether a -version value is a query to be resolved
+// against the release list rather than a literal tag name.
+func isReleaseQuery(s string) bool {
+	if s == queryLatestStable || s == queryLatestPrerelease {
+		return true
+	}
+	return s != "" && (strings.ContainsAny(s[:1], "<>=!~^") || strings.Contains(s, ","))
+}
+
+// selectRelease returns the highest-versioned release in rels that satisfies
+// query. Drafts and tags that are not valid semantic versions are ignored.
+// Releases flagged as prereleases by the forge are treated as prereleases
+// even when their tag has no prerelease suffix.
+func selectRelease(rels []ghRelease, query string) (ghRelease, error) {
+	var c constraint
+	if query != queryLatestStable && query != queryLatestPrerelease {
+		var err error
+		if c, err = parseConstraint(query); err != nil {
+			return ghRelease{}, err
+		}
+	}
+
+	var (
+		best    ghRelease
+		bestVer semver
+		found   bool
+	)
+	for _, rel := range rels {
+		if rel.Draft {
+			continue
+		}
+		v, ok := parseSemver(rel.TagName)
+		if !ok {
+			slog.Debug("ignoring non-semver release tag", "tag", rel.TagName)
+			continue
+		}
+		pre := v.isPrerelease() || rel.Prerelease
+
+		switch query {
+		case queryLatestStable:
+			if pre {
+				continue
+			}
+		case queryLatestPrerelease:
+			// Everything qualifies.
+		default:
+			if rel.Prerelease && !c.allowsPrerelease() {
+				continue
+			}
+			if !c.matches(v) {
+				continue
+			}
+		}
+
+		if !found || v.compare(bestVer) > 0 {
+			best, bestVer, found = rel, v, true
+		}
+	}
+	if !found {
+		return ghRelease{}, fmt.Errorf("no release matches %q (%d releases considered)", query, len(rels))
+	}
+	return best, nil
+}
@@ -0,0 +1,214 @@
+// semver_test.go
+package main
+
+import (
+	"testing"
+)
+
+// --- parseSemver ---
+
+func TestParseSemver(t *testing.T) {
+	tests := []struct {
+		in    string
+		ok    bool
+		major int
+		minor int
+		patch int
+		pre   int
+	}{
+		{"v1.2.3", true, 1, 2, 3, 0},
+		{"1.2.3", true, 1, 2, 3, 0},
+		{"1.4", true, 1, 4, 0, 0},
+		{"2", true, 2, 0, 0, 0},
+		{"v1.0.0-rc.1", true, 1, 0, 0, 2},
+		{"1.0.0+build.5", true, 1, 0, 0, 0},
+		{"nightly", false, 0, 0, 0, 0},
+		{"1.2.3.4", false, 0, 0, 0, 0},
+		{"1.0.0-", false, 0, 0, 0, 0},
+		{"1.2.3-a..b", false, 0, 0, 0, 0},
+		{"1.2.3-rc.", false, 0, 0, 0, 0},
+		{"1.2.3-rc.01", false, 0, 0, 0, 0},
+		{"1.2.3-rc_1", false, 0, 0, 0, 0},
+		{"01.2.3", false, 0, 0, 0, 0},
+		{"1.02", false, 0, 0, 0, 0},
+		{"1.2.+3", false, 0, 0, 0, 0},
+		{"1.0.0-0a.10", true, 1, 0, 0, 2},
+		{"", false, 0, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		v, ok := parseSemver(tt.in)
+		if ok != tt.ok {
+			t.Errorf("parseSemver(%q) ok = %v, want %v", tt.in, ok, tt.ok)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if v.major != tt.major || v.minor != tt.minor || v.patch != tt.patch || len(v.pre) != tt.pre {
+			t.Errorf("parseSemver(%q) = %d.%d.%d pre=%v", tt.in, v.major, v.minor, v.patch, v.pre)
+		}
+	}
+}
+
+// --- semver.compare ---
+
+func TestSemverCompare(t *testing.T) {
+	// Each version sorts strictly before the next (semver.org §11 example).
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i := 0; i+1 < len(ordered); i++ {
+		a, _ := parseSemver(ordered[i])
+		b, _ := parseSemver(ordered[i+1])
+		if a.compare(b) >= 0 {
+			t.Errorf("expected %s < %s", ordered[i], ordered[i+1])
+		}
+		if b.compare(a) <= 0 {
+			t.Errorf("expected %s > %s", ordered[i+1], ordered[i])
+		}
+	}
+
+	a, _ := parseSemver("v1.4")
+	b, _ := parseSemver("1.4.0")
+	if a.compare(b) != 0 {
+		t.Error("v1.4 and 1.4.0 should compare equal")
+	}
+}
+
+// --- parseConstraint / constraint.matches ---
+
+func TestConstraintMatches(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{">=1.4,<2", "1.4.0", true},
+		{">=1.4,<2", "1.9.9", true},
+		{">=1.4,<2", "2.0.0", false},
+		{">=1.4,<2", "1.3.9", false},
+		{">=1.4 <2", "1.5.0", true},
+		{">= 1.4, < 2", "1.5.0", true},
+		{"~1.4", "1.4.7", true},
+		{"~1.4", "1.5.0", false},
+		{"~1.4.2", "1.4.1", false},
+		{"~1", "1.9.0", true},
+		{"^1.4", "1.9.0", true},
+		{"^1.4", "2.0.0", false},
+		{"^0.4", "0.4.9", true},
+		{"^0.4", "0.5.0", false},
+		{"^0.0.3", "0.0.4", false},
+		{"=1.4", "1.4.3", true},
+		{"=1.4", "1.5.0", false},
+		{"1.4.2", "1.4.2", true},
+		{"!=1.4.2", "1.4.2", false},
+		{">1.4", "1.4.5", false},
+		{">1.4", "1.5.0", true},
+		{"<=1.4", "1.4.9", true},
+		{"<=1.4", "1.5.0", false},
+		// Prereleases are excluded unless the constraint names one.
+		{"<2", "2.0.0-rc.1", false},
+		{">=1.4", "1.5.0-beta.1", false},
+		{">=2.0.0-rc.1", "2.0.0-rc.2", true},
+	}
+	for _, tt := range tests {
+		c, err := parseConstraint(tt.constraint)
+		if err != nil {
+			t.Errorf("parseConstraint(%q): %v", tt.constraint, err)
+			continue
+		}
+		v, ok := parseSemver(tt.version)
+		if !ok {
+			t.Fatalf("bad test version %q", tt.version)
+		}
+		if got := c.matches(v); got != tt.want {
+			t.Errorf("%q matches %q = %v, want %v", tt.constraint, tt.version, got, tt.want)
+		}
+	}
+}
+
+func TestParseConstraint_Invalid(t *testing.T) {
+	for _, s := range []string{"", ">=", ">=abc", "=>1.0", "1.0,,x"} {
+		if _, err := parseConstraint(s); err == nil {
+			t.Errorf("parseConstraint(%q): expected error, got nil", s)
+		}
+	}
+}
+
+// --- isReleaseQuery ---
+
+func TestIsReleaseQuery(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"", false},
+		{"v1.4.2", false},
+		{"1.4.2", false},
+		{"nightly", false},
+		{"latest-stable", true},
+		{"latest-prerelease", true},
+		{">=1.4,<2", true},
+		{"~1.4", true},
+		{"^1", true},
+		{"1.4,1.5", true},
+	}
+	for _, tt := range tests {
+		if got := isReleaseQuery(tt.in); got != tt.want {
+			t.Errorf("isReleaseQuery(%q) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
+
+// --- selectRelease ---
+
+func TestSelectRelease(t *testing.T) {
+	rels := []ghRelease{
+		{TagName: "v2.1.0-rc.1"},
+		{TagName: "v2.0.0", Draft: true},
+		{TagName: "v1.6.0", Prerelease: true},
+		{TagName: "v1.5.2"},
+		{TagName: "nightly"},
+		{TagName: "v1.4.9"},
+		{TagName: "v1.10.0"},
+		{TagName: "v0.9.0"},
+	}
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"latest-stable", "v1.10.0"},
+		{"latest-prerelease", "v2.1.0-rc.1"},
+		{">=1.4,<1.6", "v1.5.2"},
+		{"~1.4", "v1.4.9"},
+		{"^1", "v1.10.0"},
+		{"<1", "v0.9.0"},
+	}
+	for _, tt := range tests {
+		got, err := selectRelease(rels, tt.query)
+		if err != nil {
+			t.Errorf("selectRelease(%q): %v", tt.query, err)
+			continue
+		}
+		if got.TagName != tt.want {
+			t.Errorf("selectRelease(%q) = %s, want %s", tt.query, got.TagName, tt.want)
+		}
+	}
+}
+
+func TestSelectRelease_NoMatch(t *testing.T) {
+	rels := []ghRelease{{TagName: "v1.0.0"}}
+	if _, err := selectRelease(rels, ">=2"); err == nil {
+		t.Fatal("expected error when nothing matches, got nil")
+	}
+}
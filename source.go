@@ -0,0 +1,280 @@
+// source.go — selection of the forge that releases are read from.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// Supported values of -source.
+const (
+	sourceGitHub = "github"
+	sourceGitLab = "gitlab"
+	sourceGitea  = "gitea"
+	sourceOCI    = "oci"
+)
+
+// configureSource points the selected forge client at its instance and
+// registers download credentials. -forge-url applies to whichever forge is
+// selected; for GitHub, -github-url takes precedence over it.
+func configureSource(cfg *Config) error {
+	switch cfg.Source {
+	case "", sourceGitHub:
+		webURL := cfg.GitHubURL
+		if webURL == "" {
+			webURL = cfg.ForgeURL
+		}
+		if err := setGitHubURL(webURL); err != nil {
+			return err
+		}
+		ghForge.registerCredentials(ghBaseURL, ghRawURL, ghWebURL)
+	case sourceGitLab:
+		if err := setGitLabURL(cfg.ForgeURL); err != nil {
+			return err
+		}
+		// GitLab accepts personal, project and group access tokens as
+		// Bearer tokens on the API and for release links and packages.
+		glForge.registerCredentials(glBaseURL, glWebURL)
+	case sourceGitea:
+		if err := setGiteaURL(cfg.ForgeURL); err != nil {
+			return err
+		}
+		gtForge.registerCredentials(gtWebURL)
+	case sourceOCI:
+		// The registry is part of -repo, and its credentials are negotiated
+		// on the first request (see ociRegistry.authorize).
+	default:
+		return fmt.Errorf("unknown -source %q (want %s, %s, %s or %s)", cfg.Source, sourceGitHub, sourceGitLab, sourceGitea, sourceOCI)
+	}
+	return nil
+}
+
+// resolvedRelease is an upstream release ready to build: its tag, its release
+// notes (empty when the source has none) and the assets to build wheels from.
+type resolvedRelease struct {
+	Tag    string
+	Notes  string
+	Assets []assetEntry
+}
+
+// resolveRelease determines the release tag and the assets to build wheels
+// from: from a local directory when -from-dir is set, from a URL template
+// when -url-template is set, from an OCI registry with -source oci,
+// otherwise from the forge selected by -source. -binary-path is then
+// applied, and the Darwin entries adjusted for -universal2.
+func resolveRelease(cfg *Config) (resolvedRelease, error) {
+	var (
+		rel resolvedRelease
+		err error
+	)
+	switch {
+	case cfg.FromDir != "":
+		rel.Tag, rel.Assets, err = resolveLocalDist(cfg)
+	case cfg.URLTemplate != "":
+		rel.Tag, rel.Assets, err = resolveURLTemplate(cfg)
+	case cfg.Source == sourceOCI:
+		rel.Tag, rel.Assets, err = resolveOCIRegistry(cfg)
+	default:
+		rel, err = resolveForgeRelease(cfg)
+	}
+	if err != nil {
+		return rel, err
+	}
+	prepareAssets(cfg, &rel)
+	return rel, nil
+}
+
+// resolveListedRelease resolves a release taken from listSourceReleases
+// without fetching it again. OCI tags are listed without their manifests, so
+// they are still resolved by tag.
+func resolveListedRelease(cfg *Config, listed ghRelease) (resolvedRelease, error) {
+	if cfg.Source == sourceOCI {
+		return resolveRelease(cfg)
+	}
+	rel, err := matchReleaseAssets(cfg, listed)
+	if err != nil {
+		return rel, err
+	}
+	prepareAssets(cfg, &rel)
+	return rel, nil
+}
+
+// prepareAssets applies -binary-path to the matched assets of rel and plans
+// its universal2 wheels.
+func prepareAssets(cfg *Config, rel *resolvedRelease) {
+	if cfg.BinaryPath != "" {
+		applyBinaryPath(rel.Assets, cfg.BinaryPath, rel.Tag, cfg.BinaryName)
+	}
+	rel.Assets = planUniversal2(rel.Assets, cfg.Universal2, cfg.Platforms)
+}
+
+// applyBinaryPath sets the binary of every entry to the in-archive path tmpl
+// expands to for its platform, with the placeholders of -url-template.
+// Platforms whose -platform-map entry sets a binary path keep that path.
+func applyBinaryPath(entries []assetEntry, tmpl, tag, binaryName string) {
+	for i := range entries {
+		ae := &entries[i]
+		def, ok := knownPlatforms[ae.PlatformKey]
+		if !ok || def.binaryPath != "" {
+			continue
+		}
+		ae.BinaryInArc = expandURLTemplate(tmpl, tag, binaryName, ae.PlatformKey, def)
+		slog.Debug("binary path", "platform", ae.PlatformKey, "path", ae.BinaryInArc)
+	}
+}
+
+// resolveForgeRelease fetches the release selected by cfg.Version from the
+// forge selected by -source and matches its assets.
+func resolveForgeRelease(cfg *Config) (resolvedRelease, error) {
+	rel, err := fetchSourceRelease(cfg)
+	if err != nil {
+		return resolvedRelease{}, fmt.Errorf("fetch release: %w", err)
+	}
+	return matchReleaseAssets(cfg, rel)
+}
+
+// matchReleaseAssets picks the assets of a forge release to build.
+func matchReleaseAssets(cfg *Config, rel ghRelease) (resolvedRelease, error) {
+	// Log available asset names at debug so mismatches are immediately obvious.
+	if slog.Default().Enabled(context.Background(), slog.LevelDebug) {
+		names := make([]string, len(rel.Assets))
+		for i, a := range rel.Assets {
+			names[i] = a.Name
+		}
+		slog.Debug("release assets available", "count", len(names), "assets", names)
+	}
+
+	// Decide which assets to process.
+	out := resolvedRelease{Tag: rel.TagName, Notes: rel.Body}
+	var err error
+	out.Assets, err = resolveAssets(cfg, rel.Assets, rel.TagName)
+	if err != nil {
+		return resolvedRelease{}, err
+	}
+	return out, nil
+}
+
+// resolveAssets picks the assets of release tag to build: those named by
+// -assets, those matching -asset-pattern, those matching the
+// -goreleaser-config name template, or those matching the default filename
+// patterns.
+func resolveAssets(cfg *Config, assets []ghAsset, tag string) ([]assetEntry, error) {
+	if len(cfg.AssetNames) > 0 {
+		return resolveAssetsByName(assets, cfg.AssetNames, cfg.BinaryName), nil
+	}
+	binaryVersion := strings.TrimPrefix(tag, "v")
+	if cfg.AssetPattern != nil {
+		return resolveAssetsByPattern(assets, cfg.AssetPattern, cfg.BinaryName, binaryVersion, cfg.Platforms), nil
+	}
+	if cfg.GoReleaserConfig == "" {
+		return resolveAssetsByPlatform(assets, cfg.BinaryName, binaryVersion, cfg.Platforms), nil
+	}
+
+	gc, err := loadGoReleaserConfig(cfg, tag)
+	if err != nil {
+		return nil, fmt.Errorf("GoReleaser config: %w", err)
+	}
+	entries, err := resolveAssetsByGoReleaser(assets, gc, cfg.BinaryName, cfg.BinaryName, tag, cfg.Platforms)
+	switch {
+	case errors.Is(err, errGRUnsupportedFunc):
+		slog.Warn("GoReleaser name_template cannot be evaluated; falling back to default patterns", "error", err)
+		return resolveAssetsByPlatform(assets, cfg.BinaryName, binaryVersion, cfg.Platforms), nil
+	case err != nil:
+		return nil, fmt.Errorf("GoReleaser config: %w", err)
+	}
+	if len(entries) == 0 {
+		slog.Warn("no asset matches the GoReleaser name_template; falling back to default patterns")
+		return resolveAssetsByPlatform(assets, cfg.BinaryName, binaryVersion, cfg.Platforms), nil
+	}
+	return entries, nil
+}
+
+// fetchSourceRelease returns the release selected by cfg.Version from the
+// forge selected by cfg.Source.
+func fetchSourceRelease(cfg *Config) (ghRelease, error) {
+	switch cfg.Source {
+	case sourceGitLab:
+		return fetchGitLabRelease(cfg.Repo, cfg.Version)
+	case sourceGitea:
+		return fetchGiteaRelease(cfg.Repo, cfg.Version)
+	}
+	return fetchRelease(cfg.Repo, cfg.Version)
+}
+
+// listSourceReleases returns every release of cfg.Repo on the selected
+// source, for backfill. OCI tags are listed as releases without assets.
+func listSourceReleases(cfg *Config) ([]ghRelease, error) {
+	switch {
+	case cfg.FromDir != "", cfg.URLTemplate != "":
+		return nil, fmt.Errorf("backfill needs a release list, which -from-dir and -url-template do not have")
+	case cfg.Source == sourceGitLab:
+		return listGitLabReleases(cfg.Repo)
+	case cfg.Source == sourceGitea:
+		return listGiteaReleases(cfg.Repo)
+	case cfg.Source == sourceOCI:
+		tags, err := newOCIRegistry(cfg.Repo).listTags()
+		if err != nil {
+			return nil, err
+		}
+		rels := make([]ghRelease, len(tags))
+		for i, t := range tags {
+			rels[i] = ghRelease{TagName: t}
+		}
+		return rels, nil
+	}
+	return listReleases(cfg.Repo)
+}
+
+// projectURL returns the web URL of the upstream project, used as the
+// Project-URL in wheel metadata, or "" when there is none: building from a
+// local directory without -repo, or from an OCI registry.
+func projectURL(cfg *Config) string {
+	if cfg.Repo == "" || cfg.Source == sourceOCI {
+		return ""
+	}
+	switch cfg.Source {
+	case sourceGitLab:
+		return glWebURL + "/" + cfg.Repo
+	case sourceGitea:
+		return gtWebURL + "/" + cfg.Repo
+	}
+	return ghWebURL + "/" + cfg.Repo
+}
+
+// releasePageURL returns the web page of release tag, or "" when the source
+// has none.
+func releasePageURL(cfg *Config, tag string) string {
+	base := projectURL(cfg)
+	if base == "" {
+		return ""
+	}
+	if cfg.Source == sourceGitLab {
+		return base + "/-/releases/" + url.PathEscape(tag)
+	}
+	return base + "/releases/tag/" + url.PathEscape(tag)
+}
+
+// rawFileURL returns the URL of file name at ref in the upstream project, or
+// "" when the source has no repository files to read.
+func rawFileURL(cfg *Config, ref, name string) string {
+	if cfg.Repo == "" {
+		return ""
+	}
+	switch cfg.Source {
+	case sourceOCI:
+		return ""
+	case sourceGitLab:
+		// The repository files API, unlike the web /-/raw/ route, accepts
+		// the token of a private project.
+		return fmt.Sprintf("%s/projects/%s/repository/files/%s/raw?ref=%s",
+			glBaseURL, url.PathEscape(cfg.Repo), url.PathEscape(name), url.QueryEscape(ref))
+	case sourceGitea:
+		// The legacy /raw/{ref}/ form resolves branches, tags and commits.
+		return fmt.Sprintf("%s/%s/raw/%s/%s", gtWebURL, cfg.Repo, ref, name)
+	}
+	return fmt.Sprintf("%s/%s/%s/%s", ghRawURL, cfg.Repo, ref, name)
+}
@@ -0,0 +1,156 @@
+// source_test.go
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestProjectURL(t *testing.T) {
+	tests := []struct {
+		source string
+		repo   string
+		want   string
+	}{
+		{"", "owner/tool", "https://github.com/owner/tool"},
+		{sourceGitHub, "owner/tool", "https://github.com/owner/tool"},
+		{sourceGitLab, "group/sub/tool", "https://gitlab.com/group/sub/tool"},
+		{sourceGitea, "owner/tool", "https://codeberg.org/owner/tool"},
+		{sourceOCI, "ghcr.io/owner/tool", ""},
+	}
+	for _, tt := range tests {
+		got := projectURL(&Config{Source: tt.source, Repo: tt.repo})
+		if got != tt.want {
+			t.Errorf("projectURL(%q, %q) = %q, want %q", tt.source, tt.repo, got, tt.want)
+		}
+	}
+}
+
+func TestRawFileURL(t *testing.T) {
+	gh := rawFileURL(&Config{Repo: "owner/tool"}, "main", "LICENSE")
+	if gh != "https://raw.githubusercontent.com/owner/tool/main/LICENSE" {
+		t.Errorf("github raw URL = %q", gh)
+	}
+	gl := rawFileURL(&Config{Source: sourceGitLab, Repo: "group/tool"}, "v1.0.0", "LICENSE")
+	if gl != "https://gitlab.com/api/v4/projects/group%2Ftool/repository/files/LICENSE/raw?ref=v1.0.0" {
+		t.Errorf("gitlab raw URL = %q", gl)
+	}
+	gt := rawFileURL(&Config{Source: sourceGitea, Repo: "owner/tool"}, "main", "LICENSE")
+	if gt != "https://codeberg.org/owner/tool/raw/main/LICENSE" {
+		t.Errorf("gitea raw URL = %q", gt)
+	}
+}
+
+func TestConfigureSource_Unknown(t *testing.T) {
+	if err := configureSource(&Config{Source: "bitbucket"}); err == nil {
+		t.Fatal("expected error for unknown source, got nil")
+	}
+}
+
+func TestReleasePageURL(t *testing.T) {
+	tests := []struct {
+		source string
+		repo   string
+		want   string
+	}{
+		{sourceGitHub, "owner/tool", "https://github.com/owner/tool/releases/tag/v1.0.0"},
+		{sourceGitLab, "group/tool", "https://gitlab.com/group/tool/-/releases/v1.0.0"},
+		{sourceGitea, "owner/tool", "https://codeberg.org/owner/tool/releases/tag/v1.0.0"},
+		{sourceGitHub, "", ""},
+	}
+	for _, tt := range tests {
+		got := releasePageURL(&Config{Source: tt.source, Repo: tt.repo}, "v1.0.0")
+		if got != tt.want {
+			t.Errorf("releasePageURL(%q, %q) = %q, want %q", tt.source, tt.repo, got, tt.want)
+		}
+	}
+}
+
+func TestResolveRelease_CarriesReleaseNotes(t *testing.T) {
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ghRelease{
+			TagName: "v1.0.0",
+			Body:    "* fixed things",
+			Assets:  []ghAsset{{Name: "tool_1.0.0_Linux_x86_64.tar.gz"}},
+		})
+	})
+
+	rel, err := resolveRelease(&Config{Repo: "owner/tool", Version: "v1.0.0", BinaryName: "tool"})
+	if err != nil {
+		t.Fatalf("resolveRelease: %v", err)
+	}
+	if rel.Tag != "v1.0.0" || rel.Notes != "* fixed things" || len(rel.Assets) != 1 {
+		t.Errorf("release = %+v", rel)
+	}
+}
+
+func TestResolveRelease_BinaryPath(t *testing.T) {
+	withMockGitHub(t, func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(ghRelease{
+			TagName: "v1.0.0",
+			Assets: []ghAsset{
+				{Name: "tool_1.0.0_Linux_x86_64.tar.gz"},
+				{Name: "tool_1.0.0_Windows_x86_64.zip"},
+			},
+		})
+	})
+
+	rel, err := resolveRelease(&Config{
+		Repo: "owner/tool", Version: "v1.0.0", BinaryName: "tool",
+		BinaryPath: "{binary}_{version}_{os}_{arch}/bin/{binary}{exe}",
+	})
+	if err != nil {
+		t.Fatalf("resolveRelease: %v", err)
+	}
+	got := map[string]string{}
+	for _, ae := range rel.Assets {
+		got[ae.PlatformKey] = ae.BinaryInArc
+	}
+	want := map[string]string{
+		"Linux_x86_64":   "tool_1.0.0_linux_amd64/bin/tool",
+		"Windows_x86_64": "tool_1.0.0_windows_amd64/bin/tool.exe",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestApplyBinaryPath_PlatformMapWins(t *testing.T) {
+	orig := knownPlatforms
+	t.Cleanup(func() { knownPlatforms = orig })
+	linux := orig["Linux_x86_64"]
+	linux.binaryPath = "usr/bin/{binary}"
+	knownPlatforms = map[string]platformDef{
+		"Linux_x86_64":   linux,
+		"Windows_x86_64": orig["Windows_x86_64"],
+	}
+
+	entries := []assetEntry{
+		{PlatformKey: "Linux_x86_64", BinaryInArc: "usr/bin/tool"},
+		{PlatformKey: "Windows_x86_64", BinaryInArc: "tool.exe"},
+	}
+	applyBinaryPath(entries, "bin/{binary}{exe}", "v1.0.0", "tool")
+	if entries[0].BinaryInArc != "usr/bin/tool" {
+		t.Errorf("Linux_x86_64 = %q, want the -platform-map path kept", entries[0].BinaryInArc)
+	}
+	if entries[1].BinaryInArc != "bin/tool.exe" {
+		t.Errorf("Windows_x86_64 = %q, want bin/tool.exe", entries[1].BinaryInArc)
+	}
+}
+
+func TestResolveAssets_AssetPattern(t *testing.T) {
+	re, err := compileAssetPattern(`^tool-(?P<os>linux|darwin)-(?P<arch>amd64|arm64)\.tar\.gz$`)
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	cfg := &Config{BinaryName: "tool", AssetPattern: re}
+	got, err := resolveAssets(cfg, assetList("tool-linux-amd64.tar.gz", "tool_1.0.0_Darwin_arm64.tar.gz"), "v1.0.0")
+	if err != nil {
+		t.Fatalf("resolveAssets: %v", err)
+	}
+	if len(got) != 1 || got[0].PlatformKey != "Linux_x86_64" {
+		t.Errorf("entries = %+v, want only the asset matching the pattern", got)
+	}
+}
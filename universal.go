@@ -0,0 +1,166 @@
+// universal.go — macOS universal2 wheels.
+//
+// A universal2 wheel carries a fat Mach-O binary with both an x86_64 and an
+// arm64 slice, so it works under any macOS Python, including an x86_64
+// interpreter running under Rosetta on Apple Silicon. The binary comes from a
+// GoReleaser universal (darwin_all) archive when the release has one, and is
+// otherwise combined from the thin amd64 and arm64 binaries, like lipo
+// -create.
+package main
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+)
+
+// -universal2 modes.
+const (
+	universal2Off  = "off"  // thin Darwin wheels only
+	universal2Add  = "add"  // universal2 wheel alongside the thin ones
+	universal2Only = "only" // universal2 wheel instead of the thin ones
+)
+
+// universalPlatformKey is the knownPlatforms key of the universal2 target.
+const universalPlatformKey = "Darwin_all"
+
+// fatAlign is the log2 alignment of each slice in a fat binary. 16 KiB is the
+// arm64 page size, and lipo uses no less for arm64 slices.
+const fatAlign = 14
+
+// planUniversal2 adjusts the Darwin entries of a resolved release for mode:
+//
+//   - A universal (Darwin_all) asset yields the universal2 wheel, and thin
+//     Darwin entries that merely fell back to it are dropped. With "off" the
+//     universal entry is dropped instead.
+//   - Without a universal asset, "add" and "only" synthesise a Darwin_all
+//     entry from the thin x86_64 and arm64 entries, whose binaries are
+//     combined at build time, provided Darwin_all is among wantPlatforms.
+//   - "only" drops the thin Darwin entries once there is a universal2 one.
+func planUniversal2(entries []assetEntry, mode string, wantPlatforms []string) []assetEntry {
+	if mode == "" {
+		mode = universal2Off
+	}
+	var universal, amd64, arm64 *assetEntry
+	for i := range entries {
+		switch entries[i].PlatformKey {
+		case universalPlatformKey:
+			universal = &entries[i]
+		case "Darwin_x86_64":
+			amd64 = &entries[i]
+		case "Darwin_arm64":
+			arm64 = &entries[i]
+		}
+	}
+
+	var synth *assetEntry
+	if universal == nil && mode != universal2Off && buildWantedSet(wantPlatforms)[universalPlatformKey] {
+		switch {
+		case amd64 != nil && arm64 != nil:
+			def := knownPlatforms[universalPlatformKey]
+			synth = &assetEntry{
+				PlatformKey: universalPlatformKey,
+				WheelTag:    def.wheelTag,
+				BinaryInArc: amd64.BinaryInArc,
+				AssetName:   amd64.AssetName + "+" + arm64.AssetName,
+				Universal:   []assetEntry{*amd64, *arm64},
+			}
+		case amd64 != nil || arm64 != nil:
+			slog.Warn("universal2 needs both Darwin_x86_64 and Darwin_arm64 assets, skipping")
+		}
+	}
+	haveUniversal := universal != nil || synth != nil
+
+	var out []assetEntry
+	for _, e := range entries {
+		isThin := e.PlatformKey == "Darwin_x86_64" || e.PlatformKey == "Darwin_arm64"
+		switch {
+		case e.PlatformKey == universalPlatformKey && mode == universal2Off:
+			continue
+		case isThin && mode == universal2Only && haveUniversal:
+			continue
+		case isThin && mode != universal2Off && universal != nil && e.AssetName == universal.AssetName:
+			slog.Debug("thin platform falls back to universal asset, building universal2 only", "platform", e.PlatformKey)
+			continue
+		}
+		out = append(out, e)
+	}
+	if synth != nil {
+		out = append(out, *synth)
+	}
+	return out
+}
+
+// lipo combines thin Mach-O executables into a fat (universal) binary
+// written to w. Each input must be a thin Mach-O of a different CPU type.
+func lipo(w io.Writer, thin ...*io.SectionReader) error {
+	type slice struct {
+		cpu    macho.Cpu
+		subcpu uint32
+		data   *io.SectionReader
+	}
+	var slices []slice
+	seen := map[macho.Cpu]bool{}
+	for i, data := range thin {
+		f, err := macho.NewFile(data)
+		if err != nil {
+			return fmt.Errorf("lipo: input %d is not a thin Mach-O binary: %w", i, err)
+		}
+		f.Close()
+		if seen[f.Cpu] {
+			return fmt.Errorf("lipo: two inputs for CPU %s", f.Cpu)
+		}
+		seen[f.Cpu] = true
+		// The fat header records the subtype as the Mach-O header has it,
+		// capability bits included, as Apple's lipo does.
+		slices = append(slices, slice{f.Cpu, f.SubCpu, data})
+	}
+
+	// fat_header is 8 bytes, followed by one 20-byte fat_arch per slice.
+	// Offsets and sizes are 32-bit, so every slice must end below 4 GiB.
+	offset := align(uint64(8+20*len(slices)), 1<<fatAlign)
+
+	var hdr bytes.Buffer
+	put := func(v uint32) { binary.Write(&hdr, binary.BigEndian, v) }
+	put(macho.MagicFat)
+	put(uint32(len(slices)))
+	offsets := make([]uint64, len(slices))
+	for i, s := range slices {
+		end := offset + uint64(s.data.Size())
+		if end > math.MaxUint32 {
+			return fmt.Errorf("lipo: input %d ends at byte %d, beyond the 4 GiB limit of a fat binary", i, end)
+		}
+		offsets[i] = offset
+		put(uint32(s.cpu))
+		put(s.subcpu)
+		put(uint32(offset))
+		put(uint32(s.data.Size()))
+		put(fatAlign)
+		offset = align(end, 1<<fatAlign)
+	}
+	if _, err := w.Write(hdr.Bytes()); err != nil {
+		return fmt.Errorf("lipo: %w", err)
+	}
+	written := int64(hdr.Len())
+	for i, s := range slices {
+		pad := int64(offsets[i]) - written
+		if _, err := w.Write(make([]byte, pad)); err != nil {
+			return fmt.Errorf("lipo: %w", err)
+		}
+		n, err := io.Copy(w, io.NewSectionReader(s.data, 0, s.data.Size()))
+		if err != nil {
+			return fmt.Errorf("lipo: %w", err)
+		}
+		written += pad + n
+	}
+	return nil
+}
+
+// align rounds n up to a multiple of a, a power of two.
+func align(n, a uint64) uint64 {
+	return (n + a - 1) &^ (a - 1)
+}
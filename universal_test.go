@@ -0,0 +1,143 @@
+// universal_test.go
+package main
+
+import (
+	"bytes"
+	"debug/macho"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+// makeMachO returns a minimal thin 64-bit Mach-O executable for cpu, padded
+// with body.
+func makeMachO(t *testing.T, cpu macho.Cpu, body string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	hdr := macho.FileHeader{Magic: macho.Magic64, Cpu: cpu, SubCpu: 3 | 0x80000000, Type: macho.TypeExec}
+	if err := binary.Write(&buf, binary.LittleEndian, hdr); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(make([]byte, 4)) // reserved field of mach_header_64
+	buf.WriteString(body)
+	return buf.Bytes()
+}
+
+func TestLipo(t *testing.T) {
+	amd64 := makeMachO(t, macho.CpuAmd64, "x86 code")
+	arm64 := makeMachO(t, macho.CpuArm64, "arm code")
+
+	var buf bytes.Buffer
+	if err := lipo(&buf, sectionOf(amd64), sectionOf(arm64)); err != nil {
+		t.Fatalf("lipo: %v", err)
+	}
+	fat := buf.Bytes()
+	ff, err := macho.NewFatFile(bytes.NewReader(fat))
+	if err != nil {
+		t.Fatalf("NewFatFile: %v", err)
+	}
+	defer ff.Close()
+
+	if len(ff.Arches) != 2 {
+		t.Fatalf("got %d arches, want 2", len(ff.Arches))
+	}
+	for i, want := range [][]byte{amd64, arm64} {
+		a := ff.Arches[i]
+		if a.Offset%(1<<fatAlign) != 0 {
+			t.Errorf("slice %d offset %d not aligned", i, a.Offset)
+		}
+		if a.SubCpu != 3|0x80000000 {
+			t.Errorf("slice %d subcpu = %#x, want the header's, capability bits included", i, a.SubCpu)
+		}
+		if got := fat[a.Offset : a.Offset+a.Size]; !bytes.Equal(got, want) {
+			t.Errorf("slice %d content differs from input", i)
+		}
+	}
+}
+
+// zeroPadded is a ReaderAt of data followed by zeros, standing in for a large
+// binary without allocating it.
+type zeroPadded []byte
+
+func (z zeroPadded) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		p[i] = 0
+		if j := off + int64(i); j < int64(len(z)) {
+			p[i] = z[j]
+		}
+	}
+	return len(p), nil
+}
+
+func TestLipo_RejectsOversizedTotal(t *testing.T) {
+	// Each slice fits in 32 bits on its own, but not both together.
+	const size = 3 << 30
+	amd64 := io.NewSectionReader(zeroPadded(makeMachO(t, macho.CpuAmd64, "")), 0, size)
+	arm64 := io.NewSectionReader(zeroPadded(makeMachO(t, macho.CpuArm64, "")), 0, size)
+	var buf bytes.Buffer
+	if err := lipo(&buf, amd64, arm64); err == nil {
+		t.Error("expected error for slices past the 4 GiB limit")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("wrote %d bytes before failing", buf.Len())
+	}
+}
+
+func TestLipo_RejectsBadInput(t *testing.T) {
+	amd64 := makeMachO(t, macho.CpuAmd64, "")
+	if err := lipo(io.Discard, sectionOf(amd64), sectionOf(amd64)); err == nil {
+		t.Error("expected error for duplicate CPU")
+	}
+	if err := lipo(io.Discard, sectionOf(amd64), sectionOf([]byte("ELF"))); err == nil {
+		t.Error("expected error for non-Mach-O input")
+	}
+}
+
+func TestPlanUniversal2(t *testing.T) {
+	linux := assetEntry{PlatformKey: "Linux_x86_64", AssetName: "tool_Linux_x86_64.tar.gz"}
+	amd64 := assetEntry{PlatformKey: "Darwin_x86_64", AssetName: "tool_Darwin_x86_64.tar.gz", BinaryInArc: "tool"}
+	arm64 := assetEntry{PlatformKey: "Darwin_arm64", AssetName: "tool_Darwin_arm64.tar.gz", BinaryInArc: "tool"}
+	all := assetEntry{PlatformKey: "Darwin_all", AssetName: "tool_Darwin_all.tar.gz", BinaryInArc: "tool"}
+	fallback := func(key string) assetEntry {
+		e := all
+		e.PlatformKey = key
+		return e
+	}
+
+	keys := func(entries []assetEntry) []string {
+		var out []string
+		for _, e := range entries {
+			out = append(out, e.PlatformKey)
+		}
+		return out
+	}
+	tests := []struct {
+		name    string
+		entries []assetEntry
+		mode    string
+		want    []string
+	}{
+		{"add combines thin", []assetEntry{linux, amd64, arm64}, universal2Add, []string{"Linux_x86_64", "Darwin_x86_64", "Darwin_arm64", "Darwin_all"}},
+		{"only combines thin", []assetEntry{linux, amd64, arm64}, universal2Only, []string{"Linux_x86_64", "Darwin_all"}},
+		{"off keeps thin", []assetEntry{linux, amd64, arm64}, universal2Off, []string{"Linux_x86_64", "Darwin_x86_64", "Darwin_arm64"}},
+		{"one thin only", []assetEntry{amd64}, universal2Only, []string{"Darwin_x86_64"}},
+		{"universal asset", []assetEntry{fallback("Darwin_x86_64"), fallback("Darwin_arm64"), all}, universal2Add, []string{"Darwin_all"}},
+		{"universal asset off", []assetEntry{fallback("Darwin_x86_64"), fallback("Darwin_arm64"), all}, universal2Off, []string{"Darwin_x86_64", "Darwin_arm64"}},
+		{"universal and thin assets", []assetEntry{amd64, arm64, all}, universal2Add, []string{"Darwin_x86_64", "Darwin_arm64", "Darwin_all"}},
+	}
+	for _, tt := range tests {
+		got := planUniversal2(tt.entries, tt.mode, nil)
+		if g := keys(got); !reflect.DeepEqual(g, tt.want) {
+			t.Errorf("%s: platforms = %v, want %v", tt.name, g, tt.want)
+		}
+	}
+
+	got := planUniversal2([]assetEntry{amd64, arm64}, universal2Add, nil)
+	if u := got[len(got)-1]; len(u.Universal) != 2 || u.WheelTag != "macosx_11_0_universal2" {
+		t.Errorf("synthesised entry = %+v", u)
+	}
+	if got := planUniversal2([]assetEntry{amd64, arm64}, universal2Add, []string{"Darwin_x86_64", "Darwin_arm64"}); len(got) != 2 {
+		t.Errorf("universal2 synthesised although Darwin_all is not wanted: %v", keys(got))
+	}
+}
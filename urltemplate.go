@@ -0,0 +1,130 @@
+// urltemplate.go — release source for binaries hosted outside a forge (own
+// CDN, Artifactory generic repositories, S3 buckets...), described by a URL
+// template that is expanded once per platform.
+//
+// Placeholders:
+//
+//	{version}  version without a leading "v", e.g. 1.4.2
+//	{tag}      -version exactly as given, e.g. v1.4.2
+//	{binary}   -binary-name
+//	{os}       GOOS, e.g. linux, darwin, windows
+//	{arch}     GOARCH, e.g. amd64, arm64, arm
+//	{arm}      GOARM for 32-bit ARM, e.g. 7; "" elsewhere
+//	{Os}       GoReleaser OS spelling, e.g. Linux, Darwin, Windows
+//	{Arch}     GoReleaser arch spelling, e.g. x86_64, arm64, armv7, i386
+//	{ext}      archive extension, e.g. tar.gz, zip
+//	{exe}      ".exe" on Windows, "" elsewhere
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// expandURLTemplate substitutes the placeholders of tmpl for one platform.
+func expandURLTemplate(tmpl, tag, binaryName, platKey string, def platformDef) string {
+	osName, archName, _ := strings.Cut(platKey, "_")
+	return strings.NewReplacer(
+		"{version}", strings.TrimPrefix(tag, "v"),
+		"{tag}", tag,
+		"{binary}", binaryName,
+		"{os}", def.goos,
+		"{arch}", def.goarch,
+		"{arm}", def.goarm,
+		"{Os}", osName,
+		"{Arch}", archName,
+		"{ext}", def.archiveExt,
+		"{exe}", def.exe,
+	).Replace(tmpl)
+}
+
+// probeURL reports whether assetURL exists, using a HEAD request. Only a 404
+// means the asset is missing; any other failure is returned as an error.
+// Servers that reject HEAD with 405 are given the benefit of the doubt; the
+// download itself will then fail loudly if the file is missing.
+func probeURL(assetURL string) (bool, error) {
+	req, err := http.NewRequest(http.MethodHead, assetURL, nil)
+	if err != nil {
+		return false, err
+	}
+	if auth, ok := hostCredentials[req.URL.Host]; ok {
+		req.Header.Set("Authorization", auth)
+	}
+	resp, err := downloadClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusMethodNotAllowed:
+		slog.Debug("HEAD not allowed, assuming asset exists", "url", assetURL)
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	default:
+		return false, fmt.Errorf("HEAD %s: %s", assetURL, resp.Status)
+	}
+}
+
+// resolveURLTemplate expands cfg.URLTemplate for every wanted platform and
+// keeps those whose URL answers a HEAD probe. A platform whose probe fails
+// for any reason other than a 404 is skipped with a warning, so one flaky or
+// forbidden URL does not stop the others. It requires an explicit tag. The
+// last path segment may be the same for every platform and version
+// (.../{os}/{arch}/{binary}), so each asset is named after a hash of its whole
+// URL as well, since the name keys the download cache.
+func resolveURLTemplate(cfg *Config) (string, []assetEntry, error) {
+	tag := cfg.Version
+	if tag == "" || isReleaseQuery(tag) {
+		return "", nil, fmt.Errorf("-url-template requires an explicit -version, e.g. -version v1.4.2")
+	}
+	wanted := buildWantedSet(cfg.Platforms)
+
+	var result []assetEntry
+	for _, platKey := range platformKeys() {
+		if !wanted[platKey] {
+			continue
+		}
+		def := knownPlatforms[platKey]
+		assetURL := expandURLTemplate(cfg.URLTemplate, tag, cfg.BinaryName, platKey, def)
+		u, err := url.Parse(assetURL)
+		if err != nil {
+			return "", nil, fmt.Errorf("-url-template: %w", err)
+		}
+
+		ok, err := probeURL(assetURL)
+		if err != nil {
+			slog.Warn("probing templated URL failed, skipping platform", "platform", platKey, "error", err)
+			continue
+		}
+		if !ok {
+			slog.Debug("no asset at templated URL, skipping", "platform", platKey, "url", assetURL)
+			continue
+		}
+
+		binInArc := def.binaryInArchive(cfg.BinaryName)
+		name := path.Base(u.Path)
+		ext := detectArchiveExt(name)
+		if ext == "" {
+			ext = def.archiveExt
+		}
+		sum := sha256.Sum256([]byte(assetURL))
+		result = append(result, assetEntry{
+			PlatformKey: platKey,
+			WheelTag:    def.wheelTag,
+			ArchiveExt:  ext,
+			BinaryInArc: binInArc,
+			AssetName:   fmt.Sprintf("%x_%s", sum[:6], name),
+			URL:         assetURL,
+		})
+	}
+	return tag, result, nil
+}
@@ -0,0 +1,160 @@
+// urltemplate_test.go
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExpandURLTemplate(t *testing.T) {
+	tmpl := "https://dl.example.com/{tag}/{version}/{binary}_{os}_{arch}.{ext}|{Os}_{Arch}{exe}"
+	tests := []struct {
+		platKey string
+		want    string
+	}{
+		{"Linux_x86_64", "https://dl.example.com/v1.4.2/1.4.2/tool_linux_amd64.tar.gz|Linux_x86_64"},
+		{"Windows_arm64", "https://dl.example.com/v1.4.2/1.4.2/tool_windows_arm64.zip|Windows_arm64.exe"},
+		{"Linux_armv7", "https://dl.example.com/v1.4.2/1.4.2/tool_linux_arm.tar.gz|Linux_armv7"},
+	}
+	for _, tt := range tests {
+		got := expandURLTemplate(tmpl, "v1.4.2", "tool", tt.platKey, knownPlatforms[tt.platKey])
+		if got != tt.want {
+			t.Errorf("expandURLTemplate(%s) = %q, want %q", tt.platKey, got, tt.want)
+		}
+	}
+}
+
+func TestResolveURLTemplate_ProbesEachPlatform(t *testing.T) {
+	var probed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodHead {
+			t.Errorf("method = %s, want HEAD", r.Method)
+		}
+		probed = append(probed, r.URL.Path)
+		switch r.URL.Path {
+		case "/1.4.2/tool_linux_amd64.tar.gz", "/1.4.2/tool_windows_amd64.zip":
+			w.WriteHeader(http.StatusOK)
+		case "/1.4.2/tool_darwin_arm64.tar.gz":
+			w.WriteHeader(http.StatusForbidden)
+		case "/1.4.2/tool_linux_arm64.tar.gz":
+			w.WriteHeader(http.StatusBadGateway)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer srv.Close()
+
+	cfg := &Config{
+		URLTemplate: srv.URL + "/{version}/{binary}_{os}_{arch}.{ext}",
+		Version:     "v1.4.2",
+		BinaryName:  "tool",
+	}
+	tag, entries, err := resolveURLTemplate(cfg)
+	if err != nil {
+		t.Fatalf("resolveURLTemplate: %v", err)
+	}
+	if tag != "v1.4.2" {
+		t.Errorf("tag = %q, want v1.4.2", tag)
+	}
+	if want := len(buildWantedSet(nil)); len(probed) != want {
+		t.Errorf("probed %d URLs, want one per default platform (%d)", len(probed), want)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2 (403 and 502 skip their platform): %+v", len(entries), entries)
+	}
+
+	linux, win := entries[0], entries[1]
+	if linux.PlatformKey != "Linux_x86_64" || linux.ArchiveExt != "tar.gz" || linux.BinaryInArc != "tool" {
+		t.Errorf("linux entry = %+v", linux)
+	}
+	if !strings.HasSuffix(linux.AssetName, "_tool_linux_amd64.tar.gz") || linux.URL != srv.URL+"/1.4.2/tool_linux_amd64.tar.gz" {
+		t.Errorf("linux entry = %+v", linux)
+	}
+	if win.PlatformKey != "Windows_x86_64" || win.ArchiveExt != "zip" || win.BinaryInArc != "tool.exe" {
+		t.Errorf("windows entry = %+v", win)
+	}
+}
+
+func TestResolveURLTemplate_FiltersPlatforms(t *testing.T) {
+	var probed []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		probed = append(probed, r.URL.Path)
+	}))
+	defer srv.Close()
+
+	cfg := &Config{
+		URLTemplate: srv.URL + "/{binary}-{os}-{arch}.{ext}",
+		Version:     "1.0.0",
+		BinaryName:  "tool",
+		Platforms:   []string{"Darwin_arm64"},
+	}
+	_, entries, err := resolveURLTemplate(cfg)
+	if err != nil {
+		t.Fatalf("resolveURLTemplate: %v", err)
+	}
+	if len(probed) != 1 || probed[0] != "/tool-darwin-arm64.tar.gz" {
+		t.Errorf("probed = %v, want only the darwin arm64 URL", probed)
+	}
+	if len(entries) != 1 || entries[0].WheelTag != "macosx_11_0_arm64" {
+		t.Errorf("entries = %+v", entries)
+	}
+}
+
+func TestResolveURLTemplate_RequiresVersion(t *testing.T) {
+	for _, v := range []string{"", "latest-stable", "^1.2"} {
+		cfg := &Config{URLTemplate: "https://dl.example.com/{version}/x.tar.gz", Version: v, BinaryName: "x"}
+		_, _, err := resolveURLTemplate(cfg)
+		if err == nil || !strings.Contains(err.Error(), "-version") {
+			t.Errorf("version %q: err = %v, want a -version error", v, err)
+		}
+	}
+}
+
+func TestProbeURL_ServerError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if _, err := probeURL(srv.URL + "/x.tar.gz"); err == nil {
+		t.Fatal("expected error for 500 response")
+	}
+}
+
+func TestResolveURLTemplate_SameFileNamePerPlatform(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("binary for " + r.URL.Path))
+	}))
+	defer srv.Close()
+
+	cfg := &Config{
+		URLTemplate: srv.URL + "/{version}/{os}/{arch}/{binary}{exe}",
+		Version:     "v1.4.2",
+		BinaryName:  "tool",
+		Platforms:   []string{"Linux_x86_64", "Linux_arm64"},
+	}
+	_, entries, err := resolveURLTemplate(cfg)
+	if err != nil {
+		t.Fatalf("resolveURLTemplate: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(entries), entries)
+	}
+	if entries[0].AssetName == entries[1].AssetName {
+		t.Fatalf("both platforms share the asset name %q", entries[0].AssetName)
+	}
+
+	// With a shared cache, each platform still gets its own download.
+	cacheDir := t.TempDir()
+	for _, ae := range entries {
+		data, err := downloadBytes(downloadAsset(ae, cacheDir))
+		if err != nil {
+			t.Fatalf("downloadAsset(%s): %v", ae.PlatformKey, err)
+		}
+		if want := "binary for " + strings.TrimPrefix(ae.URL, srv.URL); string(data) != want {
+			t.Errorf("%s: downloaded %q, want %q", ae.PlatformKey, data, want)
+		}
+	}
+}
@@ -1,9 +1,10 @@
 // wheel.go — Python wheel (.whl) construction.
 //
 // A wheel is a zip file with a specific internal layout. This file handles
-// building the shim package, metadata, and RECORD, then writing the zip.
+// building the shim package, metadata, and RECORD, then writing the zip. The
+// zip is streamed to the output file, so the binary is never held in memory.
 //
-// Note: the Python compatibility tag is "py30" (any Python 3), consistent with
+// Note: the Python compatibility tag is "py3" (any Python 3), consistent with
 // the Tag field in the WHEEL metadata.
 package main
 
@@ -13,10 +14,15 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
+	"hash"
 	"hash/crc32"
+	"io"
 	"log/slog"
+	"math"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -27,17 +33,95 @@ func normalize(name string) string {
 	return strings.ReplaceAll(name, "-", "_")
 }
 
+// pep440Pattern matches the version spellings PEP 440 accepts, after
+// lowercasing: release, pre-release, post-release, dev release and local
+// label, each with optional separators.
+var pep440Pattern = regexp.MustCompile(`^v?(\d+(?:\.\d+)*)` +
+	`(?:[-_.]?(a|alpha|b|beta|c|rc|pre|preview)[-_.]?(\d*))?` +
+	`(?:[-_.]?(post|rev|r)[-_.]?(\d*)|-(\d+))?` +
+	`(?:[-_.]?(dev)[-_.]?(\d*))?` +
+	`(?:\+([a-z0-9]+(?:[-_.][a-z0-9]+)*))?$`)
+
+// pep440PreLabels maps pre-release spellings to their normal form.
+var pep440PreLabels = map[string]string{
+	"a": "a", "alpha": "a",
+	"b": "b", "beta": "b",
+	"c": "rc", "rc": "rc", "pre": "rc", "preview": "rc",
+}
+
+// snapshotPattern matches the version of a GoReleaser snapshot build, after
+// lowercasing: "1.3.0-snapshot-abc1234" or "1.3.0-snapshot".
+var snapshotPattern = regexp.MustCompile(`^(.+)-snapshot(?:-([a-z0-9]+))?$`)
+
+// normalizeVersion returns the normal form of a PEP 440 version, which is
+// the form PyPI stores: "v1.2.0-rc.1" becomes "1.2.0rc1" and "1.0.0-beta"
+// becomes "1.0.0b0". A GoReleaser snapshot version becomes a dev release
+// with the commit as local label: "1.3.0-SNAPSHOT-abc1234" becomes
+// "1.3.0.dev0+abc1234". Versions PEP 440 does not accept are an error, since
+// they would produce a wheel that cannot be installed or uploaded.
+func normalizeVersion(v string) (string, error) {
+	lower := strings.ToLower(strings.TrimSpace(v))
+	if sm := snapshotPattern.FindStringSubmatch(lower); sm != nil {
+		base, err := normalizeVersion(sm[1])
+		if err != nil || strings.Contains(base, "+") || strings.Contains(base, ".dev") {
+			return "", fmt.Errorf("snapshot version %q has no PEP 440 form; pass -py-version", v)
+		}
+		base += ".dev0"
+		if sm[2] != "" {
+			base += "+" + sm[2]
+		}
+		return base, nil
+	}
+	m := pep440Pattern.FindStringSubmatch(lower)
+	if m == nil {
+		return "", fmt.Errorf("version %q is not a valid PEP 440 version; pass -py-version", v)
+	}
+	// num drops leading zeros; an omitted number is 0.
+	num := func(s string) string {
+		n, _ := strconv.Atoi(s)
+		return strconv.Itoa(n)
+	}
+
+	release := strings.Split(m[1], ".")
+	for i, r := range release {
+		release[i] = num(r)
+	}
+	out := strings.Join(release, ".")
+	if m[2] != "" {
+		out += pep440PreLabels[m[2]] + num(m[3])
+	}
+	switch {
+	case m[4] != "":
+		out += ".post" + num(m[5])
+	case m[6] != "":
+		out += ".post" + num(m[6])
+	}
+	if m[7] != "" {
+		out += ".dev" + num(m[8])
+	}
+	if m[9] != "" {
+		out += "+" + strings.NewReplacer("-", ".", "_", ".").Replace(m[9])
+	}
+	return out, nil
+}
+
 // wheelFilename returns the canonical .whl filename for the given package,
 // version, and platform tag.
 func wheelFilename(pkg, version, plat string) string {
-	return fmt.Sprintf("%s-%s-py30-none-%s.whl", normalize(pkg), version, plat)
+	return fmt.Sprintf("%s-%s-py3-none-%s.whl", normalize(pkg), version, plat)
 }
 
 // recordHash returns the base64url (no-padding) SHA-256 digest of data in the
 // "sha256=<digest>" format required by the wheel RECORD spec.
 func recordHash(data []byte) string {
-	sum := sha256.Sum256(data)
-	return "sha256=" + base64.RawURLEncoding.EncodeToString(sum[:])
+	h := sha256.New()
+	h.Write(data)
+	return recordDigest(h)
+}
+
+// recordDigest formats the sum of a SHA-256 hash like recordHash.
+func recordDigest(h hash.Hash) string {
+	return "sha256=" + base64.RawURLEncoding.EncodeToString(h.Sum(nil))
 }
 
 // unixShim uses os.execv to replace the current process — zero subprocess
@@ -67,23 +151,27 @@ type wheelEntry struct {
 }
 
 // buildWheel writes a Python wheel containing the given binary, shim package,
-// and metadata. It returns the path of the written .whl file.
+// and metadata. It returns the path of the written .whl file; on error no
+// partial file is left behind.
 //
 // Parameters:
-//   - binaryData: raw bytes of the executable
+//   - binary: the executable, read twice (once to hash, once to copy)
 //   - binaryFilename: filename the binary will have inside the wheel
 //   - binVer: upstream binary version string (without leading "v")
 //   - cfg: build configuration (package name, repo, etc.)
 //   - pyVersion: Python package version string
-//   - plat: Python wheel platform tag
+//   - plat: Python wheel platform tag, or a "."-separated compressed tag set
 //   - descriptionData: Markdown long description
 //   - licenseData: license file contents
+//   - extra: additional files (-include); a name starting with "share/" goes
+//     under the wheel's data scheme, any other is relative to the package
 func buildWheel(
-	binaryData []byte,
+	binary *io.SectionReader,
 	binaryFilename, binVer string,
 	cfg *Config,
 	pyVersion, plat string,
 	descriptionData, licenseData []byte,
+	extra ...wheelEntry,
 ) (string, error) {
 	pkg := cfg.PackageName
 	pkgNorm := normalize(pkg)
@@ -106,13 +194,18 @@ func buildWheel(
 		licenseExpr = "MIT"
 	}
 
+	projectURLLine := ""
+	if u := projectURL(cfg); u != "" {
+		projectURLLine = "Project-URL: Source, " + u + "\n"
+	}
+
 	// Metadata 2.4: long description in message body after blank line.
 	metadata := fmt.Sprintf(
 		"Metadata-Version: 2.4\n"+
 			"Name: %s\n"+
 			"Version: %s\n"+
 			"Summary: %s\n"+
-			"Project-URL: Source, https://github.com/%s\n"+
+			"%s"+
 			"Classifier: Programming Language :: Python :: 3\n"+
 			"License-Expression: %s\n"+
 			"License-File: LICENSE.txt\n"+
@@ -120,13 +213,16 @@ func buildWheel(
 			"Description-Content-Type: text/markdown; charset=UTF-8; variant=GFM\n"+
 			"\n"+
 			"%s",
-		pkg, pyVersion, cfg.Summary, cfg.Repo, licenseExpr, string(descriptionData),
+		pkg, pyVersion, cfg.Summary, projectURLLine, licenseExpr, string(descriptionData),
 	)
 
-	wheelMeta := fmt.Sprintf(
-		"Wheel-Version: 1.0\nGenerator: buildwheels\nRoot-Is-Purelib: false\nTag: py3-none-%s\n",
-		plat,
-	)
+	// A compressed tag set such as "manylinux_2_17_x86_64.musllinux_1_1_x86_64"
+	// is expanded to one Tag line per platform.
+	var wheelMeta strings.Builder
+	wheelMeta.WriteString("Wheel-Version: 1.0\nGenerator: buildwheels\nRoot-Is-Purelib: false\n")
+	for _, p := range strings.Split(plat, ".") {
+		fmt.Fprintf(&wheelMeta, "Tag: py3-none-%s\n", p)
+	}
 
 	entryPoints := fmt.Sprintf(
 		"[console_scripts]\n%s = %s._shim:main\n",
@@ -134,75 +230,119 @@ func buildWheel(
 	)
 
 	entries := []wheelEntry{
-		{pkgNorm + "/" + binaryFilename, binaryData, true},
 		{pkgNorm + "/__init__.py", []byte(initSrc), false},
 		{pkgNorm + "/_shim.py", []byte(shimSrc), false},
 		{distInfo + "/METADATA", []byte(metadata), false},
-		{distInfo + "/WHEEL", []byte(wheelMeta), false},
+		{distInfo + "/WHEEL", []byte(wheelMeta.String()), false},
 		{distInfo + "/entry_points.txt", []byte(entryPoints), false},
 		{distInfo + "/licenses/LICENSE.txt", licenseData, false},
 	}
 
-	// Build RECORD (path, hash, size per entry; RECORD itself has empty hash/size).
-	var rec strings.Builder
+	// Extra files must not replace the generated ones.
+	names := make(map[string]bool, len(entries)+len(extra)+1)
+	names[pkgNorm+"/"+binaryFilename] = true
 	for _, e := range entries {
-		fmt.Fprintf(&rec, "%s,%s,%d\n", e.name, recordHash(e.data), len(e.data))
+		names[e.name] = true
 	}
-	recordName := distInfo + "/RECORD"
-	fmt.Fprintf(&rec, "%s,,\n", recordName)
+	dataDir := fmt.Sprintf("%s-%s.data/data/", pkgNorm, pyVersion)
+	for _, e := range extra {
+		if strings.HasPrefix(e.name, "share/") {
+			e.name = dataDir + e.name
+		} else {
+			e.name = pkgNorm + "/" + e.name
+		}
+		if names[e.name] {
+			return "", fmt.Errorf("extra file %s conflicts with a wheel entry", e.name)
+		}
+		names[e.name] = true
+		entries = append(entries, e)
+	}
+
+	out := filepath.Join(cfg.Output, wheelFilename(pkg, pyVersion, plat))
+	f, err := os.Create(out)
+	if err != nil {
+		return "", fmt.Errorf("write wheel: %w", err)
+	}
+	err = writeWheelZip(f, distInfo+"/RECORD", pkgNorm+"/"+binaryFilename, binary, entries)
+	if cerr := f.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("write wheel: %w", cerr)
+	}
+	if err != nil {
+		os.Remove(out)
+		return "", err
+	}
+	slog.Debug("wrote wheel", "path", out)
+	return out, nil
+}
 
-	// Write the zip.
-	// We populate both the 32-bit and 64-bit size fields explicitly to stay
-	// in standard zip32 format (avoiding zip64 extra fields that confuse some
-	// wheel installers), and set Flags=0 to suppress the data-descriptor bit
-	// that causes twine/PyPI to reject the upload.
-	buf := new(bytes.Buffer)
-	zw := zip.NewWriter(buf)
+// writeWheelZip writes the wheel zip to w: the binary as binaryName, then
+// entries, then RECORD (path, hash, size per entry; RECORD itself has empty
+// hash/size) as recordName, which must be the last entry.
+//
+// We populate both the 32-bit and 64-bit size fields explicitly to stay in
+// standard zip32 format (avoiding zip64 extra fields that confuse some wheel
+// installers), and set Flags=0 to suppress the data-descriptor bit that
+// causes twine/PyPI to reject the upload. Both need the size and CRC-32 up
+// front, so each entry is read once to hash it and again to copy it.
+func writeWheelZip(w io.Writer, recordName, binaryName string, binary *io.SectionReader, entries []wheelEntry) error {
+	zw := zip.NewWriter(w)
+	var rec strings.Builder
 
-	addEntry := func(e wheelEntry) error {
-		sz := uint64(len(e.data))
+	addEntry := func(name string, r *io.SectionReader, exe bool) error {
+		crc, sum := crc32.NewIEEE(), sha256.New()
+		n, err := io.Copy(io.MultiWriter(crc, sum), io.NewSectionReader(r, 0, r.Size()))
+		if err != nil {
+			return err
+		}
+		if n > math.MaxUint32 {
+			return fmt.Errorf("%d bytes is too large for a wheel entry", n)
+		}
+		sz := uint64(n)
 		sz32 := uint32(sz)
 		fh := &zip.FileHeader{
-			Name:               e.name,
+			Name:               name,
 			Method:             zip.Store,
 			Flags:              0,
 			Modified:           time.Now(),
-			CRC32:              crc32.ChecksumIEEE(e.data),
+			CRC32:              crc.Sum32(),
 			CompressedSize:     sz32,
 			UncompressedSize:   sz32,
 			CompressedSize64:   sz,
 			UncompressedSize64: sz,
 		}
-		if e.exe {
+		if exe {
 			fh.SetMode(0o755)
 		} else {
 			fh.SetMode(0o644)
 		}
-		w, err := zw.CreateRaw(fh)
+		zf, err := zw.CreateRaw(fh)
 		if err != nil {
 			return err
 		}
-		_, err = w.Write(e.data)
-		return err
+		if _, err := io.Copy(zf, io.NewSectionReader(r, 0, r.Size())); err != nil {
+			return err
+		}
+		fmt.Fprintf(&rec, "%s,%s,%d\n", name, recordDigest(sum), n)
+		return nil
+	}
+	bytesSection := func(data []byte) *io.SectionReader {
+		return io.NewSectionReader(bytes.NewReader(data), 0, int64(len(data)))
 	}
 
+	if err := addEntry(binaryName, binary, true); err != nil {
+		return fmt.Errorf("adding %s: %w", binaryName, err)
+	}
 	for _, e := range entries {
-		if err := addEntry(e); err != nil {
-			return "", fmt.Errorf("adding %s: %w", e.name, err)
+		if err := addEntry(e.name, bytesSection(e.data), e.exe); err != nil {
+			return fmt.Errorf("adding %s: %w", e.name, err)
 		}
 	}
-	// RECORD must be the last entry.
-	if err := addEntry(wheelEntry{recordName, []byte(rec.String()), false}); err != nil {
-		return "", fmt.Errorf("adding RECORD: %w", err)
+	fmt.Fprintf(&rec, "%s,,\n", recordName)
+	if err := addEntry(recordName, bytesSection([]byte(rec.String())), false); err != nil {
+		return fmt.Errorf("adding RECORD: %w", err)
 	}
 	if err := zw.Close(); err != nil {
-		return "", fmt.Errorf("closing zip: %w", err)
+		return fmt.Errorf("closing zip: %w", err)
 	}
-
-	out := filepath.Join(cfg.Output, wheelFilename(pkg, pyVersion, plat))
-	if err := os.WriteFile(out, buf.Bytes(), 0o644); err != nil {
-		return "", fmt.Errorf("write wheel: %w", err)
-	}
-	slog.Debug("wrote wheel", "path", out)
-	return out, nil
+	return nil
 }
@@ -4,6 +4,8 @@ package main
 import (
 	"archive/zip"
 	"bytes"
+	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
@@ -54,7 +56,7 @@ func wheelEntries(t *testing.T, path string) map[string][]byte {
 func TestBuildWheel_RequiredEntries(t *testing.T) {
 	cfg := testCfg(t)
 	outPath, err := buildWheel(
-		[]byte("fake binary"), "myrepo", "1.2.3",
+		sectionOf([]byte("fake binary")), "myrepo", "1.2.3",
 		cfg, "1.2.3", "manylinux_2_17_x86_64",
 		[]byte("# Description"), []byte("MIT License"),
 	)
@@ -84,7 +86,7 @@ func TestBuildWheel_RequiredEntries(t *testing.T) {
 func TestBuildWheel_Filename(t *testing.T) {
 	cfg := testCfg(t)
 	outPath, err := buildWheel(
-		[]byte("bin"), "myrepo", "2.0.0",
+		sectionOf([]byte("bin")), "myrepo", "2.0.0",
 		cfg, "2.0.0", "macosx_11_0_arm64",
 		[]byte("desc"), []byte("lic"),
 	)
@@ -101,7 +103,7 @@ func TestBuildWheel_Filename(t *testing.T) {
 func TestBuildWheel_UnixShim(t *testing.T) {
 	cfg := testCfg(t)
 	outPath, err := buildWheel(
-		[]byte("bin"), "myrepo", "1.0.0",
+		sectionOf([]byte("bin")), "myrepo", "1.0.0",
 		cfg, "1.0.0", "manylinux_2_17_x86_64",
 		[]byte("desc"), []byte("lic"),
 	)
@@ -123,7 +125,7 @@ func TestBuildWheel_UnixShim(t *testing.T) {
 func TestBuildWheel_WindowsShim(t *testing.T) {
 	cfg := testCfg(t)
 	outPath, err := buildWheel(
-		[]byte("exe data"), "myrepo.exe", "1.0.0",
+		sectionOf([]byte("exe data")), "myrepo.exe", "1.0.0",
 		cfg, "1.0.0", "win_amd64",
 		[]byte("desc"), []byte("lic"),
 	)
@@ -148,7 +150,7 @@ func TestBuildWheel_MetadataContents(t *testing.T) {
 	cfg.LicenseExpr = "Apache-2.0"
 
 	outPath, err := buildWheel(
-		[]byte("bin"), "myrepo", "3.1.4",
+		sectionOf([]byte("bin")), "myrepo", "3.1.4",
 		cfg, "3.1.4", "manylinux_2_17_x86_64",
 		[]byte("long description here"), []byte("Apache License"),
 	)
@@ -177,7 +179,7 @@ func TestBuildWheel_MetadataContents(t *testing.T) {
 func TestBuildWheel_WheelTag(t *testing.T) {
 	cfg := testCfg(t)
 	outPath, err := buildWheel(
-		[]byte("bin"), "myrepo", "1.0.0",
+		sectionOf([]byte("bin")), "myrepo", "1.0.0",
 		cfg, "1.0.0", "win_amd64",
 		[]byte("d"), []byte("l"),
 	)
@@ -193,12 +195,34 @@ func TestBuildWheel_WheelTag(t *testing.T) {
 	}
 }
 
+func TestBuildWheel_CompressedTagSet(t *testing.T) {
+	cfg := testCfg(t)
+	outPath, err := buildWheel(
+		sectionOf([]byte("bin")), "myrepo", "1.0.0",
+		cfg, "1.0.0", "manylinux_2_17_x86_64.musllinux_1_1_x86_64",
+		[]byte("d"), []byte("l"),
+	)
+	if err != nil {
+		t.Fatalf("buildWheel: %v", err)
+	}
+	if got := filepath.Base(outPath); got != "myrepo-1.0.0-py3-none-manylinux_2_17_x86_64.musllinux_1_1_x86_64.whl" {
+		t.Errorf("filename = %q", got)
+	}
+
+	wheelMeta := string(wheelEntries(t, outPath)["myrepo-1.0.0.dist-info/WHEEL"])
+	for _, want := range []string{"Tag: py3-none-manylinux_2_17_x86_64\n", "Tag: py3-none-musllinux_1_1_x86_64\n"} {
+		if !strings.Contains(wheelMeta, want) {
+			t.Errorf("WHEEL missing %q, got:\n%s", want, wheelMeta)
+		}
+	}
+}
+
 func TestBuildWheel_EntryPoints(t *testing.T) {
 	cfg := testCfg(t)
 	cfg.EntryPoint = "my-cli"
 
 	outPath, err := buildWheel(
-		[]byte("bin"), "myrepo", "1.0.0",
+		sectionOf([]byte("bin")), "myrepo", "1.0.0",
 		cfg, "1.0.0", "manylinux_2_17_x86_64",
 		[]byte("d"), []byte("l"),
 	)
@@ -217,7 +241,7 @@ func TestBuildWheel_EntryPoints(t *testing.T) {
 func TestBuildWheel_RecordPresent(t *testing.T) {
 	cfg := testCfg(t)
 	outPath, err := buildWheel(
-		[]byte("bin"), "myrepo", "1.0.0",
+		sectionOf([]byte("bin")), "myrepo", "1.0.0",
 		cfg, "1.0.0", "manylinux_2_17_x86_64",
 		[]byte("d"), []byte("l"),
 	)
@@ -239,13 +263,96 @@ func TestBuildWheel_RecordPresent(t *testing.T) {
 	}
 }
 
+func TestBuildWheel_ExtraFiles(t *testing.T) {
+	cfg := testCfg(t)
+	outPath, err := buildWheel(
+		sectionOf([]byte("bin")), "myrepo", "1.0.0",
+		cfg, "1.0.0", "manylinux_2_17_x86_64",
+		[]byte("d"), []byte("l"),
+		wheelEntry{"share/man/man1/myrepo.1", []byte(".TH MYREPO 1"), false},
+		wheelEntry{"README.md", []byte("# readme"), false},
+	)
+	if err != nil {
+		t.Fatalf("buildWheel: %v", err)
+	}
+
+	entries := wheelEntries(t, outPath)
+	record := string(entries["myrepo-1.0.0.dist-info/RECORD"])
+	for _, name := range []string{"myrepo-1.0.0.data/data/share/man/man1/myrepo.1", "myrepo/README.md"} {
+		if _, ok := entries[name]; !ok {
+			t.Errorf("missing %s", name)
+		}
+		if !strings.Contains(record, name+",sha256=") {
+			t.Errorf("RECORD missing entry for %s", name)
+		}
+	}
+
+	// An extra file may not replace a generated one.
+	_, err = buildWheel(
+		sectionOf([]byte("bin")), "myrepo", "1.0.0",
+		cfg, "1.0.0", "manylinux_2_17_x86_64",
+		[]byte("d"), []byte("l"),
+		wheelEntry{"_shim.py", []byte("evil"), false},
+	)
+	if err == nil {
+		t.Error("expected error for an extra file replacing _shim.py")
+	}
+}
+
+func TestBuildWheel_RecordMatchesContents(t *testing.T) {
+	cfg := testCfg(t)
+	bin := bytes.Repeat([]byte("binary "), 1000)
+	outPath, err := buildWheel(
+		sectionOf(bin), "myrepo", "1.0.0",
+		cfg, "1.0.0", "manylinux_2_17_x86_64",
+		[]byte("desc"), []byte("lic"),
+	)
+	if err != nil {
+		t.Fatalf("buildWheel: %v", err)
+	}
+	entries := wheelEntries(t, outPath)
+	if !bytes.Equal(entries["myrepo/myrepo"], bin) {
+		t.Error("binary content differs from input")
+	}
+	for _, line := range strings.Split(strings.TrimSpace(string(entries["myrepo-1.0.0.dist-info/RECORD"])), "\n") {
+		parts := strings.Split(line, ",")
+		if parts[0] == "myrepo-1.0.0.dist-info/RECORD" {
+			continue
+		}
+		data := entries[parts[0]]
+		if want := fmt.Sprintf("%s,%s,%d", parts[0], recordHash(data), len(data)); line != want {
+			t.Errorf("RECORD line %q, want %q", line, want)
+		}
+	}
+}
+
+// failingReaderAt fails every read.
+type failingReaderAt struct{}
+
+func (failingReaderAt) ReadAt([]byte, int64) (int, error) { return 0, errors.New("disk error") }
+
+func TestBuildWheel_NoPartialFileOnError(t *testing.T) {
+	cfg := testCfg(t)
+	_, err := buildWheel(
+		io.NewSectionReader(failingReaderAt{}, 0, 100), "myrepo", "1.0.0",
+		cfg, "1.0.0", "manylinux_2_17_x86_64",
+		[]byte("desc"), []byte("lic"),
+	)
+	if err == nil {
+		t.Fatal("expected error for an unreadable binary")
+	}
+	if files, _ := os.ReadDir(cfg.Output); len(files) != 0 {
+		t.Errorf("output dir has %d files after a failed build, want 0", len(files))
+	}
+}
+
 func TestBuildWheel_HyphenatedPackage(t *testing.T) {
 	cfg := testCfg(t)
 	cfg.PackageName = "my-tool"
 	cfg.EntryPoint = "my-tool"
 
 	outPath, err := buildWheel(
-		[]byte("bin"), "my-tool", "1.0.0",
+		sectionOf([]byte("bin")), "my-tool", "1.0.0",
 		cfg, "1.0.0", "manylinux_2_17_x86_64",
 		[]byte("d"), []byte("l"),
 	)
@@ -276,6 +383,50 @@ func TestNormalize(t *testing.T) {
 	}
 }
 
+func TestNormalizeVersion(t *testing.T) {
+	tests := map[string]string{
+		"1.2.3":          "1.2.3",
+		"v1.2.3":         "1.2.3",
+		"1.2.0-rc.1":     "1.2.0rc1",
+		"1.2.0-RC1":      "1.2.0rc1",
+		"1.0.0-beta":     "1.0.0b0",
+		"1.0.0-alpha.2":  "1.0.0a2",
+		"2.0.0-preview3": "2.0.0rc3",
+		"1.0-post.1":     "1.0.post1",
+		"1.0-1":          "1.0.post1",
+		"1.0.0-dev.4":    "1.0.0.dev4",
+		"1.0.0+Ubuntu-1": "1.0.0+ubuntu.1",
+		"01.002.3":       "1.2.3",
+
+		"1.3.0-SNAPSHOT-abc1234":   "1.3.0.dev0+abc1234",
+		"v1.3.0-SNAPSHOT":          "1.3.0.dev0",
+		"1.3.0-rc.1-SNAPSHOT-a1b2": "1.3.0rc1.dev0+a1b2",
+	}
+	for in, want := range tests {
+		got, err := normalizeVersion(in)
+		if err != nil {
+			t.Errorf("normalizeVersion(%q): %v", in, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("normalizeVersion(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeVersion_Invalid(t *testing.T) {
+	for _, in := range []string{"v1.2.3-alpha.beta", "SNAPSHOT-abc1234", "1.0.dev1-SNAPSHOT", "nightly", ""} {
+		got, err := normalizeVersion(in)
+		if err == nil {
+			t.Errorf("normalizeVersion(%q) = %q, want error", in, got)
+			continue
+		}
+		if !strings.Contains(err.Error(), "-py-version") {
+			t.Errorf("normalizeVersion(%q) error %q should mention -py-version", in, err)
+		}
+	}
+}
+
 // --- wheelFilename ---
 
 func TestWheelFilename(t *testing.T) {